@@ -0,0 +1,205 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/palmbyrosiadev/red-compiler/internal/interp"
+	"github.com/palmbyrosiadev/red-compiler/red"
+)
+
+// What a compiled program runs, the name of the program and its path among the files it was
+// bundled with are filled in
+const programmain = `
+func main() {
+	ip := New()
+	ip.SetArgs(os.Args[1:]...)
+	ip.SetFiles(programfiles)
+	err := ip.LoadBuiltins()
+	if err == nil {
+		ip.Load(%q, string(programfiles[%q]))
+		err = ip.Run()
+	}
+	if e, ok := err.(*Error); ok {
+		os.Exit(e.Code)
+	}
+}
+`
+
+// The Go source of a program, the interpreter turned into package main with the imports of its
+// files merged and the files collected by Bundle, main among them, built in
+func programsource(main string, files map[string][]byte) ([]byte, error) {
+	sources, err := fs.Glob(interp.Source, "*.go")
+	if err != nil {
+		return nil, err
+	}
+	imports := map[string]bool{`"os"`: true}
+	var body bytes.Buffer
+	for _, file := range sources {
+		src, err := interp.Source.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, src, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range f.Imports {
+			imp := spec.Path.Value
+			if spec.Name != nil {
+				imp = spec.Name.Name + " " + imp
+			}
+			imports[imp] = true
+		}
+
+		// Everything after the imports is the code of the file
+		start := int(f.Name.End()) - 1
+		if len(f.Decls) > 0 {
+			start = int(f.Decls[len(f.Decls)-1].End()) - 1
+		}
+		body.WriteString("\n")
+		body.Write(src[start:])
+	}
+
+	var res bytes.Buffer
+	res.WriteString("package main\n\nimport (\n")
+	for _, imp := range sortedimports(imports) {
+		fmt.Fprintf(&res, "\t%s\n", imp)
+	}
+	res.WriteString(")\n")
+	fmt.Fprintf(&res, programmain, path.Base(main), main)
+	res.WriteString("\nvar programfiles = map[string][]byte{\n")
+	for _, name := range sortedkeys(files) {
+		fmt.Fprintf(&res, "\t%q: []byte(%q),\n", name, files[name])
+	}
+	res.WriteString("}\n")
+	res.Write(body.Bytes())
+	return format.Source(res.Bytes())
+}
+
+func sortedimports(imports map[string]bool) []string {
+	var list []string
+	for imp := range imports {
+		list = append(list, imp)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func sortedkeys(files map[string][]byte) []string {
+	var list []string
+	for name := range files {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// How build compiles a program, empty fields use the defaults of the Go toolchain
+type buildopts struct {
+	output  string
+	goos    string
+	goarch  string
+	tags    string
+	ldflags string
+
+	// Where to look for the files the program loads besides the working directory
+	include []string
+
+	// Where to keep the generated Go source, it is thrown away when empty
+	source string
+}
+
+// The file a program is compiled into unless another is given, named after the program with
+// .exe added for Windows
+func defaultoutput(path string, goos string) string {
+	if goos == "" {
+		goos = os.Getenv("GOOS")
+	}
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".red")
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Compile a program and the files it loads into a binary with the Go toolchain, working in a
+// temporary directory so nothing is left behind next to the program
+func build(file string, opts buildopts) error {
+	ip := red.New()
+	ip.SetIncludePaths(opts.include...)
+	files, err := ip.Bundle(file)
+	if err != nil {
+		return err
+	}
+	src, err := programsource(filepath.ToSlash(filepath.Clean(file)), files)
+	if err != nil {
+		return err
+	}
+	if opts.source != "" {
+		if err := os.WriteFile(opts.source, src, 0644); err != nil {
+			return err
+		}
+	}
+	if opts.output == "" {
+		opts.output = defaultoutput(file, opts.goos)
+	}
+	output, err := filepath.Abs(opts.output)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "red-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), src, 0644); err != nil {
+		return err
+	}
+
+	args := []string{"build", "-o", output}
+	if opts.tags != "" {
+		args = append(args, "-tags", opts.tags)
+	}
+	if opts.ldflags != "" {
+		args = append(args, "-ldflags", opts.ldflags)
+	}
+	cmd := exec.Command("go", append(args, "main.go")...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	if opts.goos != "" {
+		cmd.Env = append(cmd.Env, "GOOS="+opts.goos)
+	}
+	if opts.goarch != "" {
+		cmd.Env = append(cmd.Env, "GOARCH="+opts.goarch)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go build: %w", err)
+	}
+	return nil
+}
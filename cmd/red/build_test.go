@@ -0,0 +1,145 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// The options of build reach the Go toolchain and the generated source holds the interpreter
+// without its tools
+func TestBuildOptions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiling takes a while")
+	}
+	red := goldenbuild(t, "red", ".")
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "prog.red"), []byte("PUSH \"built\"\nPRINT"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Built for this system and named after the program
+	if out, code := runred(t, red, dir, "", "build", "-I", root, "prog.red"); code != 0 {
+		t.Fatalf("red build exited with %d:\n%s", code, out)
+	}
+	out, code := runred(t, filepath.Join(dir, defaultoutput("prog.red", runtime.GOOS)), dir, "")
+	if code != 0 || out != "built\n" {
+		t.Errorf("the program exited with %d and printed %q", code, out)
+	}
+
+	// Built for another system with the tags and linker flags given
+	goos, goarch := "windows", "arm64"
+	if runtime.GOOS == goos {
+		goos = "linux"
+	}
+	out, code = runred(t, red, dir, "", "build", "-I", root, "--os", goos, "--arch", goarch, "--tags", "redtest", "--ldflags", "-s -w", "--source", "main.go", "-o", "cross", "prog.red")
+	if code != 0 {
+		t.Fatalf("red build exited with %d:\n%s", code, out)
+	}
+	info, err := exec.Command("go", "version", "-m", filepath.Join(dir, "cross")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, info)
+	}
+	for _, want := range []string{"GOOS=" + goos, "GOARCH=" + goarch, "-tags=redtest", `-ldflags="-s -w"`} {
+		if !strings.Contains(string(info), want) {
+			t.Errorf("the binary was not built with %s:\n%s", want, info)
+		}
+	}
+
+	src, err := os.ReadFile(filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "main.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name.Name != "main" || f.Scope.Lookup("programfiles") == nil {
+		t.Errorf("main.go is not the program's package main")
+	}
+	for _, tool := range []string{"Repl", "Debug", "Test", "Format", "Check", "Lint", "ServeDAP", "ServeLSP", "dapsession", "lspsession", "srcenv"} {
+		if f.Scope.Lookup(tool) != nil {
+			t.Errorf("main.go holds %s, which the program does not use", tool)
+		}
+	}
+	if !strings.Contains(string(src), `"prog.red":`) || !strings.Contains(string(src), `[]byte("PUSH \"built\"\nPRINT")`) {
+		t.Errorf("main.go does not hold the program")
+	}
+}
+
+// A binary built with --runtime runs its parsed program without the files it was made from,
+// and building from it again leaves its program out
+func TestBuildRuntime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiling takes a while")
+	}
+	red := goldenbuild(t, "red", ".")
+	dir := t.TempDir()
+	util, err := os.ReadFile(filepath.Join(goldenbuiltin, "util.kr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"built-in/util.kr": string(util),
+		"greet.kr":         "KEYWORD GREET HELLO who:string greeting:string=\"Hello\"\n\tLOADARG who\n\tPUSH \" \"\n\tSTRCAT\n\tLOADARG greeting\n\tSTRCAT\n\tPRINT\nENDKEYWORD",
+		"double.mred":      "EXPORT n 1\nFUNC double\n\tLOAD n\n\tPUSH 2\n\tMULT\n\tSTORE n\nENDFUNC",
+		"first.red":        "KEYPORT greet.kr\nIMPORT double.mred d\nPUSH 21\nMODSTORE d n\nMODRUN d double\nMODGET d n\nPRINT\nGREET HELLO \"world\"",
+		"second.red":       "PUSH \"second\"\nPRINT",
+	}
+	for name, text := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := filepath.Join(dir, "first")
+	if out, code := runred(t, red, dir, "", "build", "--runtime="+red, "-o", first, "first.red"); code != 0 {
+		t.Fatalf("red build exited with %d:\n%s", code, out)
+	}
+	if out, code := runred(t, first, t.TempDir(), ""); code != 0 || out != "42\nHello world\n" {
+		t.Errorf("the program exited with %d and printed %q", code, out)
+	}
+
+	// The payload of first is stripped, so second is the same size as a binary made from red
+	second, direct := filepath.Join(dir, "second"), filepath.Join(dir, "direct")
+	for _, b := range [][2]string{{first, second}, {red, direct}} {
+		if out, code := runred(t, red, dir, "", "build", "--runtime="+b[0], "-o", b[1], "second.red"); code != 0 {
+			t.Fatalf("red build exited with %d:\n%s", code, out)
+		}
+	}
+	if out, code := runred(t, second, t.TempDir(), ""); code != 0 || out != "second\n" {
+		t.Errorf("the rebuilt program exited with %d and printed %q", code, out)
+	}
+	a, err := os.Stat(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.Stat(direct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Size() != b.Size() {
+		t.Errorf("the rebuilt binary is %d bytes, want %d", a.Size(), b.Size())
+	}
+
+	// -o cannot name the runtime, which is left as it was
+	out, code := runred(t, red, dir, "", "build", "--runtime="+first, "-o", first, "second.red")
+	if code != 1 || !strings.Contains(out, "would overwrite the runtime it is made from") {
+		t.Errorf("building over the runtime exited with %d and printed %q", code, out)
+	}
+	if out, code := runred(t, first, t.TempDir(), ""); code != 0 || out != "42\nHello world\n" {
+		t.Errorf("after building over it the program exited with %d and printed %q", code, out)
+	}
+}
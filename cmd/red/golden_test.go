@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// The examples and built-in are kept at the top of the repository
+var (
+	goldenexamples = filepath.Join("..", "..", "examples")
+	goldenbuiltin  = filepath.Join("..", "..", "built-in")
+)
+
+// Every example is run with this seed so RANDINT picks the same numbers each time
+const goldenseed = "1"
+
+// The example programs, as paths relative to examples. Test files hold no program of their own
+func goldenprograms(t *testing.T) []string {
+	var programs []string
+	err := filepath.Walk(goldenexamples, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".red") && !strings.HasSuffix(path, "_test.red") {
+			rel, _ := filepath.Rel(goldenexamples, path)
+			programs = append(programs, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(programs) == 0 {
+		t.Fatal("no programs found under examples")
+	}
+	return programs
+}
+
+// Build a tool of the repository into a temporary directory and return its path
+func goldenbuild(t *testing.T, name string, target string) string {
+	out := filepath.Join(t.TempDir(), name)
+	cmd := exec.Command("go", "build", "-o", out, target)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building %s: %v\n%s", name, err, msg)
+	}
+	abs, _ := filepath.Abs(out)
+	return abs
+}
+
+// Copy the folder of an example to a temporary directory with built-in next to it, the way
+// the programs are run by hand
+func goldenfolder(t *testing.T, program string) string {
+	dir := t.TempDir()
+	for _, src := range []string{filepath.Join(goldenexamples, filepath.Dir(program)), goldenbuiltin} {
+		dest := dir
+		if src == goldenbuiltin {
+			dest = filepath.Join(dir, "built-in")
+		}
+		err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(src, path)
+			if info.IsDir() {
+				return os.MkdirAll(filepath.Join(dest, rel), 0755)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Join(dest, rel), data, 0644)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// Run a command in dir with the scripted input of the program, returning what it printed
+// followed by its exit status
+func goldenrun(t *testing.T, dir string, program string, name string, args ...string) string {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "RED_SEED="+goldenseed)
+	if input, err := os.ReadFile(goldenpath(program, ".stdin")); err == nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	code := 0
+	if err := cmd.Run(); err != nil {
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) {
+			t.Fatal(err)
+		}
+		code = exit.ExitCode()
+	}
+	return fmt.Sprintf("%s--- exit status %d\n", out.String(), code)
+}
+
+// Where the golden files of a program are kept, ext is .out for the expected output and
+// .stdin for the input typed into it
+func goldenpath(program string, ext string) string {
+	return filepath.Join("testdata", "golden", strings.TrimSuffix(program, ".red")+ext)
+}
+
+func goldencompare(t *testing.T, program string, got string) {
+	t.Helper()
+	path := goldenpath(program, ".out")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run go test -run Golden -update to create it", err)
+	}
+	if got != string(want) {
+		t.Errorf("output of %s differs from %s\ngot:\n%s\nwant:\n%s", program, path, got, want)
+	}
+}
+
+func TestGoldenInterpreter(t *testing.T) {
+	red := goldenbuild(t, "red", ".")
+	for _, program := range goldenprograms(t) {
+		program := program
+		t.Run(program, func(t *testing.T) {
+			dir := goldenfolder(t, program)
+			goldencompare(t, program, goldenrun(t, dir, program, red, "run", filepath.Base(program)))
+		})
+	}
+}
+
+// Compiled programs must print exactly what the interpreter prints, without the files they load
+// next to them
+func TestGoldenCompiler(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiling every example takes a while")
+	}
+	if *update {
+		t.Skip("golden files are written from the interpreter")
+	}
+	red := goldenbuild(t, "red", ".")
+	for _, program := range goldenprograms(t) {
+		program := program
+		t.Run(program, func(t *testing.T) {
+			t.Parallel()
+			dir := goldenfolder(t, program)
+			cmd := exec.Command(red, "build", filepath.Base(program), "program")
+			cmd.Dir = dir
+			if msg, err := cmd.CombinedOutput(); err != nil || len(msg) > 0 {
+				t.Fatalf("compiling %s: %v\n%s", program, err, msg)
+			}
+			goldencompare(t, program, goldenrun(t, t.TempDir(), program, filepath.Join(dir, "program")))
+		})
+	}
+}
+
+// Programs appended to a copy of red must print exactly what the interpreter prints, without the
+// files they load next to them
+func TestGoldenRuntime(t *testing.T) {
+	if *update {
+		t.Skip("golden files are written from the interpreter")
+	}
+	red := goldenbuild(t, "red", ".")
+	for _, program := range goldenprograms(t) {
+		program := program
+		t.Run(program, func(t *testing.T) {
+			dir := goldenfolder(t, program)
+			binary := filepath.Join(t.TempDir(), "program")
+			cmd := exec.Command(red, "build", "--runtime", "-o", binary, filepath.Base(program))
+			cmd.Dir = dir
+			if msg, err := cmd.CombinedOutput(); err != nil || len(msg) > 0 {
+				t.Fatalf("building %s: %v\n%s", program, err, msg)
+			}
+			goldencompare(t, program, goldenrun(t, t.TempDir(), program, binary))
+		})
+	}
+}
@@ -0,0 +1,132 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/palmbyrosiadev/red-compiler/internal/interp"
+	"github.com/palmbyrosiadev/red-compiler/red"
+)
+
+// A program appended to a copy of red, which runs it instead of acting as red. The binary ends
+// with the parsed program encoded with encoding/gob, its length as 8 bytes and payloadmagic
+const payloadmagic = "\x00RED-PAYLOAD-2\x00"
+
+// Find the payload at the end of a binary, size is how much of the binary comes before it
+func readpayload(f *os.File) (p *interp.Program, size int64, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	trailer := int64(8 + len(payloadmagic))
+	size = info.Size()
+	if size < trailer {
+		return nil, size, nil
+	}
+	buf := make([]byte, trailer)
+	if _, err := f.ReadAt(buf, size-trailer); err != nil {
+		return nil, 0, err
+	}
+	if string(buf[8:]) != payloadmagic {
+		return nil, size, nil
+	}
+	n := int64(binary.LittleEndian.Uint64(buf[:8]))
+	if n > size-trailer {
+		return nil, 0, errors.New("damaged payload")
+	}
+	data := make([]byte, n)
+	if _, err := f.ReadAt(data, size-trailer-n); err != nil {
+		return nil, 0, err
+	}
+	p = &interp.Program{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(p); err != nil {
+		return nil, 0, fmt.Errorf("damaged payload: %w", err)
+	}
+	return p, size - trailer - n, nil
+}
+
+// The payload of the running binary, nil when it is red itself
+func ownpayload() *interp.Program {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	p, _, err := readpayload(f)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return p
+}
+
+// Run the program of a payload, every argument is the program's own
+func runpayload(p *interp.Program) {
+	ip := red.New()
+	ip.SetArgs(os.Args[1:]...)
+	p.Load(ip)
+	exit(ip, ip.LoadBuiltins())
+	exit(ip, ip.Run())
+}
+
+// Write a copy of the runtime binary with a program and the files it loads appended to output,
+// parsed, without needing the Go toolchain. A payload the runtime already carries is left out
+func appendpayload(runtime string, output string, file string, include []string) error {
+	ip := red.New()
+	ip.SetIncludePaths(include...)
+	p, err := interp.Compile(ip, file)
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(p); err != nil {
+		return err
+	}
+
+	in, err := os.Open(runtime)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if a, err := os.Stat(runtime); err == nil {
+		if b, err := os.Stat(output); err == nil && os.SameFile(a, b) {
+			return fmt.Errorf("%s would overwrite the runtime it is made from", output)
+		}
+	}
+	_, size, err := readpayload(in)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, io.NewSectionReader(in, 0, size)); err != nil {
+		out.Close()
+		return err
+	}
+	binary.Write(&data, binary.LittleEndian, uint64(data.Len()))
+	data.WriteString(payloadmagic)
+	if _, err := out.Write(data.Bytes()); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
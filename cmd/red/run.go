@@ -0,0 +1,397 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/palmbyrosiadev/red-compiler/internal/interp"
+	"github.com/palmbyrosiadev/red-compiler/pkg"
+	"github.com/palmbyrosiadev/red-compiler/red"
+)
+
+// Set for releases with go build -ldflags "-X main.version=1.2.0"
+var version = "devel"
+
+// A subcommand of red, short is shown in the list of commands and help by --help. run gets the
+// arguments after its name
+type command struct {
+	name  string
+	usage string
+	short string
+	help  string
+	run   func(args []string)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "[options] file.red [arguments]", "run a program", "Run a program, the arguments after the file are the program's own. This is what red does when it is given a file without a command, so a program starting with #!/usr/bin/env red can be run as a script.", runcmd},
+		{"build", "[options] file.red [name]", "compile a program into a binary", "Compile a program into a binary, called after the file unless a name or -o is given. Needs the Go toolchain, which can build it for another system with --os and --arch.", buildcmd},
+		{"repl", "[options]", "start an interactive session", "Start an interactive session, which is also what red does without arguments.", replcmd},
+		{"test", "[options] [paths]", "run the tests of *_test.red files", "Run the TEST blocks of the *_test.red files in the paths, the current folder if there are none.", testcmd},
+		{"fmt", "[options] [paths]", "format sources", "Format the sources in the paths in place, the current folder if there are none.", fmtcmd},
+		{"check", "[paths]", "report problems without running anything", "Report problems in the sources in the paths without running anything.", checkcmd},
+		{"lint", "[paths]", "look for common mistakes", "Look for common mistakes in the sources in the paths.", lintcmd},
+		{"lsp", "", "serve the Language Server Protocol", "Serve the Language Server Protocol to an editor on stdin and stdout.", lspcmd},
+		{"dap", "[address]", "serve the Debug Adapter Protocol", "Serve the Debug Adapter Protocol to an editor on stdin and stdout, or wait for one to connect on an address such as 127.0.0.1:4711.", dapcmd},
+		{"pkg", "<command> [arguments] [--registry dir]", "manage the packages a project depends on", "Install the packages listed in red.json from a registry into vendor and keep red.lock up to date.", pkgcmd},
+		{"version", "", "print the version", "Print the version of red.", versioncmd},
+	}
+}
+
+func findcommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// The options of a command, --help prints its usage and the options it takes
+func newflags(name string) *flag.FlagSet {
+	c, _ := findcommand(name)
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s\n\n%s\n", strings.TrimSpace("red "+c.name+" "+c.usage), c.help)
+		hasflags := false
+		fs.VisitAll(func(*flag.Flag) { hasflags = true })
+		if hasflags {
+			fmt.Fprintln(fs.Output(), "\nOptions:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// Parse the options before the other arguments and return those
+func parseflags(fs *flag.FlagSet, args []string) []string {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+	return fs.Args()
+}
+
+// An option that can be given on its own or with a value, such as --coverage or --coverage=name
+type optional struct {
+	set   bool
+	value string
+}
+
+func (o *optional) String() string   { return o.value }
+func (o *optional) IsBoolFlag() bool { return true }
+
+func (o *optional) Set(value string) error {
+	o.set = true
+	if value != "true" {
+		o.value = value
+	}
+	return nil
+}
+
+// An option that can be given more than once, such as -I
+type pathlist []string
+
+func (p *pathlist) register(fs *flag.FlagSet) {
+	fs.Var(p, "I", "also look for modules, keyword files and built-in in `dir`, can be given more than once")
+	fs.Var(p, "include", "look in `dir` the same as -I")
+}
+
+func (p *pathlist) String() string { return strings.Join(*p, string(os.PathListSeparator)) }
+
+func (p *pathlist) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// The options of every command that runs RED code
+type runopts struct {
+	seed    string
+	include pathlist
+	trace   bool
+}
+
+func (o *runopts) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.seed, "seed", "", "seed the random numbers with a `number` so they repeat, or secure to use the system's secure source")
+	o.include.register(fs)
+	fs.BoolVar(&o.trace, "trace", false, "print every line to stderr before it runs")
+}
+
+func (o *runopts) apply(ip *red.Interpreter) {
+	if o.seed != "" {
+		seed(ip, o.seed)
+	}
+	ip.SetIncludePaths(o.include...)
+	if o.trace {
+		ip.Trace(os.Stderr)
+	}
+}
+
+// End the process with the exit code of a program that failed, errors that are not the
+// program's own have not been printed yet
+func exit(ip *red.Interpreter, err error) {
+	if err == nil {
+		return
+	}
+	ip.ReportCoverage()
+	var e *red.Error
+	if errors.As(err, &e) {
+		os.Exit(e.Code)
+	}
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+// Seed the random keywords for --seed=number or --seed=secure
+func seed(ip *red.Interpreter, value string) {
+	if value == "secure" {
+		ip.SecureRandom()
+		return
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		fmt.Printf("Invalid seed %s, expected a whole number or secure\n", value)
+		os.Exit(1)
+	}
+	ip.Seed(n)
+}
+
+func runcmd(args []string) {
+	fs := newflags("run")
+	var opts runopts
+	opts.register(fs)
+	debug := fs.Bool("debug", false, "stop before the first line and wait for debugger commands")
+	var coverage optional
+	fs.Var(&coverage, "coverage", "record which lines run and write coverage.lcov and coverage.html, or name.lcov and name.html with --coverage=name")
+	args = parseflags(fs, args)
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ip := red.New()
+	opts.apply(ip)
+	if coverage.set {
+		ip.Coverage(coverage.value)
+	}
+
+	// Read the input file, the arguments after it are the program's
+	ip.SetArgs(args[1:]...)
+	exit(ip, ip.LoadFile(args[0]))
+	exit(ip, ip.LoadBuiltins())
+	if *debug {
+		interp.Debug(ip)
+	}
+	exit(ip, ip.Run())
+	if *debug {
+		fmt.Println("Program finished")
+	}
+	ip.ReportCoverage()
+}
+
+func buildcmd(args []string) {
+	fs := newflags("build")
+	var opts buildopts
+	fs.StringVar(&opts.output, "o", "", "write the binary to `file`, by default it is named after the program")
+	fs.StringVar(&opts.goos, "os", "", "build for another operating `system` such as linux, darwin or windows, the same as GOOS")
+	fs.StringVar(&opts.goarch, "arch", "", "build for another `architecture` such as amd64 or arm64, the same as GOARCH")
+	fs.StringVar(&opts.tags, "tags", "", "a comma-separated `list` of build tags passed to go build")
+	fs.StringVar(&opts.ldflags, "ldflags", "", "`flags` passed to the Go linker, such as \"-s -w\" for a smaller binary")
+	fs.StringVar(&opts.source, "source", "", "also write the generated Go source to `file`")
+	var rt optional
+	fs.Var(&rt, "runtime", "append the program and the files it loads to a copy of red, or of another red binary with --runtime=file, instead of compiling it with Go")
+	var include pathlist
+	include.register(fs)
+	args = parseflags(fs, args)
+	opts.include = include
+	if len(args) == 0 || len(args) > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if len(args) > 1 {
+		opts.output = args[1]
+	}
+	var err error
+	if rt.set {
+		if opts.goos != "" || opts.goarch != "" || opts.tags != "" || opts.ldflags != "" || opts.source != "" {
+			fmt.Println("--os, --arch, --tags, --ldflags and --source need Go and cannot be used with --runtime, give --runtime a red binary built for the system instead")
+			os.Exit(2)
+		}
+		if rt.value == "" {
+			rt.value, err = os.Executable()
+		}
+		if opts.output == "" {
+			opts.output = defaultoutput(args[0], "")
+		}
+		if err == nil {
+			err = appendpayload(rt.value, opts.output, args[0], include)
+		}
+	} else {
+		err = build(args[0], opts)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func replcmd(args []string) {
+	fs := newflags("repl")
+	var opts runopts
+	opts.register(fs)
+	if len(parseflags(fs, args)) > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	ip := red.New()
+	opts.apply(ip)
+	exit(ip, ip.LoadBuiltins())
+	exit(ip, interp.Repl(ip))
+}
+
+func testcmd(args []string) {
+	fs := newflags("test")
+	var opts runopts
+	opts.register(fs)
+	junit := fs.String("junit", "", "also write a JUnit XML report to `file`")
+	var coverage optional
+	fs.Var(&coverage, "coverage", "record which lines the tests run and write coverage.lcov and coverage.html, or name.lcov and name.html with --coverage=name")
+	args = parseflags(fs, args)
+
+	ip := red.New()
+	opts.apply(ip)
+	if coverage.set {
+		ip.Coverage(coverage.value)
+	}
+	if !interp.Test(ip, args, *junit) {
+		os.Exit(1)
+	}
+}
+
+func fmtcmd(args []string) {
+	fs := newflags("fmt")
+	check := fs.Bool("check", false, "only list the files that are not formatted and exit with 1 if there are any")
+	args = parseflags(fs, args)
+	if !interp.Format(os.Stdout, args, *check) {
+		os.Exit(1)
+	}
+}
+
+func checkcmd(args []string) {
+	if !interp.Check(os.Stdout, parseflags(newflags("check"), args)) {
+		os.Exit(1)
+	}
+}
+
+func lintcmd(args []string) {
+	if !interp.Lint(os.Stdout, parseflags(newflags("lint"), args)) {
+		os.Exit(1)
+	}
+}
+
+func lspcmd(args []string) {
+	fs := newflags("lsp")
+	if len(parseflags(fs, args)) > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	interp.ServeLSP(os.Stdin, os.Stdout)
+}
+
+func dapcmd(args []string) {
+	fs := newflags("dap")
+	args = parseflags(fs, args)
+	if len(args) > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	addr := ""
+	if len(args) == 1 {
+		addr = args[0]
+	}
+	if err := interp.ServeDAP(addr); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// The package manager has commands of its own, it prints their usage for --help
+func pkgcmd(args []string) {
+	pkg.Main(args)
+}
+
+func versioncmd(args []string) {
+	parseflags(newflags("version"), args)
+	fmt.Printf("red %s %s/%s\n", version, runtime.GOOS, runtime.GOARCH)
+}
+
+// Print the commands, or the usage of one of them
+func help(args []string) {
+	if len(args) > 0 {
+		if c, ok := findcommand(args[0]); ok {
+			c.run([]string{"--help"})
+			return
+		}
+		fmt.Printf("Unknown command %s\n", args[0])
+		os.Exit(2)
+	}
+	fmt.Println("Usage: red <command> [options] [arguments]")
+	fmt.Println("       red [options] file.red [arguments]")
+	fmt.Println("\nCommands:")
+	for _, c := range commands {
+		fmt.Printf("  %-8s %s\n", c.name, c.short)
+	}
+	fmt.Println("\nRun red help <command> or red <command> --help for the options of a command.")
+}
+
+func main() {
+	// A program built with --runtime runs instead
+	if p := ownpayload(); p != nil {
+		runpayload(p)
+		return
+	}
+
+	// Without arguments start an interactive session
+	args := os.Args[1:]
+	if len(args) == 0 {
+		replcmd(nil)
+		return
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		help(args[1:])
+		return
+	case "-version", "--version":
+		versioncmd(nil)
+		return
+	}
+	if c, ok := findcommand(args[0]); ok {
+		c.run(args[1:])
+		return
+	}
+
+	// A file, or options followed by one, is run. A word that is neither is a mistyped command
+	if _, err := os.Stat(args[0]); err != nil && !strings.HasPrefix(args[0], "-") && !strings.ContainsAny(args[0], `./\`) {
+		fmt.Printf("Unknown command %s, run red help for a list of commands\n", args[0])
+		os.Exit(2)
+	}
+	runcmd(args)
+}
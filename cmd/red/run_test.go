@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Run red in dir with the input given, returning what it printed and its exit status
+func runred(t *testing.T, red string, dir string, input string, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(red, args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return string(out), exit.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+// Messages of the language server and debug adapter protocols, each after its Content-Length
+func protocolmessages(messages ...string) string {
+	var b strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	return b.String()
+}
+
+// Commands are found by name, anything else is a program to run
+func TestCommands(t *testing.T) {
+	red := goldenbuild(t, "red", ".")
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	prog := filepath.Join(dir, "prog.red")
+	if err := os.WriteFile(prog, []byte("ARGC\nPRINT"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lsp := protocolmessages(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`, `{"jsonrpc":"2.0","id":2,"method":"shutdown"}`, `{"jsonrpc":"2.0","method":"exit"}`)
+	dap := protocolmessages(`{"seq":1,"type":"request","command":"initialize","arguments":{}}`, `{"seq":2,"type":"request","command":"disconnect"}`)
+	for _, c := range []struct {
+		args  []string
+		input string
+		exit  int
+		want  string
+	}{
+		{[]string{"help"}, "", 0, "  lsp      serve the Language Server Protocol\n  dap      serve the Debug Adapter Protocol\n"},
+		{[]string{"--help"}, "", 0, "Usage: red <command> [options] [arguments]\n"},
+		{[]string{"version"}, "", 0, "red devel " + runtime.GOOS + "/" + runtime.GOARCH + "\n"},
+		{[]string{"run", "--help"}, "", 0, "Usage: red run [options] file.red [arguments]\n"},
+		{[]string{"help", "build"}, "", 0, "Usage: red build [options] file.red [name]\n"},
+		{[]string{"dap", "--help"}, "", 0, "Usage: red dap [address]\n"},
+		{[]string{"run"}, "", 2, "Usage: red run [options] file.red [arguments]\n"},
+		{[]string{"run", "--lsp"}, "", 2, "flag provided but not defined: -lsp\n"},
+		{[]string{"nope"}, "", 2, "Unknown command nope, run red help for a list of commands\n"},
+		{[]string{"help", "nope"}, "", 2, "Unknown command nope\n"},
+		{[]string{"run", prog, "a", "b"}, "", 0, "2\n"},
+		{[]string{prog, "a"}, "", 0, "1\n"},
+		{[]string{"--seed", "1", prog}, "", 0, "0\n"},
+		{[]string{"lsp"}, lsp, 0, `"capabilities":`},
+		{[]string{"lsp", "extra"}, "", 2, "Usage: red lsp\n"},
+		{[]string{"dap"}, dap, 0, `"command":"initialize"`},
+	} {
+		out, code := runred(t, red, root, c.input, c.args...)
+		if code != c.exit || !strings.Contains(out, c.want) {
+			t.Errorf("red %s exited with %d and printed\n%s\nwant %d and\n%s", strings.Join(c.args, " "), code, out, c.exit, c.want)
+		}
+	}
+}
+
+// A program starting with #! runs as a script with the arguments it is given
+func TestShebang(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("scripts need #! support")
+	}
+	red := goldenbuild(t, "red", ".")
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(script, []byte("#!"+red+"\nARGC\nPRINT\nEXIT 3"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	out, code := runred(t, script, root, "", "a", "b")
+	if code != 3 || out != "2\n" {
+		t.Errorf("the script exited with %d and printed %q, want 3 and %q", code, out, "2\n")
+	}
+}
+
+// red test tells a CI job whether the tests passed with its exit status
+func TestCommandTest(t *testing.T) {
+	red := goldenbuild(t, "red", ".")
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		code string
+		exit int
+		want string
+	}{
+		{"pass", "TEST fine\n\tPUSH 1\n\tASSERTEQ 1\nENDTEST", 0, "PASS fine (pass_test.red:1)\n1 passed, 0 failed\n"},
+		{"fail", "TEST fine\n\tPUSH 1\n\tASSERTEQ 1\nENDTEST\nTEST wrong\n\tPUSH 1\n\tASSERTEQ 2\nENDTEST", 1, "PASS fine (fail_test.red:1)\nFAIL wrong (fail_test.red:5)\n    fail_test.red:7: ASSERTEQ expected 2, got 1\n1 passed, 1 failed\n"},
+		{"none", "", 0, "No test files found\n"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if c.code != "" {
+				if err := os.WriteFile(filepath.Join(dir, c.name+"_test.red"), []byte(c.code), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cmd := exec.Command(red, "test", "-I", root, "--junit", "report.xml")
+			cmd.Dir = dir
+			out, err := cmd.CombinedOutput()
+			code := 0
+			var exit *exec.ExitError
+			if errors.As(err, &exit) {
+				code = exit.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(out); code != c.exit || got != c.want {
+				t.Errorf("red test exited with %d and printed\n%s\nwant %d and\n%s", code, got, c.exit, c.want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "report.xml")); (err == nil) != (c.code != "") {
+				t.Errorf("report.xml written is %v", err == nil)
+			}
+		})
+	}
+}
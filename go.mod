@@ -0,0 +1,3 @@
+module github.com/palmbyrosiadev/red-compiler
+
+go 1.19
@@ -0,0 +1,1013 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// What a source file can use, the keyword libraries it loads and the modules it imports by name
+type srcenv struct {
+	file     *srcfile
+	dirs     []string
+	keymods  map[string]keymod
+	modules  map[string]*srcfile
+	symbols  map[string]srcline
+	readfile func(path string) ([]byte, error)
+}
+
+// Find a file the way the interpreter would, trying each directory in turn
+func (e *srcenv) resolve(path string) (string, bool) {
+	if filepath.IsAbs(path) {
+		if _, err := e.readfile(path); err == nil {
+			return path, true
+		}
+		return path, false
+	}
+	for _, dir := range e.dirs {
+		for _, p := range []string{filepath.Join(dir, path), filepath.Join(dir, "vendor", path)} {
+			if _, err := e.readfile(p); err == nil {
+				return p, true
+			}
+		}
+	}
+	return path, false
+}
+
+// Gather what a file loads, dirs are searched for relative paths and the built-in folder
+func newsrcenv(f *srcfile, dirs []string, readfile func(path string) ([]byte, error)) *srcenv {
+	e := &srcenv{file: f, dirs: dirs, keymods: make(map[string]keymod), modules: make(map[string]*srcfile), symbols: make(map[string]srcline), readfile: readfile}
+	if p, ok := e.findbuiltin(); ok {
+		e.keyport(p, "", "")
+	}
+	for _, l := range f.lines {
+		if l.comment || len(l.words) < 2 || l.where != intop {
+			continue
+		}
+		switch l.words[0].text {
+		case "KEYPORT":
+			if p, ok := e.resolve(l.words[1].text); ok {
+				mode, target := "", ""
+				if len(l.words) == 4 {
+					mode, target = l.words[2].text, l.words[3].text
+				}
+				if msg := e.keyport(p, mode, target); msg != "" {
+					f.problem(l, 1, "%s", msg)
+				}
+			} else {
+				f.problem(l, 1, "cannot find keyword file %s", l.words[1].text)
+			}
+		case "IMPORT":
+			p, ok := e.resolve(l.words[1].text)
+			if !ok {
+				f.problem(l, 1, "cannot find module %s", l.words[1].text)
+				continue
+			}
+			bytes, _ := readfile(p)
+			m := parsesource(p, string(bytes))
+			if len(l.words) > 2 {
+				e.modules[l.words[2].text] = m
+			}
+			e.define(m)
+		}
+	}
+	e.define(f)
+
+	// Names given to variables, keyword cases may store into a variable named by an argument
+	for _, l := range f.lines {
+		if l.comment || len(l.words) == 0 {
+			continue
+		}
+		op := l.words[0].text
+		switch {
+		case (op == "STORE" || op == "SET" || op == "EXPORT" || op == "EXARR") && len(l.words) > 1:
+			if _, ok := e.symbols[l.words[1].text]; !ok {
+				e.symbols[l.words[1].text] = l
+			}
+		case len(l.words) > 1:
+			c, ok := e.keymods[op].cases[l.words[1].text]
+			if !ok {
+				continue
+			}
+			for i, p := range c.params {
+				if i+2 >= len(l.words) || !storesparam(c, p.name) {
+					continue
+				}
+				if v, ok := parseliteral(l.words[i+2].text); ok && v.dtype == 1 {
+					if _, ok := e.symbols[v.sval]; !ok {
+						e.symbols[v.sval] = l
+					}
+				}
+			}
+		}
+	}
+	return e
+}
+
+// Look for the built-in folder next to the file or in a folder above it
+func (e *srcenv) findbuiltin() (string, bool) {
+	for _, dir := range e.dirs {
+		for d := dir; ; d = filepath.Dir(d) {
+			p := filepath.Join(d, "built-in", "util.kr")
+			if _, err := e.readfile(p); err == nil {
+				return p, true
+			}
+			if filepath.Dir(d) == d {
+				break
+			}
+		}
+	}
+	return "", false
+}
+
+// Load a keyword library, returning why it failed
+func (e *srcenv) keyport(path string, mode string, target string) string {
+	bytes, err := e.readfile(path)
+	if err != nil {
+		return err.Error()
+	}
+	ip := New()
+	ip.keymods = e.keymods
+	return ip.catchprint(func() {
+		ip.registerkeymods(path, ip.loadkeymod(path, bytes), mode, target)
+	})
+}
+
+// Add the KEYWORD blocks of a file to the keyword libraries
+func (e *srcenv) define(f *srcfile) {
+	for name, b := range f.keywords {
+		parts := strings.SplitN(name, " ", 2)
+		k, ok := e.keymods[parts[0]]
+		if !ok {
+			k = keymod{cases: make(map[string]keycase), source: f.path}
+			e.keymods[parts[0]] = k
+		}
+		c := keycase{params: b.params, source: f.path + ":" + strconv.Itoa(b.line), file: f.path}
+		for n := b.line + 1; n < b.end; n++ {
+			c.code = append(c.code, strings.TrimSpace(f.lines[n-1].raw))
+			c.lines = append(c.lines, n)
+		}
+		k.cases[parts[1]] = c
+	}
+}
+
+// Whether a keyword case stores into the variable named by one of its parameters
+func storesparam(c keycase, name string) bool {
+	for _, code := range c.code {
+		fields := strings.Fields(code)
+		if len(fields) == 2 && fields[0] == "STORE" && fields[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Where a keyword case is defined
+func casepos(c keycase) (string, int) {
+	if i := strings.LastIndex(c.source, ":"); i >= 0 {
+		if n, err := strconv.Atoi(c.source[i+1:]); err == nil {
+			return c.source[:i], n
+		}
+	}
+	if len(c.lines) > 0 && c.lines[0] > 0 {
+		return c.file, c.lines[0]
+	}
+	return c.file, 1
+}
+
+var placenames = map[int]string{
+	intop:     "at the top level of a program",
+	infunc:    "inside a function or keyword case",
+	inmodule:  "at the top level of a module",
+	inmodfunc: "inside a module function",
+}
+
+// Find what is wrong with a source file
+func checksource(f *srcfile, e *srcenv) []problem {
+	if f.library && strings.HasPrefix(strings.TrimSpace(rawtext(f)), "{") {
+		ip := New()
+		msg := ip.catchprint(func() {
+			ip.loadkeymod(f.path, []byte(rawtext(f)))
+		})
+		if msg == "" {
+			return nil
+		}
+		line := 1
+		if m := regexp.MustCompile(": line (\\d+): ").FindStringSubmatch(msg); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		return []problem{{line: line, end: len(f.lines[line-1].raw), msg: msg}}
+	}
+	for _, l := range f.lines {
+		if l.comment || len(l.words) == 0 {
+			continue
+		}
+		switch l.words[0].text {
+		case "KEYWORD", "ENDKEYWORD", "ENDFUNC", "ENDTEST":
+			continue
+		}
+		e.checkline(l, l.words)
+	}
+	e.checkstack()
+	sort.SliceStable(f.problems, func(i, j int) bool { return f.problems[i].line < f.problems[j].line })
+	return f.problems
+}
+
+func rawtext(f *srcfile) string {
+	var lines []string
+	for _, l := range f.lines {
+		lines = append(lines, l.raw)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Check the keyword of a line and its arguments, words may be the end of an IF line
+func (e *srcenv) checkline(l srcline, words []srcword) {
+	f := e.file
+	fail := func(w srcword, warning bool, format string, a ...interface{}) {
+		f.problems = append(f.problems, problem{line: l.n, col: w.start, end: w.end, msg: fmt.Sprintf(format, a...), warning: warning})
+	}
+	op := words[0]
+	args := words[1:]
+	info, core := keywordinfos[op.text]
+	if !core {
+		k, ok := e.keymods[op.text]
+		if !ok {
+			fail(op, false, "unknown keyword %s", op.text)
+			return
+		}
+		if l.where == inmodule {
+			fail(op, false, "keyword library cases cannot be used %s", placenames[l.where])
+			return
+		}
+		if len(args) == 0 {
+			fail(op, false, "%s needs a case", op.text)
+			return
+		}
+		c, ok := k.cases[args[0].text]
+		if !ok {
+			fail(args[0], false, "%s has no case %s", op.text, args[0].text)
+			return
+		}
+		if c.params == nil {
+			return
+		}
+		given := args[1:]
+		if msg := argcount(op.text+" "+args[0].text, c.params, len(given)); msg != "" {
+			fail(op, false, "%s", msg)
+			return
+		}
+		for i, a := range given {
+			v, ok := parseliteral(a.text)
+			if !ok {
+				if l.block == "" || !e.isparam(l, a.text) {
+					fail(a, false, "invalid argument %s", a.text)
+				}
+				continue
+			}
+			if p := c.params[i]; p.dtype != -1 && v.dtype != p.dtype {
+				fail(a, false, "argument %s must be %s, got %s", p.name, typename(p.dtype), typename(v.dtype))
+			}
+		}
+		return
+	}
+	if l.where&info.where == 0 {
+		fail(op, false, "%s cannot be used %s", op.text, placenames[l.where])
+		return
+	}
+	if len(args) < info.min || (info.max >= 0 && len(args) > info.max) || (op.text == "KEYPORT" && len(args) == 2) {
+		fail(op, false, "wrong number of arguments, expected %s", info.usage)
+		return
+	}
+	if op.text == "KEYPORT" && len(args) == 3 && args[1].text != "AS" && args[1].text != "EXTEND" {
+		fail(args[1], false, "expected AS or EXTEND")
+	}
+	switch op.text {
+	case "PUSH":
+		if v := strings.Join(strings.Fields(l.raw[args[0].start:]), " "); len(args) > 1 && !strings.HasPrefix(v, "\"") && !strings.HasPrefix(v, "'") {
+			fail(args[1], false, "PUSH takes a single value, quote strings with spaces")
+		} else if _, ok := parseliteral(v); !ok {
+			fail(args[0], false, "invalid value %s, expected a number, a quoted string, true or false", v)
+		}
+	case "INPUT":
+		if len(args) > 0 {
+			if v, ok := parseliteral(strings.Join(strings.Fields(l.raw[args[0].start:]), " ")); !ok || v.dtype != 1 {
+				fail(args[0], false, "INPUT prompt must be a quoted string")
+			}
+		}
+	case "LOAD":
+		e.checksymbol(l, args[0], fail)
+		if len(args) > 1 {
+			if _, err := strconv.Atoi(args[1].text); err != nil {
+				e.checksymbol(l, args[1], fail)
+			}
+		}
+	case "RUN":
+		if _, ok := f.funcs[args[0].text]; !ok {
+			fail(args[0], false, "undefined function %s", args[0].text)
+		}
+		if len(args) > 1 {
+			e.checksymbol(l, args[1], fail)
+		}
+	case "IF":
+		e.checksymbol(l, args[0], fail)
+		e.checkline(l, args[1:])
+	case "LOADARG":
+		if b, ok := f.keywords[l.block]; ok && b.params != nil && !strings.HasPrefix(args[0].text, "term") && !e.isparam(l, args[0].text) {
+			fail(args[0], false, "%s has no parameter %s", l.block, args[0].text)
+		}
+	case "MODRUN", "MODGET", "MODSTORE":
+		m, ok := e.modules[args[0].text]
+		if !ok {
+			fail(args[0], false, "unknown module %s, IMPORT it first", args[0].text)
+			break
+		}
+		if op.text == "MODRUN" {
+			if _, ok := m.funcs[args[1].text]; !ok {
+				fail(args[1], false, "module %s has no function %s", args[0].text, args[1].text)
+			}
+		} else if op.text == "MODGET" && !exports(m, args[1].text) {
+			fail(args[1], true, "module %s does not export %s", args[0].text, args[1].text)
+		}
+	case "EXPORT":
+		if _, err := strconv.ParseFloat(args[1].text, 64); err != nil {
+			fail(args[1], false, "exports start as a number")
+		}
+	case "SET":
+		if args[1].text != "true" && args[1].text != "false" {
+			fail(args[1], false, "SET is used for boolean values only")
+		}
+	case "EXIT":
+		if len(args) > 0 {
+			if _, err := strconv.ParseFloat(args[0].text, 64); err != nil {
+				e.checksymbol(l, args[0], fail)
+			}
+		}
+	case "RANDINT", "RANDFLOAT", "SEED":
+		if len(args) == 1 && op.text != "SEED" {
+			fail(op, false, "wrong number of arguments, expected %s", info.usage)
+		}
+		for _, a := range args {
+			if _, err := strconv.ParseFloat(a.text, 64); err != nil && a.text != "SECURE" {
+				e.checksymbol(l, a, fail)
+			}
+		}
+	}
+}
+
+// Warn about a variable that nothing stores into
+func (e *srcenv) checksymbol(l srcline, w srcword, fail func(srcword, bool, string, ...interface{})) {
+	if w.text == "PI" || w.text == "EULER" || e.isparam(l, w.text) {
+		return
+	}
+	if _, ok := e.symbols[w.text]; !ok {
+		fail(w, true, "undefined variable %s, nothing stores into it", w.text)
+	}
+}
+
+// Whether a name is a parameter of the keyword case a line is in
+func (e *srcenv) isparam(l srcline, name string) bool {
+	b, ok := e.file.keywords[l.block]
+	if !ok {
+		return false
+	}
+	if b.params == nil {
+		return strings.HasPrefix(name, "term")
+	}
+	for _, p := range b.params {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a module exports a variable
+func exports(m *srcfile, name string) bool {
+	for _, l := range m.lines {
+		if !l.comment && len(l.words) > 1 && (l.words[0].text == "EXPORT" || l.words[0].text == "EXARR") && l.words[1].text == name {
+			return true
+		}
+	}
+	return false
+}
+
+// What a FUNC or keyword case takes from the stack and leaves on it, the deepest value first.
+// reset means it empties the stack before leaving out, lost that the checker could not follow
+// it, exits that it always ends the program and stores the types it stores into variables
+// named by its parameters
+type effect struct {
+	in     []int
+	out    []int
+	reset  bool
+	lost   bool
+	exits  bool
+	stores map[string]int
+}
+
+func (eff *effect) String() string {
+	switch {
+	case eff.lost:
+		return "unknown"
+	case eff.exits:
+		return "ends the program"
+	}
+	var in, out []string
+	for _, t := range eff.in {
+		in = append(in, typename(t))
+	}
+	for _, t := range eff.out {
+		out = append(out, typename(t))
+	}
+	text := strings.TrimSpace("( "+strings.Join(in, " ")) + " -- " + strings.TrimSpace(strings.Join(out, " ")+" )")
+	if eff.reset {
+		text += ", empties the stack first"
+	}
+	return text
+}
+
+// What the stack checker knows about the stack at a point of a program, items holds the types
+// on it with the top last. A function starts open, the values below items are then unknown and
+// the ones it takes from there are noted in taken, top first
+type absstack struct {
+	items []int
+	open  bool
+	taken []int
+	reset bool
+	lost  bool
+	dead  bool
+}
+
+func (s *absstack) clone() *absstack {
+	n := *s
+	n.items = append([]int(nil), s.items...)
+	n.taken = append([]int(nil), s.taken...)
+	return &n
+}
+
+func (s *absstack) push(t int) {
+	if !s.lost {
+		s.items = append(s.items, t)
+	}
+}
+
+// Join the stack after an IF with the stack had the IF not run
+func (s *absstack) merge(o *absstack) {
+	if o.dead {
+		return
+	}
+	if s.dead {
+		*s = *o
+		return
+	}
+	if s.lost || o.lost || len(s.items) != len(o.items) || len(s.taken) != len(o.taken) || s.reset != o.reset || s.open != o.open {
+		s.lost = true
+		return
+	}
+	for i := range s.items {
+		s.items[i] = jointype(s.items[i], o.items[i])
+	}
+	for i := range s.taken {
+		s.taken[i] = jointype(s.taken[i], o.taken[i])
+	}
+}
+
+func jointype(a int, b int) int {
+	if a == b {
+		return a
+	}
+	return -1
+}
+
+// Where the stack checker is, params are those of the keyword case being checked
+type stackctx struct {
+	params map[string]int
+	legacy bool
+	stores map[string]int
+	report bool
+}
+
+// Follows the stack through a file, vars holds the types stored into each variable
+type stackcheck struct {
+	e        *srcenv
+	file     *srcfile
+	vars     map[string]int
+	newvars  map[string]int
+	funcs    map[string]*effect
+	cases    map[string]*effect
+	modfuncs map[string]*effect
+	report   bool
+	seen     map[string]bool
+	line     srcline
+	at       srcword
+	ctx      *stackctx
+}
+
+func newstackcheck(e *srcenv, f *srcfile, vars map[string]int, report bool) *stackcheck {
+	return &stackcheck{e: e, file: f, vars: vars, newvars: varseed(f), funcs: make(map[string]*effect), cases: make(map[string]*effect), modfuncs: make(map[string]*effect), report: report, seen: make(map[string]bool)}
+}
+
+// The variables whose type is known before running anything
+func varseed(f *srcfile) map[string]int {
+	vars := map[string]int{"PI": 0, "EULER": 0}
+	for _, l := range f.lines {
+		if l.comment || len(l.words) < 2 {
+			continue
+		}
+		switch l.words[0].text {
+		case "EXPORT":
+			vars[l.words[1].text] = 0
+		case "EXARR":
+			vars[l.words[1].text] = 4
+		case "SET":
+			vars[l.words[1].text] = 2
+		}
+	}
+	return vars
+}
+
+// Follow the stack through a file and warn about values taken from an empty stack, values of
+// the wrong type and functions that change the size of the stack while they repeat. Variables
+// get the types stored into them, which needs a few rounds as stores may depend on loads.
+// Returns the effect of each function of the file
+func (e *srcenv) checkstack() map[string]*effect {
+	vars := varseed(e.file)
+	for round := 0; ; round++ {
+		c := newstackcheck(e, e.file, vars, false)
+		c.checkall()
+		same := len(c.newvars) == len(vars)
+		for name, t := range c.newvars {
+			if old, ok := vars[name]; !ok || old != t {
+				same = false
+			}
+		}
+		if same || round == 4 {
+			c = newstackcheck(e, e.file, vars, true)
+			c.checkall()
+			return c.funcs
+		}
+		vars = c.newvars
+	}
+}
+
+// Check the top level of the file and every function and keyword case in it
+func (c *stackcheck) checkall() {
+	top := &absstack{}
+	ctx := &stackctx{report: c.report}
+	for _, l := range c.file.lines {
+		if l.where == intop || l.where == inmodule {
+			c.exec(top, l, l.words, ctx)
+		}
+	}
+	for _, name := range sortedkeys(c.file.funcs) {
+		c.funceffect(name)
+	}
+	for _, name := range sortedkeys(c.file.keywords) {
+		parts := strings.SplitN(name, " ", 2)
+		c.caseeffect(parts[0], parts[1])
+	}
+}
+
+// Check the lines of a function or keyword case from a fresh stack
+func (c *stackcheck) body(lines []srcline, st *absstack, ctx *stackctx) *effect {
+	for _, l := range lines {
+		c.exec(st, l, l.words, ctx)
+	}
+	eff := &effect{out: st.items, reset: st.reset, lost: st.lost, exits: st.dead, stores: ctx.stores}
+	for i := len(st.taken) - 1; i >= 0; i-- {
+		eff.in = append(eff.in, st.taken[i])
+	}
+	return eff
+}
+
+// The effect of a function of the file, a function that runs itself is not followed
+func (c *stackcheck) funceffect(name string) *effect {
+	if eff, ok := c.funcs[name]; ok {
+		return eff
+	}
+	c.funcs[name] = &effect{lost: true}
+	b, ok := c.file.funcs[name]
+	if !ok || b.end == 0 {
+		return c.funcs[name]
+	}
+	saved, savedat, savedctx := c.line, c.at, c.ctx
+	eff := c.body(c.file.lines[b.line:b.end-1], &absstack{open: !c.file.module}, &stackctx{report: c.report})
+	c.line, c.at, c.ctx = saved, savedat, savedctx
+	c.funcs[name] = eff
+	return eff
+}
+
+// The effect of a keyword case, lines of cases from other files are not reported
+func (c *stackcheck) caseeffect(prefix string, name string) *effect {
+	key := prefix + " " + name
+	if eff, ok := c.cases[key]; ok {
+		return eff
+	}
+	c.cases[key] = &effect{lost: true}
+	kc, ok := c.e.keymods[prefix].cases[name]
+	if !ok {
+		return c.cases[key]
+	}
+	ctx := &stackctx{params: make(map[string]int), legacy: kc.params == nil, stores: make(map[string]int), report: c.report && kc.file == c.file.path}
+	for _, p := range kc.params {
+		ctx.params[p.name] = p.dtype
+	}
+	var lines []srcline
+	for i, code := range kc.code {
+		n := 0
+		if i < len(kc.lines) {
+			n = kc.lines[i]
+		}
+		if kc.file == c.file.path && n > 0 && n <= len(c.file.lines) {
+			lines = append(lines, c.file.lines[n-1])
+		} else {
+			lines = append(lines, srcline{n: n, raw: code, words: sourcewords(code)})
+		}
+	}
+	saved, savedat, savedctx := c.line, c.at, c.ctx
+	eff := c.body(lines, &absstack{open: true}, ctx)
+	c.line, c.at, c.ctx = saved, savedat, savedctx
+	c.cases[key] = eff
+	return eff
+}
+
+// The effect of a function of an imported module, module functions start with an empty stack
+func (c *stackcheck) modeffect(module string, name string) *effect {
+	key := module + " " + name
+	if eff, ok := c.modfuncs[key]; ok {
+		return eff
+	}
+	c.modfuncs[key] = &effect{lost: true}
+	if m, ok := c.e.modules[module]; ok {
+		c.modfuncs[key] = newstackcheck(c.e, m, varseed(m), false).funceffect(name)
+	}
+	return c.modfuncs[key]
+}
+
+func (c *stackcheck) warn(format string, a ...interface{}) {
+	if !c.ctx.report {
+		return
+	}
+	msg := fmt.Sprintf(format, a...)
+	key := fmt.Sprintf("%d:%d:%s", c.line.n, c.at.start, msg)
+	if c.seen[key] {
+		return
+	}
+	c.seen[key] = true
+	c.file.problems = append(c.file.problems, problem{line: c.line.n, col: c.at.start, end: c.at.end, msg: msg, warning: true})
+}
+
+func article(t int) string {
+	if t == 4 || t == -1 {
+		return "an " + typename(t)
+	}
+	return "a " + typename(t)
+}
+
+func values(n int) string {
+	if n == 1 {
+		return "1 value"
+	}
+	return strconv.Itoa(n) + " values"
+}
+
+// Take values from the stack, wants holds the types wanted with the top first. Returns the
+// types taken, any when the checker does not know or the stack ran out
+func (c *stackcheck) take(st *absstack, name string, wants ...int) []int {
+	if !st.open && !st.lost && len(st.items) < len(wants) {
+		c.warn("%s takes %s from the stack but it holds %d", name, values(len(wants)), len(st.items))
+	}
+	got := make([]int, len(wants))
+	for i, want := range wants {
+		t := -1
+		switch {
+		case st.lost:
+		case len(st.items) > 0:
+			t = st.items[len(st.items)-1]
+			st.items = st.items[:len(st.items)-1]
+		case st.open:
+			st.taken = append(st.taken, want)
+			t = want
+		}
+		if want != -1 && t != -1 && t != want {
+			c.warn("%s needs %s, got %s", name, article(want), article(t))
+		}
+		got[i] = t
+	}
+	return got
+}
+
+// Apply the effect of a function or keyword case to the stack
+func (c *stackcheck) apply(st *absstack, name string, eff *effect) {
+	if !eff.lost {
+		wants := make([]int, len(eff.in))
+		for i, t := range eff.in {
+			wants[len(eff.in)-1-i] = t
+		}
+		c.take(st, name, wants...)
+	}
+	switch {
+	case eff.exits:
+		st.dead = true
+	case eff.lost:
+		st.lost = true
+	case eff.reset:
+		st.items = append([]int(nil), eff.out...)
+		st.open, st.lost, st.reset = false, false, true
+	default:
+		for _, t := range eff.out {
+			st.push(t)
+		}
+	}
+}
+
+// Note the type stored into a variable, inside a keyword case a parameter names the variable
+func (c *stackcheck) store(name string, t int) {
+	if c.isparam(name) {
+		c.ctx.stores[name] = joinvar(c.ctx.stores, name, t)
+		return
+	}
+	c.newvars[name] = joinvar(c.newvars, name, t)
+}
+
+func joinvar(m map[string]int, name string, t int) int {
+	if old, ok := m[name]; ok {
+		return jointype(old, t)
+	}
+	return t
+}
+
+func (c *stackcheck) isparam(name string) bool {
+	if c.ctx.params == nil {
+		return false
+	}
+	if c.ctx.legacy {
+		return strings.HasPrefix(name, "term")
+	}
+	_, ok := c.ctx.params[name]
+	return ok
+}
+
+func (c *stackcheck) vartype(name string) int {
+	if c.isparam(name) {
+		return -1
+	}
+	if t, ok := c.vars[name]; ok {
+		return t
+	}
+	return -1
+}
+
+// Follow the stack through a line, words may be the end of an IF line
+func (c *stackcheck) exec(st *absstack, l srcline, words []srcword, ctx *stackctx) {
+	if st.dead || l.comment || len(words) == 0 {
+		return
+	}
+	c.line, c.at, c.ctx = l, words[0], ctx
+	op := words[0].text
+	args := words[1:]
+	if info, core := keywordinfos[op]; core && len(args) < info.min {
+		return
+	}
+	switch op {
+	case "PUSH":
+		if v, ok := parseliteral(strings.Join(strings.Fields(l.raw[args[0].start:]), " ")); ok {
+			st.push(v.dtype)
+		}
+	case "ADD", "SUB", "MULT", "DIV":
+		c.take(st, op, 0, 0)
+		st.push(0)
+	case "STORE":
+		c.store(args[0].text, c.take(st, op, -1)[0])
+	case "LOAD":
+		if len(args) > 1 {
+			st.push(-1)
+		} else {
+			st.push(c.vartype(args[0].text))
+		}
+	case "LOADARG":
+		if t, ok := ctx.params[args[0].text]; ok {
+			st.push(t)
+		} else {
+			st.push(-1)
+		}
+	case "PRINT", "MODSTORE":
+		c.take(st, op, -1)
+	case "STR":
+		c.take(st, op, -1)
+		st.push(1)
+	case "FLOAT":
+		if c.take(st, op, -1)[0] == 2 {
+			c.warn("FLOAT cannot turn a bool into a number")
+		}
+		st.push(0)
+	case "BOOL":
+		if c.take(st, op, -1)[0] == 0 {
+			c.warn("BOOL cannot turn a number into a bool")
+		}
+		st.push(2)
+	case "STRCAT":
+		c.take(st, op, 1, 1)
+		st.push(1)
+	case "EQ", "NEQ", "GT", "GTE", "LT", "LTE":
+		got := c.take(st, op, -1, -1)
+		if got[0] != -1 && got[1] != -1 && got[0] != got[1] {
+			c.warn("%s compares %s with %s", op, article(got[1]), article(got[0]))
+		} else if op != "EQ" && op != "NEQ" && (got[0] == 2 || got[1] == 2) {
+			c.warn("%s cannot compare bools", op)
+		}
+		st.push(2)
+	case "NOT":
+		c.take(st, op, 2)
+		st.push(2)
+	case "AND", "OR":
+		c.take(st, op, 2, 2)
+		st.push(2)
+	case "DELAYST":
+		c.take(st, op, 0)
+	case "SIN", "COS", "TAN", "ASIN", "ACOS", "ATAN", "SQRT", "LN", "LOG":
+		c.take(st, op, 0)
+		st.push(0)
+	case "RANDINT", "RANDFLOAT":
+		if len(args) == 0 {
+			c.take(st, op, 0, 0)
+		}
+		st.push(0)
+	case "RANDCHOICE":
+		c.take(st, op, 4)
+		st.push(-1)
+	case "SHUFFLE":
+		c.take(st, op, 4)
+		st.push(4)
+	case "SEED":
+		if len(args) == 0 {
+			c.take(st, op, 0)
+		}
+	case "INPUT", "READALL":
+		st.push(1)
+	case "EOF":
+		st.push(2)
+	case "EXIT":
+		st.dead = true
+	case "ARGS":
+		st.push(4)
+	case "ARGC":
+		st.push(0)
+	case "GETENV":
+		st.push(1)
+	case "SETENV":
+		c.take(st, op, 1)
+	case "CLEAR":
+		st.items, st.open, st.lost, st.reset = nil, false, false, true
+	case "MAKEARRAY":
+		st.items, st.open, st.lost, st.reset = []int{4}, false, false, true
+	case "SPLIT":
+		c.take(st, op, 1)
+		st.push(4)
+	case "JOIN":
+		c.take(st, op, 4)
+		st.push(1)
+	case "APPEND":
+		st.push(c.take(st, op, 4, -1)[1])
+	case "LEN":
+		st.push(c.take(st, op, 4)[0])
+		st.push(0)
+	case "REMOVE":
+		c.take(st, op, 0, 4)
+		st.push(4)
+	case "MODGET":
+		t := -1
+		if m, ok := c.e.modules[args[0].text]; ok {
+			if v, ok := varseed(m)[args[1].text]; ok {
+				t = v
+			}
+		}
+		st.push(t)
+	case "MODRUN":
+		// Module functions have a stack of their own
+		if len(args) > 2 {
+			eff := c.modeffect(args[0].text, args[1].text)
+			if grow := len(eff.out) - len(eff.in); !eff.lost && !eff.reset && !eff.exits && grow > 0 {
+				c.warn("function %s of module %s leaves %s on its stack, the stack grows each time it repeats", args[1].text, args[0].text, values(grow))
+			}
+			if eff.exits {
+				st.dead = true
+			}
+		} else if eff := c.modeffect(args[0].text, args[1].text); eff.exits {
+			st.dead = true
+		}
+	case "RUN":
+		name := "function " + args[0].text
+		eff := c.funceffect(args[0].text)
+		if len(args) < 2 {
+			c.apply(st, name, eff)
+			break
+		}
+		grow := len(eff.out) - len(eff.in)
+		if !eff.lost && !eff.reset && !eff.exits {
+			if grow > 0 {
+				c.warn("%s leaves %s more on the stack than it takes, the stack grows each time it repeats", name, values(grow))
+			} else if grow < 0 {
+				c.warn("%s takes %s more from the stack than it leaves, the stack shrinks each time it repeats", name, values(-grow))
+			}
+		}
+		// The condition may be false from the start
+		once := st.clone()
+		c.apply(once, name, eff)
+		if grow != 0 {
+			once.lost = true
+		}
+		c.line, c.at, c.ctx = l, words[0], ctx
+		st.merge(once)
+	case "IF":
+		if len(args) < 2 {
+			return
+		}
+		taken := st.clone()
+		c.exec(taken, l, args[1:], ctx)
+		st.merge(taken)
+	case "ASSERT":
+		c.take(st, op, 2)
+	case "ASSERTEQ":
+		if len(args) > 0 {
+			if v, ok := parseliteral(args[0].text); ok {
+				c.take(st, op, v.dtype)
+			}
+		} else {
+			c.take(st, op, -1, -1)
+		}
+	case "FUNC", "ENDFUNC", "KEYWORD", "ENDKEYWORD", "TEST", "ENDTEST", "KEYPORT", "IMPORT", "EXPORT", "EXARR", "SET", "ASSERTSTACK":
+	default:
+		if _, core := keywordinfos[op]; core {
+			return
+		}
+		if len(args) == 0 {
+			st.lost = true
+			return
+		}
+		kc, ok := c.e.keymods[op].cases[args[0].text]
+		if !ok {
+			st.lost = true
+			return
+		}
+		eff := c.caseeffect(op, args[0].text)
+		c.line, c.at, c.ctx = l, words[0], ctx
+		c.apply(st, op+" "+args[0].text, eff)
+		for p, t := range eff.stores {
+			i := -1
+			if n, err := strconv.Atoi(strings.TrimPrefix(p, "term")); err == nil && kc.params == nil {
+				i = n
+			}
+			for n, kp := range kc.params {
+				if kp.name == p {
+					i = n
+				}
+			}
+			if i < 0 || i+1 >= len(args) {
+				continue
+			}
+			if v, ok := parseliteral(args[i+1].text); ok && v.dtype == 1 {
+				c.store(v.sval, t)
+			}
+		}
+	}
+}
+
+// Check prints the problems the tools find in files to out, the stack checker's among them.
+// Returns false when there are any
+func Check(out io.Writer, paths []string) bool {
+	files, ok := sourcefiles(out, paths)
+	cwd, _ := os.Getwd()
+	for _, path := range files {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			ok = false
+			continue
+		}
+		f := parsesource(path, string(bytes))
+		for _, p := range checksource(f, newsrcenv(f, []string{filepath.Dir(path), cwd}, ioutil.ReadFile)) {
+			kind := "error"
+			if p.warning {
+				kind = "warning"
+			}
+			fmt.Fprintf(out, "%s:%d:%d: %s: %s\n", path, p.line, p.col+1, kind, p.msg)
+			ok = false
+		}
+	}
+	return ok
+}
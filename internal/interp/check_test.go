@@ -0,0 +1,73 @@
+package interp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Write files into a temporary folder and run tool on one of them, returning whether it passed
+// and what it printed with the folder left out of the paths
+func runtool(t *testing.T, tool func(out *strings.Builder, paths []string) bool, files map[string]string, name string) (bool, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for file, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out strings.Builder
+	ok := tool(&out, []string{filepath.Join(dir, name)})
+	return ok, strings.ReplaceAll(out.String(), dir+string(filepath.Separator), "")
+}
+
+func check(out *strings.Builder, paths []string) bool { return Check(out, paths) }
+
+func TestCheck(t *testing.T) {
+	lib := "KEYWORD LIB SET name:string value\n\tLOADARG value\n\tSTORE name\nENDKEYWORD\n"
+	for _, c := range []struct{ name, code, want string }{
+		{"underflow", "PUSH 1\nPRINT\nPRINT", "underflow.red:3:1: warning: PRINT takes 1 value from the stack but it holds 0\n"},
+		{"grows", "PUSH true\nSTORE c\nFUNC f\n\tPUSH 1\nENDFUNC\nRUN f c", "grows.red:6:1: warning: function f leaves 1 value more on the stack than it takes, the stack grows each time it repeats\n"},
+		{"shrinks", "PUSH true\nSTORE c\nFUNC f\n\tPRINT\nENDFUNC\nPUSH 1\nRUN f c", "shrinks.red:7:1: warning: function f takes 1 value more from the stack than it leaves, the stack shrinks each time it repeats\n"},
+		{"types", "PUSH \"a\"\nPUSH 1\nADD", "types.red:3:1: warning: ADD needs a number, got a string\n"},
+		{"function", "FUNC f\nENDFUNC\nRUN f\nRUN g", "function.red:4:5: error: undefined function g\n"},
+		{"keyword", "KEYPORT lib.kr\nFROB 1\nLIB GET", "keyword.red:2:1: error: unknown keyword FROB\nkeyword.red:3:5: error: LIB has no case GET\n"},
+		{"keywordargs", "KEYPORT lib.kr\nLIB SET \"x\"\nLIB SET \"x\" 1 2", "keywordargs.red:2:1: error: LIB SET expects 2 arguments (name:string, value:any), got 1\nkeywordargs.red:3:1: error: LIB SET expects 2 arguments (name:string, value:any), got 3\n"},
+		{"coreargs", "PUSH\nLOAD", "coreargs.red:1:1: error: wrong number of arguments, expected PUSH value\ncoreargs.red:2:1: error: wrong number of arguments, expected LOAD name [index]\n"},
+		{"clean", "KEYPORT lib.kr\nPUSH 2\nSTORE n\nFUNC double\n\tLOAD n\n\tPUSH 2\n\tMULT\n\tSTORE n\nENDFUNC\nRUN double\nLIB SET \"y\" 5\nLOAD n\nPRINT", ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ok, got := runtool(t, check, map[string]string{"lib.kr": lib, c.name + ".red": c.code}, c.name+".red")
+			if got != c.want {
+				t.Errorf("printed\n%s\nwant\n%s", got, c.want)
+			}
+			if ok != (c.want == "") {
+				t.Errorf("check returned %v", ok)
+			}
+		})
+	}
+}
+
+// The checker and the interpreter report a keyword case called with the wrong number of
+// arguments the same way, each after its own kind of position
+func TestCheckArgumentCount(t *testing.T) {
+	lib := "KEYWORD LIB SET name:string value\n\tLOADARG value\n\tSTORE name\nENDKEYWORD"
+	code := "KEYPORT lib.kr\nLIB SET \"x\""
+	_, checked := runtool(t, check, map[string]string{"lib.kr": lib, "main.red": code}, "main.red")
+
+	ip, _ := newtestinterpreter()
+	ip.SetFiles(map[string][]byte{"lib.kr": []byte(lib)})
+	ip.Load("main.red", code)
+	err := ip.Run()
+	if err == nil {
+		t.Fatal("the program ran")
+	}
+	msg := strings.TrimPrefix(err.Error(), "main.red:2: ")
+	if msg == err.Error() {
+		t.Errorf("the error %q does not start with where the call is", err)
+	}
+	if want := "main.red:2:1: error: " + msg + "\n"; checked != want {
+		t.Errorf("check printed %q, want %q", checked, want)
+	}
+}
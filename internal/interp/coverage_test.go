@@ -0,0 +1,58 @@
+package interp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Definitions, comments, the top level of a module and the built-in library are left out of the
+// report, never is the only line that did not run
+func TestCoverageLCOV(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.red")
+	module := filepath.Join(dir, "m.mred")
+	os.WriteFile(module, []byte("EXPORT a 1\nFUNC f\n\tPUSH 3\nENDFUNC\n"), 0644)
+	os.WriteFile(main, []byte("// twice runs twice and never does not run\nFUNC twice\n\tPUSH 1\nENDFUNC\nFUNC never\n\tPUSH 2\nENDFUNC\nRUN twice\nRUN twice\nIMPORT "+module+" m\nMODRUN m f\nPUSH true\nSTORE c\nIF c PRINT\n"), 0644)
+
+	ip, out := newtestinterpreter()
+	var summary strings.Builder
+	ip.SetReportOutput(&summary)
+	ip.Coverage(filepath.Join(dir, "coverage"))
+	root, _ := filepath.Abs("../..")
+	ip.SetIncludePaths(root)
+	if err := ip.LoadBuiltins(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ip.LoadFile(main); err != nil {
+		t.Fatal(err)
+	}
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ip.ReportCoverage()
+
+	data, err := os.ReadFile(filepath.Join(dir, "coverage.lcov"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "TN:\nSF:" + module + "\nDA:3,1\nLF:1\nLH:1\nend_of_record\n" +
+		"TN:\nSF:" + main + "\nDA:3,2\nDA:6,0\nDA:8,1\nDA:9,1\nDA:10,1\nDA:11,1\nDA:12,1\nDA:13,1\nDA:14,1\nLF:9\nLH:8\nend_of_record\n"
+	if string(data) != want {
+		t.Errorf("coverage.lcov is\n%s\nwant\n%s", data, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "coverage.html")); err != nil {
+		t.Error(err)
+	}
+	if out.String() != "1\n" {
+		t.Errorf("the program printed %q", out.String())
+	}
+	// The columns are as wide as the full paths, so the spacing depends on the temporary folder
+	got := strings.ReplaceAll(summary.String(), dir+string(filepath.Separator), "")
+	got = strings.Join(strings.Fields(got), " ")
+	want = "Coverage: m.mred 1/1 lines 100.0% main.red 8/9 lines 88.9% total 9/10 lines 90.0% Wrote coverage.lcov and coverage.html"
+	if got != want {
+		t.Errorf("printed\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,564 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A Debug Adapter Protocol session. The program runs on its own goroutine and blocks in
+// stopped while it is stopped, the session goroutine answers requests meanwhile. RED runs
+// a single thread, FUNC, MODRUN and keyword case calls are its stack frames
+type dapsession struct {
+	ip    *Interpreter
+	debug *debugger
+	out   io.Writer
+	lock  sync.Mutex
+
+	// Held by the program while it runs, it lets go of it between lines and while it is
+	// stopped so requests can look at and change its state
+	prog sync.Mutex
+
+	seq     int
+	program string
+	entry   bool
+	started bool
+	done    chan bool
+	resume  chan bool
+	state   sync.Mutex
+	waiting bool
+	pause   int32
+	quit    int32
+	handles []dapcontainer
+}
+
+// Turns what the program prints into output events
+type dapoutput struct {
+	d *dapsession
+}
+
+func (o dapoutput) Write(p []byte) (int, error) {
+	o.d.event("output", map[string]interface{}{"category": "stdout", "output": string(p)})
+	return len(p), nil
+}
+
+// Something whose variables can be listed and changed, a symbol table, a stack or an array
+type dapcontainer struct {
+	vars   map[string]stackVal
+	mirror map[string]stackVal
+	list   *[]stackVal
+	top    bool
+	nested map[string]int
+}
+
+// Serve one debug adapter client until it disconnects
+func dapserve(in io.Reader, out io.Writer) {
+	d := &dapsession{ip: New(), out: out, done: make(chan bool), resume: make(chan bool)}
+	d.debug = &debugger{ip: d.ip}
+	d.ip.SetInput(strings.NewReader(""))
+	d.ip.SetOutput(dapoutput{d})
+	reader := bufio.NewReader(in)
+	for {
+		msg, err := readmessage(reader)
+		if err != nil {
+			break
+		}
+		if msg["type"] != "request" {
+			continue
+		}
+		if !d.handle(msg) {
+			break
+		}
+	}
+	d.stop()
+}
+
+// ServeDAP serves the Debug Adapter Protocol on stdin and stdout, or to one client connecting to
+// a TCP address
+func ServeDAP(addr string) error {
+	if addr == "" {
+		dapserve(os.Stdin, os.Stdout)
+		return nil
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Debug adapter listening on", l.Addr())
+	conn, err := l.Accept()
+	l.Close()
+	if err != nil {
+		return err
+	}
+	dapserve(conn, conn)
+	return conn.Close()
+}
+
+// Read a debug adapter or language server message, a JSON object after a Content-Length header
+func readmessage(r *bufio.Reader) (map[string]interface{}, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(line), "content-length:") {
+			length, err = strconv.Atoi(strings.TrimSpace(line[len("content-length:"):]))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	var msg map[string]interface{}
+	err := json.Unmarshal(body, &msg)
+	return msg, err
+}
+
+func (d *dapsession) send(msg map[string]interface{}) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.seq++
+	msg["seq"] = d.seq
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(d.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (d *dapsession) event(name string, body map[string]interface{}) {
+	msg := map[string]interface{}{"type": "event", "event": name}
+	if body != nil {
+		msg["body"] = body
+	}
+	d.send(msg)
+}
+
+func (d *dapsession) respond(req map[string]interface{}, body map[string]interface{}, fail string) {
+	msg := map[string]interface{}{"type": "response", "request_seq": req["seq"], "command": req["command"], "success": fail == ""}
+	if fail != "" {
+		msg["message"] = fail
+	}
+	if body != nil {
+		msg["body"] = body
+	}
+	d.send(msg)
+}
+
+func dapstr(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func dapint(m map[string]interface{}, key string) int {
+	f, _ := m[key].(float64)
+	return int(f)
+}
+
+func daplist(m map[string]interface{}, key string) []map[string]interface{} {
+	var res []map[string]interface{}
+	list, _ := m[key].([]interface{})
+	for _, v := range list {
+		if o, ok := v.(map[string]interface{}); ok {
+			res = append(res, o)
+		}
+	}
+	return res
+}
+
+// Answer a request, returns false when the client has disconnected
+func (d *dapsession) handle(req map[string]interface{}) bool {
+	args, _ := req["arguments"].(map[string]interface{})
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	switch dapstr(req, "command") {
+	case "pause", "disconnect", "terminate":
+	default:
+		d.prog.Lock()
+		defer d.prog.Unlock()
+	}
+	switch dapstr(req, "command") {
+	case "initialize":
+		d.respond(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsSetVariable":              true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, "")
+		d.event("initialized", nil)
+	case "launch":
+		d.program = dapstr(args, "program")
+		d.entry, _ = args["stopOnEntry"].(bool)
+		// A relative program and the files it loads are found in cwd, the adapter does not
+		// change its own working directory
+		if cwd := dapstr(args, "cwd"); cwd != "" {
+			if d.program != "" && !filepath.IsAbs(d.program) {
+				d.program = filepath.Join(cwd, d.program)
+			}
+			d.ip.include = append(d.ip.include, cwd)
+		}
+		if _, err := os.Stat(d.program); d.program == "" || err != nil {
+			d.respond(req, nil, "Cannot launch "+d.program+": the program must be an existing .red file")
+			return true
+		}
+		d.respond(req, nil, "")
+	case "setBreakpoints":
+		source, _ := args["source"].(map[string]interface{})
+		path := dapstr(source, "path")
+		kept := []breakpoint{}
+		for _, b := range d.debug.breakpoints {
+			if b.name != "" || !samefile(b.file, path) {
+				kept = append(kept, b)
+			}
+		}
+		var set []interface{}
+		for _, b := range daplist(args, "breakpoints") {
+			kept = append(kept, breakpoint{file: path, line: dapint(b, "line")})
+			set = append(set, map[string]interface{}{"verified": true, "line": dapint(b, "line")})
+		}
+		d.debug.breakpoints = kept
+		d.respond(req, map[string]interface{}{"breakpoints": dapnonnil(set)}, "")
+	case "setFunctionBreakpoints":
+		kept := []breakpoint{}
+		for _, b := range d.debug.breakpoints {
+			if b.name == "" {
+				kept = append(kept, b)
+			}
+		}
+		var set []interface{}
+		for _, b := range daplist(args, "breakpoints") {
+			kept = append(kept, breakpoint{name: dapstr(b, "name")})
+			set = append(set, map[string]interface{}{"verified": true})
+		}
+		d.debug.breakpoints = kept
+		d.respond(req, map[string]interface{}{"breakpoints": dapnonnil(set)}, "")
+	case "setExceptionBreakpoints":
+		d.respond(req, map[string]interface{}{"breakpoints": []interface{}{}}, "")
+	case "configurationDone":
+		d.respond(req, nil, "")
+		d.start()
+	case "threads":
+		d.respond(req, map[string]interface{}{"threads": []interface{}{map[string]interface{}{"id": 1, "name": "main"}}}, "")
+	case "stackTrace":
+		var list []interface{}
+		for i := len(d.ip.frames) - 1; i >= 0; i-- {
+			f := d.ip.frames[i]
+			path, _ := filepath.Abs(d.ip.resolvepath(f.file, ""))
+			list = append(list, map[string]interface{}{
+				"id":     i + 1,
+				"name":   f.name,
+				"line":   f.line,
+				"column": 1,
+				"source": map[string]interface{}{"name": filepath.Base(f.file), "path": path},
+			})
+		}
+		d.respond(req, map[string]interface{}{"stackFrames": dapnonnil(list), "totalFrames": len(list)}, "")
+	case "scopes":
+		n := dapint(args, "frameId") - 1
+		if n < 0 || n >= len(d.ip.frames) {
+			d.respond(req, nil, "Unknown frame")
+			return true
+		}
+		d.respond(req, map[string]interface{}{"scopes": d.scopes(d.ip.frames[n])}, "")
+	case "variables":
+		c, ok := d.container(dapint(args, "variablesReference"))
+		if !ok {
+			d.respond(req, nil, "Unknown variables reference")
+			return true
+		}
+		d.respond(req, map[string]interface{}{"variables": d.variables(c)}, "")
+	case "setVariable":
+		c, ok := d.container(dapint(args, "variablesReference"))
+		if !ok {
+			d.respond(req, nil, "Unknown variables reference")
+			return true
+		}
+		v, ok := parseliteral(dapstr(args, "value"))
+		if !ok {
+			d.respond(req, nil, "Invalid value "+dapstr(args, "value")+", expected a number, string or bool")
+			return true
+		}
+		if err := c.set(dapstr(args, "name"), v); err != "" {
+			d.respond(req, nil, err)
+			return true
+		}
+		d.respond(req, map[string]interface{}{"value": showval(v), "type": typename(v.dtype)}, "")
+	case "evaluate":
+		name := strings.TrimSpace(dapstr(args, "expression"))
+		n := dapint(args, "frameId") - 1
+		if n < 0 || n >= len(d.ip.frames) {
+			n = len(d.ip.frames) - 1
+		}
+		for _, scope := range d.ip.debugframescopes(d.ip.frames[n]) {
+			if v, ok := scope.vars[name]; ok {
+				d.respond(req, map[string]interface{}{"result": showval(v), "type": typename(v.dtype), "variablesReference": d.valueref(v)}, "")
+				return true
+			}
+		}
+		d.respond(req, nil, "No variable "+name)
+	case "continue":
+		d.debug.mode = debugcontinue
+		d.respond(req, map[string]interface{}{"allThreadsContinued": true}, "")
+		d.cont()
+	case "next":
+		d.debug.mode = debugnext
+		d.debug.depth = len(d.ip.frames)
+		d.respond(req, nil, "")
+		d.cont()
+	case "stepIn":
+		d.debug.mode = debugstep
+		d.respond(req, nil, "")
+		d.cont()
+	case "stepOut":
+		d.debug.mode = debugout
+		d.debug.depth = len(d.ip.frames)
+		d.respond(req, nil, "")
+		d.cont()
+	case "pause":
+		atomic.StoreInt32(&d.pause, 1)
+		d.respond(req, nil, "")
+	case "disconnect", "terminate":
+		d.respond(req, nil, "")
+		return false
+	default:
+		d.respond(req, nil, "Unsupported request "+dapstr(req, "command"))
+	}
+	return true
+}
+
+// JSON arrays in responses must not be null
+func dapnonnil(list []interface{}) []interface{} {
+	if list == nil {
+		return []interface{}{}
+	}
+	return list
+}
+
+// Run the launched program, sending what it prints as output events
+func (d *dapsession) start() {
+	if d.started || d.program == "" {
+		return
+	}
+	d.started = true
+	bytes, err := ioutil.ReadFile(d.program)
+	if err != nil {
+		d.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+		d.event("terminated", nil)
+		return
+	}
+
+	d.debug.mode = debugcontinue
+	if d.entry {
+		d.debug.mode = debugstep
+	}
+	d.ip.hook = d.stopped
+	go func() {
+		d.prog.Lock()
+		code := 0
+		defer func() {
+			if r := recover(); r != nil {
+				if e, ok := r.(replerror); ok {
+					code = e.code
+				} else {
+					fmt.Fprintln(d.ip.stdout, panicmessage(r))
+					code = 1
+				}
+			}
+			d.ip.hook = nil
+			d.prog.Unlock()
+			d.event("exited", map[string]interface{}{"exitCode": code})
+			d.event("terminated", nil)
+			close(d.done)
+		}()
+		d.ip.initstate()
+		d.ip.defimports()
+		d.ip.runlines(d.program, strings.Split(string(bytes), "\n"))
+	}()
+}
+
+// Called by the program before each line, blocks while the program is stopped
+func (d *dapsession) stopped(file string, line int, code string) {
+	if atomic.LoadInt32(&d.quit) == 1 {
+		panic(replerror{code: 0})
+	}
+	// Let requests that came in while the last line ran look at the program
+	d.prog.Unlock()
+	d.prog.Lock()
+	stop, hit := d.debug.check(file, line)
+	reason := "step"
+	if hit >= 0 {
+		reason = "breakpoint"
+	} else if atomic.SwapInt32(&d.pause, 0) == 1 {
+		stop, reason = true, "pause"
+	} else if d.entry {
+		reason = "entry"
+	}
+	d.entry = false
+	if !stop {
+		return
+	}
+	d.state.Lock()
+	d.waiting = true
+	d.state.Unlock()
+	d.prog.Unlock()
+	d.event("stopped", map[string]interface{}{"reason": reason, "threadId": 1, "allThreadsStopped": true})
+	<-d.resume
+	d.prog.Lock()
+	if atomic.LoadInt32(&d.quit) == 1 {
+		panic(replerror{code: 0})
+	}
+}
+
+// Let a stopped program go on, a running one is left alone
+func (d *dapsession) cont() {
+	d.state.Lock()
+	waiting := d.waiting
+	d.waiting = false
+	d.state.Unlock()
+	if waiting {
+		d.handles = nil
+		d.resume <- true
+	}
+}
+
+// End the program if it is still running and wait for it to finish
+func (d *dapsession) stop() {
+	if !d.started {
+		return
+	}
+	atomic.StoreInt32(&d.quit, 1)
+	d.cont()
+	<-d.done
+}
+
+func (d *dapsession) scopes(f frame) []interface{} {
+	var list []interface{}
+	add := func(name string, c dapcontainer) {
+		list = append(list, map[string]interface{}{"name": name, "variablesReference": d.register(c), "expensive": false})
+	}
+	if len(f.args) > 0 {
+		add("Arguments", dapcontainer{vars: f.args})
+	}
+	if f.inmod {
+		add("Stack", dapcontainer{list: &d.ip.tempstack, top: true})
+		add("Module "+d.ip.modname, dapcontainer{vars: d.ip.module.symbols})
+	} else {
+		add("Stack", dapcontainer{list: &d.ip.stack, top: true})
+	}
+	add("Globals", dapcontainer{vars: d.ip.symbols})
+	exports := dapcontainer{nested: make(map[string]int)}
+	for name, m := range d.ip.modules {
+		exports.nested[name] = d.register(dapcontainer{vars: m.extvars, mirror: m.symbols})
+	}
+	add("Modules", exports)
+	return list
+}
+
+// Hand out a variables reference, references last until the program moves on
+func (d *dapsession) register(c dapcontainer) int {
+	d.handles = append(d.handles, c)
+	return len(d.handles)
+}
+
+func (d *dapsession) container(ref int) (dapcontainer, bool) {
+	if ref < 1 || ref > len(d.handles) {
+		return dapcontainer{}, false
+	}
+	return d.handles[ref-1], true
+}
+
+// Arrays can be expanded, other values have no children
+func (d *dapsession) valueref(v stackVal) int {
+	if v.dtype != 4 {
+		return 0
+	}
+	list := v.list
+	return d.register(dapcontainer{list: &list})
+}
+
+func (d *dapsession) variables(c dapcontainer) []interface{} {
+	list := []interface{}{}
+	add := func(name string, v stackVal) {
+		list = append(list, map[string]interface{}{"name": name, "value": showval(v), "type": typename(v.dtype), "variablesReference": d.valueref(v)})
+	}
+	switch {
+	case c.nested != nil:
+		names := make([]string, 0, len(c.nested))
+		for name := range c.nested {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			list = append(list, map[string]interface{}{"name": name, "value": "module", "variablesReference": c.nested[name]})
+		}
+	case c.list != nil:
+		for i := range *c.list {
+			if c.top {
+				add(strconv.Itoa(i), (*c.list)[len(*c.list)-1-i])
+			} else {
+				add(strconv.Itoa(i), (*c.list)[i])
+			}
+		}
+	default:
+		names := make([]string, 0, len(c.vars))
+		for name := range c.vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(name, c.vars[name])
+		}
+	}
+	return list
+}
+
+// Change a variable, stack entries are named by their distance from the top
+func (c dapcontainer) set(name string, v stackVal) string {
+	switch {
+	case c.nested != nil:
+		return "Modules cannot be replaced, change their exports instead"
+	case c.list != nil:
+		n, err := strconv.Atoi(name)
+		if err != nil || n < 0 || n >= len(*c.list) {
+			return "No stack position " + name
+		}
+		if c.top {
+			n = len(*c.list) - 1 - n
+		}
+		(*c.list)[n] = v
+	default:
+		c.vars[name] = v
+		if c.mirror != nil {
+			c.mirror[name] = v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,377 @@
+package interp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A scripted debug adapter client talking to dapserve over pipes
+type dapclient struct {
+	t      *testing.T
+	w      io.WriteCloser
+	seq    int
+	msgs   chan map[string]interface{}
+	events []map[string]interface{}
+	output string
+	served chan bool
+	util   string
+}
+
+func newdapclient(t *testing.T) *dapclient {
+	cr, cw := io.Pipe()
+	sr, sw := io.Pipe()
+	c := &dapclient{t: t, w: cw, msgs: make(chan map[string]interface{}, 100), served: make(chan bool)}
+	go func() {
+		dapserve(cr, sw)
+		sw.Close()
+		close(c.served)
+	}()
+	go func() {
+		r := bufio.NewReader(sr)
+		for {
+			msg, err := readmessage(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			c.msgs <- msg
+		}
+	}()
+	util, err := os.ReadFile("../../built-in/util.kr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.util = string(util)
+	t.Cleanup(func() {
+		c.w.Close()
+		<-c.served
+	})
+	return c
+}
+
+func (c *dapclient) next() map[string]interface{} {
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			c.t.Fatal("debug adapter closed the connection")
+		}
+		if msg["event"] == "output" {
+			body := msg["body"].(map[string]interface{})
+			c.output += body["output"].(string)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the debug adapter")
+	}
+	return nil
+}
+
+// Send a request and return the body of its response, failing the test when it was not successful
+func (c *dapclient) request(command string, args map[string]interface{}) map[string]interface{} {
+	c.t.Helper()
+	msg := c.call(command, args)
+	if msg["success"] != true {
+		c.t.Fatalf("%s failed: %v", command, msg["message"])
+	}
+	body, _ := msg["body"].(map[string]interface{})
+	return body
+}
+
+// Send a request and return its whole response
+func (c *dapclient) call(command string, args map[string]interface{}) map[string]interface{} {
+	c.t.Helper()
+	c.seq++
+	body, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	for {
+		msg := c.next()
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if int(msg["request_seq"].(float64)) == c.seq {
+			return msg
+		}
+	}
+}
+
+// Wait for an event and return its body
+func (c *dapclient) event(name string) map[string]interface{} {
+	c.t.Helper()
+	for i, msg := range c.events {
+		if msg["event"] == name {
+			c.events = append(c.events[:i], c.events[i+1:]...)
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+	for {
+		msg := c.next()
+		if msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+		}
+	}
+}
+
+// Wait for the program to stop and return the names and lines of its frames
+func (c *dapclient) stopped(reason string) []string {
+	c.t.Helper()
+	body := c.event("stopped")
+	if body["reason"] != reason {
+		c.t.Fatalf("stopped because of %v, want %s", body["reason"], reason)
+	}
+	return c.frames()
+}
+
+func (c *dapclient) frames() []string {
+	c.t.Helper()
+	var res []string
+	for _, f := range c.request("stackTrace", map[string]interface{}{"threadId": 1})["stackFrames"].([]interface{}) {
+		frame := f.(map[string]interface{})
+		source := frame["source"].(map[string]interface{})
+		res = append(res, fmt.Sprintf("%s %s:%v", frame["name"], source["name"], frame["line"]))
+	}
+	return res
+}
+
+// The variables of a scope of the innermost frame as name=value pairs
+func (c *dapclient) scope(name string) map[string]string {
+	c.t.Helper()
+	ref := c.scoperef(name)
+	res := make(map[string]string)
+	for _, v := range c.request("variables", map[string]interface{}{"variablesReference": ref})["variables"].([]interface{}) {
+		variable := v.(map[string]interface{})
+		res[variable["name"].(string)] = variable["value"].(string)
+	}
+	return res
+}
+
+func (c *dapclient) scoperef(name string) float64 {
+	c.t.Helper()
+	frames := c.request("stackTrace", map[string]interface{}{"threadId": 1})["stackFrames"].([]interface{})
+	id := frames[0].(map[string]interface{})["id"]
+	for _, s := range c.request("scopes", map[string]interface{}{"frameId": id})["scopes"].([]interface{}) {
+		scope := s.(map[string]interface{})
+		if scope["name"] == name {
+			return scope["variablesReference"].(float64)
+		}
+	}
+	c.t.Fatalf("no scope %s", name)
+	return 0
+}
+
+// Start a program in a fresh directory holding files, stopping at the breakpoints. The program
+// is given relative to cwd, the folder the test runs in stays the same
+func (c *dapclient) launch(files map[string]string, entry bool, lines map[string][]int, names []string) {
+	c.t.Helper()
+	dir := c.t.TempDir()
+	os.Mkdir(filepath.Join(dir, "built-in"), 0755)
+	files["built-in/util.kr"] = c.util
+	for name, code := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(code), 0644); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	c.request("initialize", map[string]interface{}{"adapterID": "red"})
+	c.event("initialized")
+	c.request("launch", map[string]interface{}{"program": "main.red", "cwd": dir, "stopOnEntry": entry})
+	for file, list := range lines {
+		var bps []interface{}
+		for _, l := range list {
+			bps = append(bps, map[string]interface{}{"line": l})
+		}
+		body := c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": filepath.Join(dir, file)}, "breakpoints": bps})
+		if len(body["breakpoints"].([]interface{})) != len(list) {
+			c.t.Fatalf("setBreakpoints answered %v", body)
+		}
+	}
+	if names != nil {
+		var bps []interface{}
+		for _, n := range names {
+			bps = append(bps, map[string]interface{}{"name": n})
+		}
+		c.request("setFunctionBreakpoints", map[string]interface{}{"breakpoints": bps})
+	}
+	c.request("configurationDone", nil)
+}
+
+func expectframes(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, " | ") != strings.Join(want, " | ") {
+		t.Fatalf("frames are %q, want %q", got, want)
+	}
+}
+
+const dapprogram = `FUNC double
+LOAD x
+PUSH 2
+MULT
+STORE x
+ENDFUNC
+
+KEYWORD SAY TWICE text:string
+LOADARG text
+PRINT
+LOADARG text
+PRINT
+ENDKEYWORD
+
+PUSH 5
+STORE x
+RUN double
+SAY TWICE "hi"
+LOAD x
+PRINT
+`
+
+func TestDAPBreakpointAndVariables(t *testing.T) {
+	c := newdapclient(t)
+	c.launch(map[string]string{"main.red": dapprogram}, false, map[string][]int{"main.red": {3}}, nil)
+
+	expectframes(t, c.stopped("breakpoint"), "double main.red:3", "main main.red:17")
+	if got := c.scope("Stack"); got["0"] != "5" || len(got) != 1 {
+		t.Fatalf("stack is %v", got)
+	}
+	if got := c.scope("Globals"); got["x"] != "5" {
+		t.Fatalf("globals are %v", got)
+	}
+
+	// Changing x and the stack changes what the program computes
+	c.request("setVariable", map[string]interface{}{"variablesReference": c.scoperef("Globals"), "name": "x", "value": "7"})
+	c.request("setVariable", map[string]interface{}{"variablesReference": c.scoperef("Stack"), "name": "0", "value": "10"})
+	if got := c.request("evaluate", map[string]interface{}{"expression": "x"}); got["result"] != "7" {
+		t.Fatalf("evaluate x gave %v", got)
+	}
+	c.request("continue", map[string]interface{}{"threadId": 1})
+
+	if code := c.event("exited")["exitCode"]; code != 0.0 {
+		t.Fatalf("exit code %v", code)
+	}
+	c.event("terminated")
+	if c.output != "hi\nhi\n20\n" {
+		t.Fatalf("program printed %q", c.output)
+	}
+}
+
+func TestDAPStepping(t *testing.T) {
+	c := newdapclient(t)
+	c.launch(map[string]string{"main.red": dapprogram}, true, nil, nil)
+
+	expectframes(t, c.stopped("entry"), "main main.red:1")
+	c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": "main.red"}, "breakpoints": []interface{}{map[string]interface{}{"line": 17}}})
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	expectframes(t, c.stopped("breakpoint"), "main main.red:17")
+
+	// Step into the function, out of it and over the keyword case
+	c.request("stepIn", map[string]interface{}{"threadId": 1})
+	expectframes(t, c.stopped("step"), "double main.red:2", "main main.red:17")
+	c.request("next", map[string]interface{}{"threadId": 1})
+	expectframes(t, c.stopped("step"), "double main.red:3", "main main.red:17")
+	c.request("stepOut", map[string]interface{}{"threadId": 1})
+	expectframes(t, c.stopped("step"), "main main.red:18")
+	c.request("next", map[string]interface{}{"threadId": 1})
+	expectframes(t, c.stopped("step"), "main main.red:19")
+	if c.output != "hi\nhi\n" {
+		t.Fatalf("stepping over the keyword case printed %q", c.output)
+	}
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	c.event("terminated")
+}
+
+func TestDAPKeywordFrames(t *testing.T) {
+	c := newdapclient(t)
+	c.launch(map[string]string{"main.red": dapprogram}, false, nil, []string{"SAY TWICE"})
+
+	expectframes(t, c.stopped("breakpoint"), "SAY TWICE main.red:9", "main main.red:18")
+	if got := c.scope("Arguments"); got["text"] != `"hi"` {
+		t.Fatalf("arguments are %v", got)
+	}
+	c.request("next", map[string]interface{}{"threadId": 1})
+	expectframes(t, c.stopped("step"), "SAY TWICE main.red:10", "main main.red:18")
+	c.request("disconnect", nil)
+	<-c.served
+}
+
+func TestDAPModuleFrames(t *testing.T) {
+	c := newdapclient(t)
+	module := "EXPORT n 1\n\nFUNC inc\nLOAD n\nPUSH 1\nADD\nSTORE n\nENDFUNC\n"
+	program := "IMPORT counter.mred m\nPUSH 3\nMODRUN m inc\nMODGET m n\nPRINT\n"
+	c.launch(map[string]string{"main.red": program, "counter.mred": module}, false, map[string][]int{"counter.mred": {5}}, nil)
+
+	// A module function has a stack of its own
+	expectframes(t, c.stopped("breakpoint"), "m inc counter.mred:5", "main main.red:3")
+	if got := c.scope("Stack"); got["0"] != "1" || len(got) != 1 {
+		t.Fatalf("module stack is %v", got)
+	}
+	if got := c.scope("Module m"); got["n"] != "1" {
+		t.Fatalf("module symbols are %v", got)
+	}
+	c.request("setVariable", map[string]interface{}{"variablesReference": c.scoperef("Stack"), "name": "0", "value": "40"})
+	c.request("next", map[string]interface{}{"threadId": 1})
+	c.stopped("step")
+	ref := c.scoperef("Modules")
+	vars := c.request("variables", map[string]interface{}{"variablesReference": ref})["variables"].([]interface{})
+	if len(vars) != 1 || vars[0].(map[string]interface{})["name"] != "m" {
+		t.Fatalf("modules are %v", vars)
+	}
+	exports := vars[0].(map[string]interface{})["variablesReference"]
+	c.request("setVariable", map[string]interface{}{"variablesReference": exports, "name": "n", "value": "0"})
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	c.event("terminated")
+	if c.output != "41\n" {
+		t.Fatalf("program printed %q", c.output)
+	}
+}
+
+func TestDAPProgramError(t *testing.T) {
+	c := newdapclient(t)
+	c.launch(map[string]string{"main.red": "PUSH 1\nFROB\n"}, false, nil, nil)
+
+	if code := c.event("exited")["exitCode"]; code != 1.0 {
+		t.Fatalf("exit code %v", code)
+	}
+	c.event("terminated")
+	if c.output != "Invalid operation: FROB\n" {
+		t.Fatalf("program printed %q", c.output)
+	}
+
+	// The adapter outlives the program
+	if msg := c.call("threads", nil); msg["success"] != true {
+		t.Fatalf("threads failed after the program ended: %v", msg)
+	}
+}
+
+// Breakpoints can be set while the program runs, go test -race checks that the requests do not
+// touch the program's state at the same time as it does
+func TestDAPBreakpointsWhileRunning(t *testing.T) {
+	c := newdapclient(t)
+	program := "PUSH true\nSTORE forever\nFUNC spin\nPUSH 1\nSTORE x\nENDFUNC\nRUN spin forever\nPUSH \"done\"\nPRINT\n"
+	c.launch(map[string]string{"main.red": program}, false, nil, nil)
+
+	for i := 0; i < 20; i++ {
+		c.request("setFunctionBreakpoints", map[string]interface{}{"breakpoints": []interface{}{}})
+		c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": "main.red"}, "breakpoints": []interface{}{}})
+		c.request("stackTrace", map[string]interface{}{"threadId": 1})
+	}
+	c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": "main.red"}, "breakpoints": []interface{}{map[string]interface{}{"line": 5}}})
+	expectframes(t, c.stopped("breakpoint"), "spin main.red:5", "main main.red:7")
+
+	c.request("setVariable", map[string]interface{}{"variablesReference": c.scoperef("Globals"), "name": "forever", "value": "false"})
+	c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": "main.red"}, "breakpoints": []interface{}{}})
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	c.event("terminated")
+	if c.output != "done\n" {
+		t.Fatalf("program printed %q", c.output)
+	}
+}
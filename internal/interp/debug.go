@@ -0,0 +1,379 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Where run --debug stops, a breakpoint either has a file and line or names a
+// function, a module function such as "m fib" or a keyword case such as "UTIL SET"
+type breakpoint struct {
+	file string
+	line int
+	name string
+}
+
+const (
+	debugcontinue = iota
+	debugstep
+	debugnext
+	debugout
+)
+
+// A debugger attached to a program through its hook, the debug adapter keeps one as well. depth
+// is how many frames there were when next or out was asked for
+type debugger struct {
+	ip          *Interpreter
+	breakpoints []breakpoint
+	mode        int
+	depth       int
+	reader      *linereader
+	source      map[string][]string
+}
+
+// Debug attaches the command line debugger to ip, it stops before the first line so breakpoints
+// can be set
+func Debug(ip *Interpreter) {
+	d := &debugger{ip: ip, mode: debugstep, source: make(map[string][]string)}
+	d.reader = newlinereader(ip.input, ip.stdout, ip.interactive())
+	ip.hook = d.stop
+	fmt.Fprintln(ip.stdout, "RED debugger, type help for a list of commands")
+}
+
+// Decide whether to stop before a line, hit is the index of the breakpoint there or -1
+func (d *debugger) check(file string, line int) (stop bool, hit int) {
+	ip := d.ip
+	top := ip.frames[len(ip.frames)-1]
+	switch d.mode {
+	case debugstep:
+		stop = true
+	case debugnext:
+		stop = len(ip.frames) <= d.depth
+	case debugout:
+		stop = len(ip.frames) < d.depth
+	}
+	for i, b := range d.breakpoints {
+		named := b.name == top.name || (top.inmod && strings.HasSuffix(top.name, " "+b.name))
+		if (b.name != "" && named && top.steps == 1) || (b.name == "" && b.line == line && samefile(b.file, ip.resolvepath(file, ""))) {
+			return true, i
+		}
+	}
+	return stop, -1
+}
+
+// Stop before a line when needed and take commands until execution should go on
+func (d *debugger) stop(file string, line int, code string) {
+	ip := d.ip
+	stop, hit := d.check(file, line)
+	if !stop {
+		return
+	}
+	top := ip.frames[len(ip.frames)-1]
+	what := "Stopped"
+	if hit >= 0 {
+		what = fmt.Sprintf("Breakpoint %d", hit+1)
+	}
+	fmt.Fprintf(ip.stdout, "%s at %s in %s\n", what, showpos(file, line), top.name)
+	fmt.Fprintf(ip.stdout, "%5d | %s\n", line, strings.TrimSpace(code))
+	for {
+		input, ok := d.reader.readline("debug> ")
+		if !ok {
+			fmt.Fprintln(ip.stdout)
+			ip.exit(0)
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		d.reader.remember(input)
+		if d.command(input) {
+			return
+		}
+	}
+}
+
+// Handle a debugger command, returns true when execution should go on
+func (d *debugger) command(input string) bool {
+	ip := d.ip
+	parts := strings.Fields(input)
+	args := strings.TrimSpace(strings.TrimPrefix(input, parts[0]))
+	top := ip.frames[len(ip.frames)-1]
+	switch parts[0] {
+	case "help", "h":
+		fmt.Fprintln(ip.stdout, "step, s              run to the next line, entering functions and keyword cases")
+		fmt.Fprintln(ip.stdout, "next, n              run to the next line of this function, stepping over calls")
+		fmt.Fprintln(ip.stdout, "out, o               run until the current function or keyword case returns")
+		fmt.Fprintln(ip.stdout, "continue, c          run until a breakpoint is reached")
+		fmt.Fprintln(ip.stdout, "break, b [file:]line stop at a line, the file defaults to the current one")
+		fmt.Fprintln(ip.stdout, "break, b name        stop when a function, module function (name or mod name) or keyword case (PREFIX CASE) starts")
+		fmt.Fprintln(ip.stdout, "breaks               list breakpoints")
+		fmt.Fprintln(ip.stdout, "delete, d [n]        remove breakpoint n, or all of them")
+		fmt.Fprintln(ip.stdout, "where, w             show the functions and keyword cases being executed")
+		fmt.Fprintln(ip.stdout, "list, l              show the source around the current line")
+		fmt.Fprintln(ip.stdout, "stack                show the stack, a module function has a stack of its own")
+		fmt.Fprintln(ip.stdout, "push value           push a number, string or bool onto the stack")
+		fmt.Fprintln(ip.stdout, "pop                  remove the top value of the stack")
+		fmt.Fprintln(ip.stdout, "poke n value         replace the value n places below the top of the stack")
+		fmt.Fprintln(ip.stdout, "vars                 show variables and arguments in scope")
+		fmt.Fprintln(ip.stdout, "print name           show a variable")
+		fmt.Fprintln(ip.stdout, "set name value       change a variable")
+		fmt.Fprintln(ip.stdout, "modules              show imported modules and their exports")
+		fmt.Fprintln(ip.stdout, "export mod name value change an export of a module")
+		fmt.Fprintln(ip.stdout, "quit, q              stop the program")
+	case "step", "s":
+		d.mode = debugstep
+		return true
+	case "next", "n":
+		d.mode = debugnext
+		d.depth = len(ip.frames)
+		return true
+	case "out", "o":
+		d.mode = debugout
+		d.depth = len(ip.frames)
+		return true
+	case "continue", "c":
+		d.mode = debugcontinue
+		return true
+	case "quit", "q":
+		ip.exit(0)
+	case "break", "b":
+		if args == "" {
+			d.list()
+			break
+		}
+		b := breakpoint{name: args}
+		file, line := top.file, args
+		if i := strings.LastIndex(args, ":"); i >= 0 {
+			file, line = args[:i], args[i+1:]
+		}
+		if n, err := strconv.Atoi(line); err == nil {
+			b = breakpoint{file: file, line: n}
+		}
+		d.breakpoints = append(d.breakpoints, b)
+		fmt.Fprintf(ip.stdout, "Breakpoint %d at %s\n", len(d.breakpoints), showbreakpoint(b))
+	case "breaks":
+		d.list()
+	case "delete", "d":
+		if args == "" {
+			d.breakpoints = nil
+			fmt.Fprintln(ip.stdout, "All breakpoints removed")
+			break
+		}
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 || n > len(d.breakpoints) {
+			fmt.Fprintf(ip.stdout, "No breakpoint %s\n", args)
+			break
+		}
+		d.breakpoints = append(d.breakpoints[:n-1], d.breakpoints[n:]...)
+	case "where", "w":
+		for i := len(ip.frames) - 1; i >= 0; i-- {
+			fmt.Fprintf(ip.stdout, "#%d %s at %s\n", len(ip.frames)-1-i, ip.frames[i].name, showpos(ip.frames[i].file, ip.frames[i].line))
+		}
+	case "list", "l":
+		lines, ok := d.source[top.file]
+		if !ok {
+			bytes, err := ip.readfile(top.file, "")
+			if err == nil {
+				lines = strings.Split(string(bytes), "\n")
+			}
+			d.source[top.file] = lines
+		}
+		if top.line < 1 || top.line > len(lines) {
+			fmt.Fprintf(ip.stdout, "No source for %s\n", showpos(top.file, top.line))
+			break
+		}
+		for n := top.line - 5; n <= top.line+5; n++ {
+			if n < 1 || n > len(lines) {
+				continue
+			}
+			mark := " "
+			if n == top.line {
+				mark = ">"
+			}
+			fmt.Fprintf(ip.stdout, "%s%4d | %s\n", mark, n, strings.TrimRight(lines[n-1], "\r"))
+		}
+	case "stack":
+		s := ip.debugstack()
+		if len(*s) == 0 {
+			fmt.Fprintln(ip.stdout, "(empty)")
+		}
+		for i := len(*s) - 1; i >= 0; i-- {
+			fmt.Fprintf(ip.stdout, "%d: %s (%s)\n", len(*s)-1-i, showval((*s)[i]), typename((*s)[i].dtype))
+		}
+	case "push":
+		v, ok := parseliteral(args)
+		if !ok {
+			fmt.Fprintf(ip.stdout, "Invalid value: %s\n", args)
+			break
+		}
+		s := ip.debugstack()
+		*s = append(*s, v)
+	case "pop":
+		s := ip.debugstack()
+		if len(*s) == 0 {
+			fmt.Fprintln(ip.stdout, "The stack is empty")
+			break
+		}
+		*s = (*s)[:len(*s)-1]
+	case "poke":
+		s := ip.debugstack()
+		if len(parts) < 3 {
+			fmt.Fprintln(ip.stdout, "Usage: poke n value")
+			break
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 0 || n >= len(*s) {
+			fmt.Fprintf(ip.stdout, "No stack position %s\n", parts[1])
+			break
+		}
+		v, ok := parseliteral(strings.TrimSpace(strings.TrimPrefix(args, parts[1])))
+		if !ok {
+			fmt.Fprintln(ip.stdout, "Invalid value")
+			break
+		}
+		(*s)[len(*s)-1-n] = v
+	case "vars":
+		for _, scope := range ip.debugscopes() {
+			names := make([]string, 0, len(scope.vars))
+			for name := range scope.vars {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(ip.stdout, "%s = %s (%s, %s)\n", name, showval(scope.vars[name]), typename(scope.vars[name].dtype), scope.name)
+			}
+		}
+	case "print", "p":
+		for _, scope := range ip.debugscopes() {
+			if v, ok := scope.vars[args]; ok {
+				fmt.Fprintf(ip.stdout, "%s = %s (%s, %s)\n", args, showval(v), typename(v.dtype), scope.name)
+				return false
+			}
+		}
+		fmt.Fprintf(ip.stdout, "No variable %s\n", args)
+	case "set":
+		if len(parts) < 3 {
+			fmt.Fprintln(ip.stdout, "Usage: set name value")
+			break
+		}
+		v, ok := parseliteral(strings.TrimSpace(strings.TrimPrefix(args, parts[1])))
+		if !ok {
+			fmt.Fprintln(ip.stdout, "Invalid value")
+			break
+		}
+		scopes := ip.debugscopes()
+		into := scopes[len(scopes)-1].vars
+		for _, scope := range scopes {
+			if _, ok := scope.vars[parts[1]]; ok {
+				into = scope.vars
+				break
+			}
+		}
+		into[parts[1]] = v
+	case "modules":
+		names := make([]string, 0, len(ip.modules))
+		for name := range ip.modules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var exports []string
+			for e, v := range ip.modules[name].extvars {
+				exports = append(exports, e+" = "+showval(v))
+			}
+			sort.Strings(exports)
+			fmt.Fprintf(ip.stdout, "%s: %s\n", name, strings.Join(exports, ", "))
+		}
+	case "export":
+		if len(parts) < 4 {
+			fmt.Fprintln(ip.stdout, "Usage: export mod name value")
+			break
+		}
+		m, ok := ip.modules[parts[1]]
+		if !ok {
+			fmt.Fprintf(ip.stdout, "No module %s\n", parts[1])
+			break
+		}
+		if _, ok := m.extvars[parts[2]]; !ok {
+			fmt.Fprintf(ip.stdout, "Module %s does not export %s\n", parts[1], parts[2])
+			break
+		}
+		v, ok := parseliteral(strings.Join(parts[3:], " "))
+		if !ok {
+			fmt.Fprintln(ip.stdout, "Invalid value")
+			break
+		}
+		m.extvars[parts[2]] = v
+		m.symbols[parts[2]] = v
+	default:
+		fmt.Fprintf(ip.stdout, "Unknown command %s, type help for a list of commands\n", parts[0])
+	}
+	return false
+}
+
+// The stack the current line works on
+func (ip *Interpreter) debugstack() *[]stackVal {
+	if ip.frames[len(ip.frames)-1].inmod {
+		return &ip.tempstack
+	}
+	return &ip.stack
+}
+
+type debugscope struct {
+	name string
+	vars map[string]stackVal
+}
+
+// Variables visible to the current line, innermost first
+func (ip *Interpreter) debugscopes() []debugscope {
+	return ip.debugframescopes(ip.frames[len(ip.frames)-1])
+}
+
+func (ip *Interpreter) debugframescopes(f frame) []debugscope {
+	var scopes []debugscope
+	if len(f.args) > 0 {
+		scopes = append(scopes, debugscope{"argument", f.args})
+	}
+	if f.inmod {
+		return append(scopes, debugscope{"module " + ip.modname, ip.module.symbols})
+	}
+	return append(scopes, debugscope{"global", ip.symbols})
+}
+
+func (d *debugger) list() {
+	ip := d.ip
+	if len(d.breakpoints) == 0 {
+		fmt.Fprintln(ip.stdout, "No breakpoints")
+	}
+	for i, b := range d.breakpoints {
+		fmt.Fprintf(ip.stdout, "%d: %s\n", i+1, showbreakpoint(b))
+	}
+}
+
+func showbreakpoint(b breakpoint) string {
+	if b.name != "" {
+		return b.name
+	}
+	return showpos(b.file, b.line)
+}
+
+// A breakpoint file matches by path or by base name alone
+func samefile(want string, file string) bool {
+	if !strings.ContainsAny(want, "/\\") && want == filepath.Base(file) {
+		return true
+	}
+	a, err1 := filepath.Abs(want)
+	b, err2 := filepath.Abs(file)
+	return err1 == nil && err2 == nil && a == b
+}
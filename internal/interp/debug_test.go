@@ -0,0 +1,47 @@
+package interp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The debugger stops at breakpoints and steps through a program with commands read from its input
+func TestDebugger(t *testing.T) {
+	ip, out := newtestinterpreter()
+	ip.SetInput(strings.NewReader("break double\ncontinue\nwhere\nnext\nstack\nout\nstep\npush 10\nbreak 9\nbreaks\ncontinue\ncontinue\n"))
+	ip.Load("main.red", "FUNC double\n\tPUSH 2\n\tMULT\nENDFUNC\nPUSH 4\nRUN double\nSTORE x\nLOAD x\nPRINT")
+	Debug(ip)
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := `RED debugger, type help for a list of commands
+Stopped at main.red:1 in main
+    1 | FUNC double
+Breakpoint 1 at double
+Breakpoint 1 at main.red:2 in double
+    2 | PUSH 2
+#0 double at main.red:2
+#1 main at main.red:6
+Stopped at main.red:3 in double
+    3 | MULT
+0: 2 (number)
+1: 4 (number)
+Stopped at main.red:7 in main
+    7 | STORE x
+Stopped at main.red:8 in main
+    8 | LOAD x
+Breakpoint 2 at main.red:9
+1: double
+2: main.red:9
+Breakpoint 2 at main.red:9 in main
+    9 | PRINT
+8
+`
+	if got := out.String(); got != want {
+		t.Errorf("printed\n%s\nwant\n%s", got, want)
+	}
+	if got := ip.Stack(); !reflect.DeepEqual(got, []interface{}{10.0}) {
+		t.Errorf("stack is %v", got)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rewrite a .red, .mred or native .kr file in the canonical layout: core keywords in capitals,
+// one tab inside FUNC and KEYWORD blocks, single spaces between words, double quoted strings,
+// // and /* */ comments and no runs of blank lines. Text inside multi-line comments is kept
+func formatsource(path string, text string) string {
+	// Canonical words first, the layout depends on keywords being recognised
+	var lines []string
+	verbatim := make(map[int]bool)
+	incomment := false
+	for i, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		words := sourcewords(line)
+		if i == 0 && strings.HasPrefix(raw, "#!") {
+			lines = append(lines, strings.TrimRight(raw, " \t"))
+			verbatim[i] = true
+			continue
+		}
+		if incomment {
+			if len(words) > 0 && (strings.ToUpper(words[0].text) == "ENDCOMM" || words[0].text == "*/") {
+				line = strings.TrimSpace("*/ " + line[words[0].end:])
+				incomment = false
+			} else {
+				line = strings.TrimRight(raw, " \t\r")
+				verbatim[i] = true
+			}
+			lines = append(lines, line)
+			continue
+		}
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		switch op := strings.ToUpper(words[0].text); op {
+		case "COMM", "//":
+			line = strings.TrimSpace("// " + strings.TrimSpace(line[words[0].end:]))
+		case "MCOMM", "/*":
+			line = strings.TrimSpace("/* " + strings.TrimSpace(line[words[0].end:]))
+			incomment = true
+		default:
+			line = strings.Join(formatwords(words), " ")
+		}
+		lines = append(lines, line)
+	}
+
+	// Then the layout
+	f := parsesource(path, strings.Join(lines, "\n"))
+	var out []string
+	for i, l := range f.lines {
+		line := lines[i]
+		if line == "" {
+			if len(out) > 0 && out[len(out)-1] != "" {
+				out = append(out, "")
+			}
+			continue
+		}
+		if !verbatim[i] && (l.where == infunc || l.where == inmodfunc) && line != "ENDFUNC" && line != "ENDKEYWORD" && line != "ENDTEST" {
+			line = "\t" + line
+		}
+		out = append(out, line)
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// Capitalise core keywords and use double quotes, the words after IF condition are a line of their own
+func formatwords(words []srcword) []string {
+	res := make([]string, len(words))
+	for i, w := range words {
+		res[i] = w.text
+		if _, core := keywordinfos[strings.ToUpper(w.text)]; core && (i == 0 || (i == 2 && res[0] == "IF")) {
+			res[i] = strings.ToUpper(w.text)
+		} else if len(w.text) > 1 && strings.HasPrefix(w.text, "'") && strings.HasSuffix(w.text, "'") && !strings.Contains(w.text, "\"") {
+			res[i] = "\"" + w.text[1:len(w.text)-1] + "\""
+		}
+	}
+	if len(words) > 2 && res[0] == "IF" {
+		rest := formatwords(words[2:])
+		copy(res[2:], rest)
+	}
+	if len(res) == 4 && res[0] == "KEYPORT" && (strings.ToUpper(res[2]) == "AS" || strings.ToUpper(res[2]) == "EXTEND") {
+		res[2] = strings.ToUpper(res[2])
+	}
+	return res
+}
+
+// Find the .red, .mred and .kr files of the given files and directories, the current
+// directory when there are none. Returns false when one could not be read
+func sourcefiles(out io.Writer, paths []string) ([]string, bool) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	ok := true
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			ok = false
+			continue
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() && path != p && (info.Name() == "vendor" || strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && (strings.HasSuffix(path, ".red") || strings.HasSuffix(path, ".mred") || strings.HasSuffix(path, ".kr")) {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	return files, ok
+}
+
+// Format formats files in place, or with check only lists those that are not formatted on out.
+// Directories are searched for .red, .mred and .kr files. Returns false when a file could not be
+// formatted or is not formatted in check mode
+func Format(out io.Writer, paths []string, check bool) bool {
+	files, ok := sourcefiles(out, paths)
+	for _, path := range files {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			ok = false
+			continue
+		}
+		text := string(bytes)
+		if strings.HasSuffix(path, ".kr") && strings.HasPrefix(strings.TrimSpace(text), "{") {
+			// JSON keyword libraries are left as they are
+			continue
+		}
+		formatted := formatsource(path, text)
+		if formatted == text {
+			continue
+		}
+		if check {
+			fmt.Fprintln(out, path)
+			ok = false
+			continue
+		}
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode()
+		}
+		if err := ioutil.WriteFile(path, []byte(formatted), mode); err != nil {
+			fmt.Fprintln(out, err)
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,89 @@
+package interp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatSource(t *testing.T) {
+	for _, c := range []struct{ name, in, want string }{
+		{"keywords", "push 1\nstore   x\nload x\nprint", "PUSH 1\nSTORE x\nLOAD x\nPRINT\n"},
+		{"quotes", "PUSH 'hello world'\nPUSH 'say \"hi\"'", "PUSH \"hello world\"\nPUSH 'say \"hi\"'\n"},
+		{"blocks", "FUNC f\nPUSH 1\n    PRINT\nENDFUNC\nKEYWORD SAY HI\nPUSH \"hi\"\nENDKEYWORD", "FUNC f\n\tPUSH 1\n\tPRINT\nENDFUNC\nKEYWORD SAY HI\n\tPUSH \"hi\"\nENDKEYWORD\n"},
+		{"if", "PUSH true\nSTORE c\nif c push 1", "PUSH true\nSTORE c\nIF c PUSH 1\n"},
+		{"keyport", "keyport lib.kr as LIB", "KEYPORT lib.kr AS LIB\n"},
+		{"comments", "COMM a comment\nMCOMM\n   kept   as it is\nENDCOMM", "// a comment\n/*\n   kept   as it is\n*/\n"},
+		{"blank lines", "\n\nPUSH 1\n\n\n\nPRINT\n\n", "PUSH 1\n\nPRINT\n"},
+		{"shebang", "#!/usr/bin/env red\npush 1", "#!/usr/bin/env red\nPUSH 1\n"},
+		{"crlf", "PUSH 1\r\nPRINT\r\n", "PUSH 1\nPRINT\n"},
+		{"empty", "\n\n", ""},
+	} {
+		if got := formatsource("test.red", c.in); got != c.want {
+			t.Errorf("%s: formatted %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// Formatting what was formatted changes nothing, for every example and built-in library
+func TestFormatIdempotent(t *testing.T) {
+	files, ok := sourcefiles(os.Stderr, []string{"../../examples", "../../built-in"})
+	if !ok || len(files) == 0 {
+		t.Fatal("no source files found")
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := string(data)
+		if strings.HasSuffix(path, ".kr") && strings.HasPrefix(strings.TrimSpace(text), "{") {
+			continue
+		}
+		once := formatsource(path, text)
+		if twice := formatsource(path, once); twice != once {
+			t.Errorf("formatting %s again changed it from\n%s\nto\n%s", path, once, twice)
+		}
+	}
+}
+
+func TestFormatCheck(t *testing.T) {
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy.red")
+	tidy := filepath.Join(dir, "tidy.red")
+	library := filepath.Join(dir, "lib.kr")
+	os.WriteFile(messy, []byte("push 1\n\n\nprint"), 0644)
+	os.WriteFile(tidy, []byte("PUSH 1\nPRINT\n"), 0644)
+	os.WriteFile(library, []byte(`{"prefix": "LIB", "main": []}`), 0644)
+
+	// --check lists the file that is not formatted and leaves it alone
+	var out strings.Builder
+	if Format(&out, []string{dir}, true) {
+		t.Error("check passed with an unformatted file")
+	}
+	if out.String() != messy+"\n" {
+		t.Errorf("check printed %q, want %q", out.String(), messy+"\n")
+	}
+	if data, _ := os.ReadFile(messy); string(data) != "push 1\n\n\nprint" {
+		t.Errorf("check changed %s to %q", messy, data)
+	}
+
+	// Formatting rewrites it, after which the check passes
+	out.Reset()
+	if !Format(&out, []string{dir}, false) || out.Len() > 0 {
+		t.Fatalf("formatting failed: %s", out.String())
+	}
+	if data, _ := os.ReadFile(messy); string(data) != "PUSH 1\n\nPRINT\n" {
+		t.Errorf("%s formatted to %q", messy, data)
+	}
+	if data, _ := os.ReadFile(library); string(data) != `{"prefix": "LIB", "main": []}` {
+		t.Errorf("the JSON library was changed to %q", data)
+	}
+	if !Format(&out, []string{dir}, true) || out.Len() > 0 {
+		t.Errorf("check failed after formatting: %s", out.String())
+	}
+	if Format(&out, []string{filepath.Join(dir, "missing.red")}, true) {
+		t.Error("check passed for a file that does not exist")
+	}
+}
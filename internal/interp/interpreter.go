@@ -0,0 +1,903 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+// Package interp is the RED interpreter. Package red hands its Interpreter to programs that
+// embed RED, the red command builds its tools on it as well: the REPL, the debugger, the test
+// runner, the formatter, the checker, the linter and the debug adapter and language servers
+package interp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An Interpreter holds the state of one RED program. It is not safe to use one Interpreter from
+// several goroutines at once, but different Interpreters can run concurrently
+type Interpreter struct {
+	stack     []stackVal
+	symbols   map[string]stackVal
+	modules   map[string]mod
+	frommod   bool
+	module    mod
+	modname   string
+	tempstack []stackVal
+	comment   bool
+
+	// Where the program prints to and where INPUT reads from, standard input when stdin is nil
+	stdout io.Writer
+	stdin  *bufio.Reader
+
+	// Where the coverage summary is printed, apart from what the program prints
+	report io.Writer
+
+	// What ARGS and ARGC push
+	args []string
+
+	// Environment variables set by SETENV, GETENV looks here before the environment of the
+	// process, which programs cannot change
+	env map[string]string
+
+	// Where IMPORT and KEYPORT look for files that are not in the working directory, files
+	// holds the ones they read without looking on disk and lines and libs the ones a Program
+	// holds already parsed
+	include []string
+	files   map[string][]byte
+	lines   map[string][]string
+	libs    map[string]map[string]keymod
+
+	// Where the files that were not in the working directory were found, by the name they
+	// were loaded with
+	found map[string]string
+
+	// Where every line is printed before it runs, nil unless Trace was called
+	trace io.Writer
+
+	// Where RANDINT and RANDFLOAT get their numbers from
+	rng *rand.Rand
+
+	depth  int
+	frames []frame
+
+	// Called before every line that is executed, used by the debugger
+	hook func(file string, line int, code string)
+
+	keymods     map[string]keymod
+	tempsymbols map[string]stackVal
+	funcs       map[string]funct
+
+	// Keywords registered by the program embedding the interpreter, they outlive initstate
+	hostkeywords map[string]hostkeyword
+
+	// What programs may use, disabled keywords fail when they are reached
+	limits   Limits
+	disabled map[string]bool
+
+	// Set while Run or Call runs, steps counts the lines they executed
+	ctx   context.Context
+	steps int
+	cause error
+
+	// A running estimate of what memory would return, kept while Limits.Memory is set, and
+	// how many steps are left before it is counted again from scratch
+	mem      int
+	memcheck int
+
+	// State of the top level program, kept between lines so the REPL can feed them in one at a time
+	activefuncwrite bool
+	activefunc      funct
+	activekeywrite  bool
+	keyheader       string
+	keybody         []string
+	keyline         int
+	running         funct
+	runningfunc     bool
+	activetestwrite bool
+	activetest      testblock
+
+	// The TEST blocks of the program in the order they appear, red test runs them
+	tests []testblock
+
+	// Where the last assertion failed and why, red test reports it
+	failed string
+
+	// Programs given to Load that have not been run yet
+	pending []program
+
+	// How often each line of each file ran, nil unless coverage is being recorded
+	coverage map[string]map[int]int
+
+	// Where the coverage report is written, with .lcov and .html added
+	coverout string
+}
+
+// Source code waiting to be run, name is the file it came from
+type program struct {
+	name  string
+	lines []string
+}
+
+// Error is returned when a program stops with a non-zero exit code, either by EXIT or because
+// something went wrong. Message is the last line the program printed before it stopped
+type Error struct {
+	Code    int
+	Message string
+
+	// The context error when the program was cancelled or ran out of time
+	err error
+}
+
+// Unwrap returns context.Canceled or context.DeadlineExceeded when the program was stopped by
+// its context or Limits.Time
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Message
+}
+
+// New returns an Interpreter with an empty stack and only PI and EULER defined. Its programs
+// print to standard output and read INPUT from standard input
+func New() *Interpreter {
+	ip := &Interpreter{
+		stdout:   os.Stdout,
+		report:   os.Stderr,
+		rng:      rand.New(rand.NewSource(randseed())),
+		coverout: "coverage",
+		found:    make(map[string]string),
+		env:      make(map[string]string),
+
+		hostkeywords: make(map[string]hostkeyword),
+		disabled:     make(map[string]bool),
+	}
+	ip.initstate()
+	return ip
+}
+
+// SetOutput sets where PRINT and error messages go
+func (ip *Interpreter) SetOutput(w io.Writer) {
+	ip.stdout = w
+}
+
+// SetReportOutput sets where ReportCoverage prints its summary, standard error unless it is set
+func (ip *Interpreter) SetReportOutput(w io.Writer) {
+	ip.report = w
+}
+
+// SetInput sets where INPUT and READALL read from, standard input until it is called
+func (ip *Interpreter) SetInput(r io.Reader) {
+	ip.stdin = bufio.NewReader(r)
+}
+
+// SetFiles gives IMPORT, KEYPORT and LoadBuiltins files to use instead of reading them from disk,
+// keyed by the path the program loads them with using forward slashes. Bundle collects them
+func (ip *Interpreter) SetFiles(files map[string][]byte) {
+	ip.files = files
+}
+
+// Bundle reads the program in path and every module and keyword library it loads, directly or
+// through the files it loads, along with built-in/util.kr, so they can be given to SetFiles. A
+// file that IMPORT or KEYPORT names but cannot be found is an error with the file and line of
+// the statement, except for files in built-in, which the program downloads when it runs without
+// them. Those are left out with a warning
+func (ip *Interpreter) Bundle(path string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	var add func(name string) error
+	add = func(name string) error {
+		key := filepath.ToSlash(filepath.Clean(name))
+		if _, ok := files[key]; ok {
+			return nil
+		}
+		data, err := ip.readfile(name, "")
+		if err != nil {
+			return err
+		}
+		files[key] = data
+		refs, err := loadrefs(name, data)
+		if err != nil {
+			return err
+		}
+		for _, r := range refs {
+			if _, err := ip.readfile(r.path, name); err != nil {
+				if !strings.HasPrefix(filepath.ToSlash(filepath.Clean(r.path)), "built-in/") {
+					return fmt.Errorf("%s:%d: cannot find %s %s", name, r.line, r.kind, r.path)
+				}
+				fmt.Fprintf(ip.stdout, "%s:%d: warning: %s is left out, the program downloads the built-in folder when it runs\n", name, r.line, r.path)
+				continue
+			}
+			if err := add(r.path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := add(path); err != nil {
+		return nil, err
+	}
+	if err := add("built-in/util.kr"); err != nil {
+		fmt.Fprintln(ip.stdout, "warning: built-in/util.kr is left out, the program downloads the built-in folder when it runs")
+	}
+	return files, nil
+}
+
+// A file named by an IMPORT or KEYPORT statement and the line the statement is on
+type loadref struct {
+	path string
+	kind string
+	line int
+}
+
+// The files a source file loads. The code of keyword libraries written in JSON is in the lines
+// of their cases, comments and strings are skipped and IF c IMPORT file counts as well
+func loadrefs(name string, data []byte) ([]loadref, error) {
+	var refs []loadref
+	find := func(words []srcword, line int) {
+		for len(words) > 2 && words[0].text == "IF" {
+			words = words[2:]
+		}
+		if len(words) < 2 {
+			return
+		}
+		switch words[0].text {
+		case "IMPORT":
+			refs = append(refs, loadref{words[1].text, "module", line})
+		case "KEYPORT":
+			refs = append(refs, loadref{words[1].text, "keyword file", line})
+		}
+	}
+	text := string(data)
+	if !strings.HasPrefix(strings.TrimSpace(text), "{") {
+		for _, l := range parsesource(name, text).lines {
+			if !l.comment {
+				find(l.words, l.n)
+			}
+		}
+		return refs, nil
+	}
+	var lib struct {
+		Main []struct {
+			Code []string `json:"code"`
+		} `json:"main"`
+	}
+	if err := json.Unmarshal(data, &lib); err != nil {
+		return nil, fmt.Errorf("invalid keyword file %s: %v", name, err)
+	}
+	offset := 0
+	for _, c := range lib.Main {
+		for _, code := range c.Code {
+			find(sourcewords(code), jsonline(text, &offset, code))
+		}
+	}
+	return refs, nil
+}
+
+// SetIncludePaths sets the folders IMPORT, KEYPORT and LoadBuiltins look in for files that are
+// not found in the working directory or next to the file that loads them, before the vendor
+// folders
+func (ip *Interpreter) SetIncludePaths(dirs ...string) {
+	ip.include = dirs
+}
+
+// Trace prints the file, line and code of every line to w before it runs, nil stops it
+func (ip *Interpreter) Trace(w io.Writer) {
+	ip.trace = w
+}
+
+// SetArgs sets the arguments ARGS and ARGC give the program, the command line arguments that
+// follow its file
+func (ip *Interpreter) SetArgs(args ...string) {
+	ip.args = args
+}
+
+// LoadBuiltins loads the UTIL keywords from built-in/util.kr in the working directory, the way
+// the run command does before every program. The folder is downloaded when it is missing
+func (ip *Interpreter) LoadBuiltins() error {
+	return ip.guard(context.Background(), ip.defimports)
+}
+
+// Load adds source code to be run by the next call to Run, name is used in error messages
+// and a #! line at the start is skipped
+func (ip *Interpreter) Load(name string, source string) {
+	ip.pending = append(ip.pending, program{name, strings.Split(stripshebang(source), "\n")})
+}
+
+// LoadFile adds a program file to be run by the next call to Run
+func (ip *Interpreter) LoadFile(path string) error {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ip.Load(path, string(bytes))
+	return nil
+}
+
+// Run runs the programs loaded since the last call in order. The stack, variables and functions
+// they leave behind stay for later programs, Get, Stack and Call
+func (ip *Interpreter) Run() error {
+	return ip.RunContext(context.Background())
+}
+
+// RunContext is Run stopping the program when ctx is done
+func (ip *Interpreter) RunContext(ctx context.Context) error {
+	pending := ip.pending
+	ip.pending = nil
+	return ip.guard(ctx, func() {
+		for _, p := range pending {
+			ip.runlines(p.name, p.lines)
+		}
+	})
+}
+
+// Call runs a function defined with FUNC by an earlier program, it takes its arguments from
+// the stack like RUN does
+func (ip *Interpreter) Call(name string) error {
+	return ip.CallContext(context.Background(), name)
+}
+
+// CallContext is Call stopping the function when ctx is done
+func (ip *Interpreter) CallContext(ctx context.Context, name string) error {
+	return ip.guard(ctx, func() {
+		f, ok := ip.funcs[name]
+		if !ok {
+			fmt.Fprintf(ip.stdout, "Function %s not defined\n", name)
+			ip.exit(1)
+		}
+		ip.runfunc(f, false)
+	})
+}
+
+// Limits bound what a program run by Run or Call may use, a field left at zero sets no limit.
+// They are checked before every line a program executes and every pass through a looping
+// function, so a line can go past them once
+type Limits struct {
+	// How many lines may be executed, each pass through a function body counts again and so
+	// does every pass through a loop
+	Steps int
+
+	// How long a program may run, also when it is waiting in DELAYST or for INPUT
+	Time time.Duration
+
+	// How deeply FUNC, MODRUN and keyword calls may nest, 100 when it is not set
+	Depth int
+
+	// How many values may be on the stack
+	Stack int
+
+	// Roughly how many bytes the values on the stacks and in variables may take up
+	Memory int
+}
+
+// SetLimits sets the limits of the programs run from now on
+func (ip *Interpreter) SetLimits(l Limits) {
+	ip.limits = l
+}
+
+// Disable stops programs from using keywords, a program reaching one of them fails. Core
+// keywords such as INPUT, DELAYST, KEYPORT and IMPORT can be disabled, as can keyword libraries
+// by their prefix and registered keywords
+func (ip *Interpreter) Disable(keywords ...string) {
+	for _, k := range keywords {
+		ip.disabled[k] = true
+	}
+}
+
+// Fail when a program reaches a disabled keyword
+func (ip *Interpreter) allow(op string) {
+	if ip.disabled[op] {
+		fmt.Fprintf(ip.stdout, "%s is disabled\n", op)
+		ip.exit(1)
+	}
+}
+
+// Stop the program when it went past one of its limits or its context is done
+func (ip *Interpreter) checklimits() {
+	ip.steps++
+	if ip.ctx != nil && ip.ctx.Err() != nil {
+		ip.cancelled()
+	}
+	l := ip.limits
+	if l.Steps > 0 && ip.steps > l.Steps {
+		fmt.Fprintf(ip.stdout, "Step limit of %d lines exceeded\n", l.Steps)
+		ip.exit(1)
+	}
+	if l.Stack > 0 && len(ip.stack) > l.Stack {
+		fmt.Fprintf(ip.stdout, "Stack limit of %d values exceeded\n", l.Stack)
+		ip.exit(1)
+	}
+	if l.Memory > 0 {
+		ip.memcheck--
+		// Values changed in place and variables that went away are only noticed by a recount,
+		// which runs every so many steps and before the limit is reported
+		if ip.mem > l.Memory || ip.memcheck <= 0 {
+			ip.recount()
+		}
+		if ip.mem > l.Memory {
+			fmt.Fprintf(ip.stdout, "Memory limit of %d bytes exceeded\n", l.Memory)
+			ip.exit(1)
+		}
+	}
+}
+
+// Stop a program whose context is done
+func (ip *Interpreter) cancelled() {
+	ip.cause = ip.ctx.Err()
+	if ip.cause == context.DeadlineExceeded && ip.limits.Time > 0 {
+		fmt.Fprintf(ip.stdout, "Time limit of %s exceeded\n", ip.limits.Time)
+	} else {
+		fmt.Fprintf(ip.stdout, "Program stopped: %v\n", ip.cause)
+	}
+	ip.exit(1)
+}
+
+// Wait for DELAYST, waking up when the program is cancelled
+func (ip *Interpreter) sleep(d time.Duration) {
+	if ip.ctx == nil {
+		time.Sleep(d)
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ip.ctx.Done():
+		ip.cancelled()
+	}
+}
+
+// Standard input, read through one buffer by every Interpreter not given another input so none
+// of them reads ahead what another one should get
+var stdin struct {
+	sync.Mutex
+	once   sync.Once
+	reader *bufio.Reader
+}
+
+// The reader INPUT, READALL, the REPL and the debugger read from, standard input unless SetInput
+// gave another
+func (ip *Interpreter) input() *bufio.Reader {
+	if ip.stdin != nil {
+		return ip.stdin
+	}
+	stdin.once.Do(func() { stdin.reader = bufio.NewReader(os.Stdin) })
+	return stdin.reader
+}
+
+// Read from the input, stopping the program when it is cancelled while it waits. The read
+// that was cut short goes on in the background, what it reads comes first for the next one
+func (ip *Interpreter) read(f func(in *bufio.Reader) (string, error)) (string, error) {
+	in, shared := ip.input(), ip.stdin == nil
+	read := func() (string, error) {
+		if shared {
+			stdin.Lock()
+			defer stdin.Unlock()
+		}
+		return f(in)
+	}
+	if ip.ctx == nil || ip.ctx.Done() == nil {
+		return read()
+	}
+	done := make(chan readresult, 1)
+	go func() {
+		s, err := read()
+		done <- readresult{s, err}
+	}()
+	select {
+	case r := <-done:
+		return r.s, r.err
+	case <-ip.ctx.Done():
+		var rest io.Reader = in
+		if shared {
+			rest = lockedstdin{}
+		}
+		ip.stdin = bufio.NewReader(io.MultiReader(&pendingread{done: done}, rest))
+		ip.cancelled()
+	}
+	return "", nil
+}
+
+// Standard input read by one Interpreter at a time
+type lockedstdin struct{}
+
+func (lockedstdin) Read(b []byte) (int, error) {
+	stdin.Lock()
+	defer stdin.Unlock()
+	return stdin.reader.Read(b)
+}
+
+type readresult struct {
+	s   string
+	err error
+}
+
+// What a read that was cut short reads once it finishes
+type pendingread struct {
+	done chan readresult
+	rest *strings.Reader
+}
+
+func (p *pendingread) Read(b []byte) (int, error) {
+	if p.rest == nil {
+		p.rest = strings.NewReader((<-p.done).s)
+	}
+	return p.rest.Read(b)
+}
+
+// An estimate of the bytes used by the values of the program and how many values there are
+func (ip *Interpreter) memory() (int, int) {
+	n, count := 0, 0
+	for _, list := range [][]stackVal{ip.stack, ip.tempstack} {
+		for _, v := range list {
+			n += valsize(v)
+		}
+		count += len(list)
+	}
+	vars := []map[string]stackVal{ip.symbols, ip.tempsymbols, ip.module.symbols}
+	for _, m := range ip.modules {
+		vars = append(vars, m.symbols, m.extvars)
+	}
+	seen := make(map[uintptr]bool)
+	for _, m := range vars {
+		// The running module shares its variables with its entry in modules
+		if m == nil || seen[reflect.ValueOf(m).Pointer()] {
+			continue
+		}
+		seen[reflect.ValueOf(m).Pointer()] = true
+		for name, v := range m {
+			n += len(name) + valsize(v)
+		}
+		count += len(m)
+	}
+	return n, count
+}
+
+// Count the memory of the program again, the next recount comes after as many steps as there
+// are values so the steps in between pay for it
+func (ip *Interpreter) recount() {
+	n, count := ip.memory()
+	ip.mem, ip.memcheck = n, count+64
+}
+
+// Push values on the stack, keeping the running memory estimate
+func (ip *Interpreter) push(vs ...stackVal) {
+	ip.pushto(&ip.stack, vs...)
+}
+
+func (ip *Interpreter) pushto(stack *[]stackVal, vs ...stackVal) {
+	if ip.limits.Memory > 0 {
+		for _, v := range vs {
+			ip.mem += valsize(v)
+		}
+	}
+	*stack = append(*stack, vs...)
+}
+
+// Take n values off the top of the stack
+func (ip *Interpreter) drop(n int) {
+	ip.dropfrom(&ip.stack, n)
+}
+
+func (ip *Interpreter) dropfrom(stack *[]stackVal, n int) {
+	if ip.limits.Memory > 0 {
+		for _, v := range (*stack)[len(*stack)-n:] {
+			ip.mem -= valsize(v)
+		}
+	}
+	*stack = (*stack)[:len(*stack)-n]
+}
+
+// Empty a stack
+func (ip *Interpreter) clearstack(stack *[]stackVal) {
+	ip.dropfrom(stack, len(*stack))
+	*stack = make([]stackVal, 0)
+}
+
+// Store a value in a variable
+func (ip *Interpreter) setvar(vars map[string]stackVal, name string, v stackVal) {
+	if ip.limits.Memory > 0 {
+		if old, ok := vars[name]; ok {
+			ip.mem -= valsize(old)
+		} else {
+			ip.mem += len(name)
+		}
+		ip.mem += valsize(v)
+	}
+	vars[name] = v
+}
+
+func valsize(v stackVal) int {
+	n := 64 + len(v.sval) + len(v.symbol)
+	for _, item := range v.list {
+		n += valsize(item)
+	}
+	return n
+}
+
+// Seed makes the random keywords pick the same numbers every time a program runs with the
+// same seed. New seeds an Interpreter with the RED_SEED environment variable, or the time
+// when it is not set
+func (ip *Interpreter) Seed(seed int64) {
+	ip.rng = rand.New(rand.NewSource(seed))
+}
+
+// SecureRandom makes the random keywords pick their numbers with crypto/rand, for programs
+// whose random numbers must not be guessed. Seed switches back
+func (ip *Interpreter) SecureRandom() {
+	ip.rng = rand.New(securesource{})
+}
+
+// Get returns the value of a variable as a float64, string, bool or []interface{} for an array
+func (ip *Interpreter) Get(name string) (interface{}, bool) {
+	v, ok := ip.symbols[name]
+	if !ok {
+		return nil, false
+	}
+	return govalue(v), true
+}
+
+// Set stores a value in a variable, it may be any Go integer or float, a string, a bool or a
+// slice of those. Numbers become float64, so integers past 2^53 lose precision
+func (ip *Interpreter) Set(name string, value interface{}) error {
+	v, err := redvalue(value)
+	if err != nil {
+		return err
+	}
+	ip.setvar(ip.symbols, name, v)
+	return nil
+}
+
+// Push puts a value on top of the stack, for example an argument for Call
+func (ip *Interpreter) Push(value interface{}) error {
+	v, err := redvalue(value)
+	if err != nil {
+		return err
+	}
+	ip.push(v)
+	return nil
+}
+
+// Stack returns the values on the stack, the top of the stack last
+func (ip *Interpreter) Stack() []interface{} {
+	values := make([]interface{}, len(ip.stack))
+	for i, v := range ip.stack {
+		values[i] = govalue(v)
+	}
+	return values
+}
+
+// A Keyword is a Go function that programs call by name once it is registered. It takes one
+// value off the stack for each of Args and pushes the values Func returns, an error stops the
+// program
+type Keyword struct {
+	// The types of the values taken off the stack, deepest first: "number", "string", "bool",
+	// "array" or "any"
+	Args []string
+
+	// How many values Func returns, -1 when it varies
+	Returns int
+
+	// Called with the values taken off the stack in the order of Args, the values it returns
+	// are pushed in order so the last ends up on top
+	Func func(args []interface{}) ([]interface{}, error)
+}
+
+// A registered Keyword with its argument types looked up
+type hostkeyword struct {
+	Keyword
+	dtypes []int
+}
+
+// Register makes a Go function available to programs as the keyword name, such as
+//
+//	ip.Register("LOOKUP", red.Keyword{Args: []string{"string"}, Returns: 1, Func: lookup})
+//
+// after which PUSH "key" LOOKUP leaves what lookup returned on the stack. Core keywords and the
+// prefixes of keyword libraries that are already loaded cannot be replaced, a keyword library
+// with the same prefix can no longer be loaded afterwards
+func (ip *Interpreter) Register(name string, k Keyword) error {
+	if name == "" || strings.ContainsAny(name, " \t\"'") {
+		return fmt.Errorf("red: invalid keyword name %q", name)
+	}
+	if _, ok := keywordinfos[name]; ok {
+		return fmt.Errorf("red: %s is a core keyword", name)
+	}
+	if lib, ok := ip.keymods[name]; ok {
+		return fmt.Errorf("red: %s is the prefix of the keyword library loaded from %s", name, lib.source)
+	}
+	if k.Func == nil {
+		return fmt.Errorf("red: keyword %s has no Func", name)
+	}
+	if k.Returns < -1 {
+		return fmt.Errorf("red: keyword %s returns %d values", name, k.Returns)
+	}
+	h := hostkeyword{Keyword: k}
+	for _, t := range k.Args {
+		dtype, ok := typenames[t]
+		if !ok {
+			return fmt.Errorf("red: keyword %s has an argument of unknown type %q", name, t)
+		}
+		h.dtypes = append(h.dtypes, dtype)
+	}
+	ip.hostkeywords[name] = h
+	return nil
+}
+
+// Call a registered keyword with the values on top of stack
+func (ip *Interpreter) callhost(name string, h hostkeyword, stack *[]stackVal) {
+	n := len(h.dtypes)
+	if len(*stack) < n {
+		plural := "s"
+		if n == 1 {
+			plural = ""
+		}
+		fmt.Fprintf(ip.stdout, "%s expects %d value%s on the stack, got %d\n", name, n, plural, len(*stack))
+		ip.exit(1)
+	}
+	taken := (*stack)[len(*stack)-n:]
+	args := make([]interface{}, n)
+	for i, v := range taken {
+		if h.dtypes[i] != -1 && v.dtype != h.dtypes[i] {
+			fmt.Fprintf(ip.stdout, "%s argument %d must be %s, got %s\n", name, i+1, typename(h.dtypes[i]), typename(v.dtype))
+			ip.exit(1)
+		}
+		args[i] = govalue(v)
+	}
+	ip.dropfrom(stack, n)
+	results, err := h.Func(args)
+	if err != nil {
+		fmt.Fprintf(ip.stdout, "%s failed: %v\n", name, err)
+		ip.exit(1)
+	}
+	if h.Returns >= 0 && len(results) != h.Returns {
+		fmt.Fprintf(ip.stdout, "%s returned %d values instead of %d\n", name, len(results), h.Returns)
+		ip.exit(1)
+	}
+	// Nothing is pushed unless every result can be
+	values := make([]stackVal, len(results))
+	for i, r := range results {
+		v, err := redvalue(r)
+		if err != nil {
+			fmt.Fprintf(ip.stdout, "%s returned %T, which is not a number, string, bool or array\n", name, r)
+			ip.exit(1)
+		}
+		values[i] = v
+	}
+	ip.pushto(stack, values...)
+}
+
+// Convert a RED value for the caller
+func govalue(v stackVal) interface{} {
+	switch v.dtype {
+	case 1:
+		return v.sval
+	case 2:
+		return v.bval
+	case 4:
+		list := make([]interface{}, len(v.list))
+		for i, item := range v.list {
+			list[i] = govalue(item)
+		}
+		return list
+	}
+	return v.val
+}
+
+// Convert a Go value to a RED one
+func redvalue(value interface{}) (stackVal, error) {
+	switch v := value.(type) {
+	case float64:
+		return stackVal{dtype: 0, val: v}, nil
+	case string:
+		return stackVal{dtype: 1, sval: v}, nil
+	case bool:
+		return stackVal{dtype: 2, bval: v}, nil
+	case []interface{}:
+		list := make([]stackVal, len(v))
+		for i, item := range v {
+			val, err := redvalue(item)
+			if err != nil {
+				return stackVal{}, err
+			}
+			list[i] = val
+		}
+		return stackVal{dtype: 4, list: list}, nil
+	case []float64:
+		list := make([]stackVal, len(v))
+		for i, item := range v {
+			list[i] = stackVal{dtype: 0, val: item}
+		}
+		return stackVal{dtype: 4, list: list}, nil
+	case []string:
+		list := make([]stackVal, len(v))
+		for i, item := range v {
+			list[i] = stackVal{dtype: 1, sval: item}
+		}
+		return stackVal{dtype: 4, list: list}, nil
+	}
+	// Every other number, whatever its size or sign
+	switch r := reflect.ValueOf(value); r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return stackVal{dtype: 0, val: float64(r.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return stackVal{dtype: 0, val: float64(r.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return stackVal{dtype: 0, val: r.Float()}, nil
+	}
+	return stackVal{}, fmt.Errorf("red: cannot use %T as a value", value)
+}
+
+// Remembers the last line written so an error can say what went wrong
+type lastline struct {
+	w    io.Writer
+	line string
+	part string
+}
+
+func (l *lastline) Write(p []byte) (int, error) {
+	lines := strings.Split(l.part+string(p), "\n")
+	l.part = lines[len(lines)-1]
+	if len(lines) > 1 {
+		l.line = lines[len(lines)-2]
+	}
+	return l.w.Write(p)
+}
+
+// Run part of the interpreter for a caller, turning EXIT and errors into an Error. The state is
+// cleaned up after an error so the Interpreter can still be used
+func (ip *Interpreter) guard(ctx context.Context, f func()) (err error) {
+	out := ip.stdout
+	last := &lastline{w: out}
+	ip.stdout = last
+	if ip.limits.Time > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ip.limits.Time)
+		defer cancel()
+	}
+	ip.ctx, ip.steps, ip.cause = ctx, 0, nil
+	if ip.limits.Memory > 0 {
+		ip.recount()
+	}
+	defer func() {
+		ip.stdout = out
+		ip.ctx = nil
+		r := recover()
+		if r == nil {
+			return
+		}
+		code := 1
+		if e, ok := r.(replerror); ok {
+			code = e.code
+		} else {
+			last.line = panicmessage(r)
+			fmt.Fprintln(out, last.line)
+		}
+		ip.unwind()
+		if code != 0 {
+			msg := last.part
+			if strings.TrimSpace(msg) == "" {
+				msg = last.line
+			}
+			err = &Error{Code: code, Message: strings.TrimSpace(msg), err: ip.cause}
+		}
+	}()
+	f()
+	return nil
+}
@@ -0,0 +1,865 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// An interpreter printing into a buffer
+func newtestinterpreter() (*Interpreter, *strings.Builder) {
+	ip := New()
+	var out strings.Builder
+	ip.SetOutput(&out)
+	return ip, &out
+}
+
+func TestRunKeepsState(t *testing.T) {
+	ip, out := newtestinterpreter()
+	if err := ip.Set("n", 5); err != nil {
+		t.Fatal(err)
+	}
+	ip.Load("double.red", "LOAD n\nPUSH 2\nMULT\nSTORE n\nFUNC greet\nPUSH \"hi\"\nPRINT\nENDFUNC")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := ip.Get("n"); !ok || n != 10.0 {
+		t.Errorf("n is %v, want 10", n)
+	}
+
+	// Later programs see what earlier ones defined
+	ip.Load("more.red", "LOAD n\nPUSH true\nPUSH \"x\"")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ip.Stack(), []interface{}{10.0, true, "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stack is %v, want %v", got, want)
+	}
+	if err := ip.Call("greet"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hi\n" {
+		t.Errorf("printed %q, want %q", out.String(), "hi\n")
+	}
+}
+
+func TestValues(t *testing.T) {
+	ip, _ := newtestinterpreter()
+	if err := ip.Set("list", []interface{}{1, "two", false}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ip.Get("list"); !reflect.DeepEqual(got, []interface{}{1.0, "two", false}) {
+		t.Errorf("list is %v", got)
+	}
+	// Numbers of every size and sign become float64
+	for _, n := range []interface{}{int8(-8), int16(16), int32(-32), int64(64), uint(1), uint8(8), uint16(16), uint32(32), uint64(64), uintptr(7), float32(0.5), time.Second} {
+		if err := ip.Set("n", n); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := ip.Get("n"); got != reflect.ValueOf(n).Convert(reflect.TypeOf(0.0)).Interface() {
+			t.Errorf("%T %v is %v", n, n, got)
+		}
+	}
+	if err := ip.Set("bad", struct{}{}); err == nil {
+		t.Error("setting a struct should fail")
+	}
+	if _, ok := ip.Get("missing"); ok {
+		t.Error("missing variable found")
+	}
+	if err := ip.Push(3); err != nil {
+		t.Fatal(err)
+	}
+	if got := ip.Stack(); !reflect.DeepEqual(got, []interface{}{3.0}) {
+		t.Errorf("stack is %v", got)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	ip, out := newtestinterpreter()
+	ip.Load("bad.red", "PUSH 1\nFROB\n")
+	err := ip.Run()
+	var e *Error
+	if !errors.As(err, &e) || e.Code != 1 {
+		t.Fatalf("got %v, want an error with exit code 1", err)
+	}
+	if e.Message == "" || !strings.Contains(out.String(), e.Message) {
+		t.Errorf("message %q is not the last line of the output %q", e.Message, out.String())
+	}
+
+	// The interpreter can still be used after an error
+	ip.Load("good.red", "PUSH 2")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// EXIT without an error is not one for the caller
+	ip.Load("exit.red", "EXIT\nPUSH 3")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ip.Stack(); !reflect.DeepEqual(got, []interface{}{1.0, 2.0}) {
+		t.Errorf("stack is %v", got)
+	}
+	if err := ip.Call("nothing"); err == nil {
+		t.Error("calling an undefined function should fail")
+	}
+}
+
+func TestInput(t *testing.T) {
+	ip, _ := newtestinterpreter()
+	ip.SetInput(strings.NewReader("first\nsecond\n"))
+	ip.Load("input.red", "INPUT\nINPUT")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ip.Stack(); !reflect.DeepEqual(got, []interface{}{"first", "second"}) {
+		t.Errorf("stack is %v", got)
+	}
+
+	// Whole lines with a prompt, then EOF and READALL for the rest
+	ip, out := newtestinterpreter()
+	ip.SetInput(strings.NewReader("a b c\r\nrest\nof it\n"))
+	ip.Load("lines.red", "INPUT \"Line: \"\nEOF\nREADALL\nEOF\nINPUT")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ip.Stack(); !reflect.DeepEqual(got, []interface{}{"a b c", false, "rest\nof it\n", true, ""}) {
+		t.Errorf("stack is %q", got)
+	}
+	if out.String() != "Line: " {
+		t.Errorf("output is %q", out.String())
+	}
+
+	// Interpreters reading standard input take turns at the same buffer
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(f *os.File) {
+		os.Stdin = f
+		stdin.once, stdin.reader = sync.Once{}, nil
+	}(os.Stdin)
+	os.Stdin = r
+	stdin.once, stdin.reader = sync.Once{}, nil
+	w.WriteString("one\ntwo\n")
+	w.Close()
+	for _, want := range []string{"one", "two"} {
+		ip := New()
+		ip.Load("stdin.red", "INPUT")
+		if err := ip.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got := ip.Stack(); !reflect.DeepEqual(got, []interface{}{want}) {
+			t.Errorf("stack is %q, want %q", got, want)
+		}
+	}
+}
+
+// Interpreters running at the same time must not see each other's variables
+func TestConcurrentInterpreters(t *testing.T) {
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ip, out := newtestinterpreter()
+			ip.Set("n", i)
+			for j := 0; j < 100; j++ {
+				ip.Load("count.red", "LOAD n\nPUSH 1\nADD\nSTORE n")
+				if err := ip.Run(); err != nil {
+					errs <- err
+					return
+				}
+			}
+			ip.Load("print.red", "LOAD n\nPRINT")
+			if err := ip.Run(); err != nil {
+				errs <- err
+				return
+			}
+			if got, want := out.String(), fmt.Sprintf("%d\n", i+100); got != want {
+				errs <- fmt.Errorf("interpreter %d printed %q, want %q", i, got, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	ip, out := newtestinterpreter()
+	prices := map[string]float64{"apple": 1.5}
+	err := ip.Register("PRICE", Keyword{Args: []string{"string"}, Returns: 1, Func: func(args []interface{}) ([]interface{}, error) {
+		p, ok := prices[args[0].(string)]
+		if !ok {
+			return nil, fmt.Errorf("no price for %s", args[0])
+		}
+		return []interface{}{p}, nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged []string
+	ip.Register("LOGLINE", Keyword{Args: []string{"any", "string"}, Func: func(args []interface{}) ([]interface{}, error) {
+		logged = append(logged, fmt.Sprint(args...))
+		return nil, nil
+	}})
+
+	ip.Load("shop.red", "PUSH 7\nPUSH \"apple\"\nPRICE\nSTORE p\nPUSH 1\nPUSH \"done\"\nLOGLINE")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := ip.Get("p"); p != 1.5 {
+		t.Errorf("p is %v, want 1.5", p)
+	}
+	if got := ip.Stack(); !reflect.DeepEqual(got, []interface{}{7.0}) {
+		t.Errorf("stack is %v", got)
+	}
+	if !reflect.DeepEqual(logged, []string{"1done"}) {
+		t.Errorf("logged %v", logged)
+	}
+
+	// Registered keywords stay when the state is reset and work inside functions
+	ip.initstate()
+	ip.Load("func.red", "FUNC f\nPUSH \"apple\"\nPRICE\nENDFUNC\nRUN f")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Module functions call them on their own stack
+	ip.initstate()
+	out.Reset()
+	ip.SetFiles(map[string][]byte{"shop.mred": []byte("FUNC cost\nPUSH \"apple\"\nPRICE\nPRINT\nENDFUNC")})
+	ip.Load("module.red", "IMPORT shop.mred shop\nMODRUN shop cost")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "1.5\n" || len(ip.Stack()) != 0 {
+		t.Errorf("printed %q and left %v on the stack", out.String(), ip.Stack())
+	}
+	ip.SetFiles(nil)
+
+	for _, c := range []struct{ code, msg string }{
+		{"PUSH \"pear\"\nPRICE", "PRICE failed: no price for pear"},
+		{"PUSH 3\nPRICE", "PRICE argument 1 must be string, got number"},
+		{"PRICE", "PRICE expects 1 value on the stack, got 0"},
+	} {
+		ip.initstate()
+		out.Reset()
+		ip.Load("bad.red", c.code)
+		if err := ip.Run(); err == nil || err.Error() != c.msg {
+			t.Errorf("%q: got error %v, want %q", c.code, err, c.msg)
+		}
+	}
+
+	if ip.Register("PUSH", Keyword{Func: func([]interface{}) ([]interface{}, error) { return nil, nil }}) == nil {
+		t.Error("replacing a core keyword should fail")
+	}
+	if ip.Register("ODD", Keyword{Args: []string{"list"}, Func: func([]interface{}) ([]interface{}, error) { return nil, nil }}) == nil {
+		t.Error("an unknown argument type should fail")
+	}
+
+	// A result that cannot be converted leaves the stack as it was, without the results before it
+	ip.Register("HALF", Keyword{Returns: 2, Func: func([]interface{}) ([]interface{}, error) {
+		return []interface{}{1, map[string]int{}}, nil
+	}})
+	ip.initstate()
+	ip.Load("half.red", "PUSH 7\nHALF")
+	if err := ip.Run(); err == nil || err.Error() != "HALF returned map[string]int, which is not a number, string, bool or array" {
+		t.Errorf("got error %v", err)
+	}
+	if got := ip.Stack(); !reflect.DeepEqual(got, []interface{}{7.0}) {
+		t.Errorf("stack is %v, want [7]", got)
+	}
+
+	// The prefix of a loaded keyword library cannot be taken over
+	ip.Load("lib.red", "KEYWORD SHOP OPEN\nPUSH 1\nENDKEYWORD")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	err = ip.Register("SHOP", Keyword{Func: func([]interface{}) ([]interface{}, error) { return nil, nil }})
+	if err == nil || err.Error() != "red: SHOP is the prefix of the keyword library loaded from lib.red" {
+		t.Errorf("got error %v", err)
+	}
+}
+
+// Calls to keyword cases are checked against their parameters, the errors start with the line
+// making the call
+func TestKeywordArguments(t *testing.T) {
+	lib := "KEYWORD UTIL SET name:string value:any\n\tLOADARG value\n\tSTORE name\nENDKEYWORD\n" +
+		"KEYWORD UTIL REPEAT text:string count:number=2 loud:bool=false\n\tLOADARG text\n\tLOADARG count\n\tLOADARG loud\nENDKEYWORD\n" +
+		"KEYWORD UTIL ONE x:number\n\tLOADARG x\nENDKEYWORD\n" +
+		"KEYWORD UTIL NONE\n\tPUSH 0\nENDKEYWORD"
+	for _, c := range []struct {
+		code  string
+		stack []interface{}
+		msg   string
+	}{
+		{"UTIL SET \"x\" 5\nLOAD x", []interface{}{5.0}, ""},
+		{"UTIL REPEAT \"a\"", []interface{}{"a", 2.0, false}, ""},
+		{"UTIL REPEAT \"a\" 3", []interface{}{"a", 3.0, false}, ""},
+		{"UTIL REPEAT \"a b\" 3 true", []interface{}{"a b", 3.0, true}, ""},
+		{"UTIL NONE", []interface{}{0.0}, ""},
+		{"PUSH 1\nUTIL SET \"x\"", nil, "main.red:3: UTIL SET expects 2 arguments (name:string, value:any), got 1"},
+		{"UTIL SET \"x\" 1 2", nil, "main.red:2: UTIL SET expects 2 arguments (name:string, value:any), got 3"},
+		{"UTIL REPEAT", nil, "main.red:2: UTIL REPEAT expects 1 to 3 arguments (text:string, count:number?, loud:bool?), got 0"},
+		{"UTIL ONE", nil, "main.red:2: UTIL ONE expects 1 argument (x:number), got 0"},
+		{"UTIL SET 1 2", nil, "main.red:2: UTIL SET argument name must be string, got number"},
+		{"UTIL REPEAT \"a\" \"b\"", nil, "main.red:2: UTIL REPEAT argument count must be number, got string"},
+		{"UTIL NONE 1", nil, "main.red:2: UTIL NONE expects 0 arguments (), got 1"},
+		{"UTIL ONE x", nil, "main.red:2: Invalid argument: x"},
+		{"FUNC f\nUTIL ONE true\nENDFUNC\nRUN f", nil, "main.red:3: UTIL ONE argument x must be number, got bool"},
+	} {
+		ip, _ := newtestinterpreter()
+		ip.SetFiles(map[string][]byte{"util.kr": []byte(lib)})
+		ip.Load("main.red", "KEYPORT util.kr\n"+c.code)
+		err := ip.Run()
+		if c.msg == "" && err != nil {
+			t.Errorf("%q: %v", c.code, err)
+		} else if c.msg != "" && (err == nil || err.Error() != c.msg) {
+			t.Errorf("%q: got error %v, want %q", c.code, err, c.msg)
+		} else if c.msg == "" && !reflect.DeepEqual(ip.Stack(), c.stack) {
+			t.Errorf("%q: stack is %v, want %v", c.code, ip.Stack(), c.stack)
+		}
+	}
+}
+
+// The code of a keyword case can use every keyword a function can. Operators work on the top of
+// the stack and the value below it, so PUSH 8 then SUB takes what was below from 8
+func TestKeywordBodies(t *testing.T) {
+	ip, out := newtestinterpreter()
+	ip.SetFiles(map[string][]byte{"m.mred": []byte("EXPORT count 1")})
+	ip.Load("main.red", `IMPORT m.mred m
+FUNC double
+	LOAD n
+	PUSH 2
+	MULT
+	STORE n
+ENDFUNC
+KEYWORD T MATH a:number b:number
+	LOADARG a
+	LOADARG b
+	ADD
+	PUSH 2
+	MULT
+	PUSH 8
+	SUB
+	PUSH 10
+	DIV
+	PRINT
+	PUSH 16
+	SQRT
+	PRINT
+ENDKEYWORD
+KEYWORD T TEXT who:string
+	LOADARG who
+	PUSH "hi "
+	STRCAT
+	PRINT
+	PUSH "3"
+	PUSH 12
+	STR
+	STRCAT
+	FLOAT
+	PUSH 1
+	ADD
+	PRINT
+	PUSH "false"
+	BOOL
+	NOT
+	PRINT
+ENDKEYWORD
+KEYWORD T LOGIC n:number
+	PUSH 3
+	LOADARG n
+	GT
+	STORE big
+	IF big PUSH "big"
+	IF big PRINT
+	LOAD big
+	PUSH false
+	AND
+	PRINT
+ENDKEYWORD
+KEYWORD T LIST
+	PUSH "a,b,c"
+	SPLIT ,
+	LEN
+	PRINT
+	JOIN
+	PRINT
+	PUSH "x"
+	PUSH "y"
+	MAKEARRAY
+	JOIN
+	PRINT
+ENDKEYWORD
+KEYWORD T SET name:string value
+	LOADARG value
+	STORE name
+ENDKEYWORD
+KEYWORD T STATE
+	PUSH 5
+	STORE n
+	RUN double
+	MODGET m count
+	PUSH 1
+	ADD
+	MODSTORE m count
+	MODGET m count
+	ASSERTEQ 2
+	PUSH 7
+	CLEAR
+ENDKEYWORD
+T MATH 1 2
+T TEXT "you"
+T LOGIC 4
+T LIST
+T SET "x" "set"
+T STATE
+LOAD n
+LOAD x`)
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "5\n4\nhi you\n124\ntrue\nbig\nfalse\n3\nabc\nxy\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+	if got, want := ip.Stack(), []interface{}{10.0, "set"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stack is %v, want %v", got, want)
+	}
+}
+
+// Keyword cases can call other cases, passing on their own arguments, and each sees only its
+// own arguments. Functions they RUN see none of them
+func TestKeywordScopes(t *testing.T) {
+	lib := `KEYWORD T OUTER x:number
+	T INNER x "inner"
+	LOADARG x
+	PRINT
+ENDKEYWORD
+KEYWORD T INNER y:number x:string
+	LOADARG y
+	PUSH 1
+	ADD
+	PRINT
+	LOADARG x
+	PRINT
+ENDKEYWORD
+KEYWORD T CALLS
+	RUN f
+ENDKEYWORD
+KEYWORD T LOOP
+	T LOOP
+ENDKEYWORD
+`
+	for _, c := range []struct{ code, printed, msg string }{
+		{"T OUTER 5", "6\ninner\n5\n", ""},
+		{"FUNC f\nPUSH \"f\"\nPRINT\nENDFUNC\nT CALLS", "f\n", ""},
+		{"FUNC f\nLOADARG term0\nENDFUNC\nT CALLS", "", "Undefined argument: term0"},
+		{"T LOOP", "", "Recursion limit of 100 calls exceeded in T LOOP"},
+	} {
+		ip, out := newtestinterpreter()
+		ip.Load("main.red", lib+c.code)
+		err := ip.Run()
+		if c.msg == "" && err != nil {
+			t.Errorf("%q: %v", c.code, err)
+		} else if c.msg != "" && (err == nil || err.Error() != c.msg) {
+			t.Errorf("%q: got error %v, want %q", c.code, err, c.msg)
+		}
+		if c.msg == "" && out.String() != c.printed {
+			t.Errorf("%q: printed %q, want %q", c.code, out.String(), c.printed)
+		}
+	}
+}
+
+// Keyword libraries are written as KEYWORD blocks or as JSON, mistakes in them are reported
+// with where they are
+func TestKeywordFiles(t *testing.T) {
+	native := `// Greetings
+MCOMM
+PUSH 1 is not run
+ENDCOMM
+KEYWORD GREET HELLO who:string greeting:string="Hello" times:number=1
+	LOADARG who
+	PUSH " "
+	LOADARG greeting
+	STRCAT
+	STRCAT
+	PRINT
+	LOADARG times
+ENDKEYWORD
+
+KEYWORD GREET ANY value
+	LOADARG value
+ENDKEYWORD`
+	json := `{"prefix": "JS", "main": [
+	{"case": "ADD", "params": [{"name": "a", "type": "number"}, {"name": "b", "type": "number", "default": 10}], "code": [
+		"LOADARG a",
+		"LOADARG b",
+		"ADD"
+	]}
+]}`
+	for _, c := range []struct{ file, code, msg, printed string }{
+		{native, "GREET HELLO \"you\"\nGREET HELLO \"you\" 'Hi' 2\nGREET ANY true", "", "Hello you\nHi you\n"},
+		{json, "JS ADD 1\nPRINT\nJS ADD 1 2\nPRINT", "", "11\n3\n"},
+		{"KEYWORD GREET\nENDKEYWORD", "", "Invalid keyword definition at lib.kr:1: expected KEYWORD PREFIX CASE followed by its parameters", ""},
+		{"KEYWORD GREET HELLO\nENDKEYWORD\n\nKEYWORD GREET BYE\n\tPUSH 1", "", "Invalid keyword file lib.kr:4: KEYWORD without ENDKEYWORD", ""},
+		{"PUSH 1", "", "Invalid keyword file lib.kr:1: only KEYWORD blocks and comments are allowed", ""},
+		{"KEYWORD GREET HELLO n:number=\"one\"\nENDKEYWORD", "", "Invalid keyword definition at lib.kr:1: GREET HELLO parameter n default must be number", ""},
+		{"KEYWORD GREET HELLO a=1 b\nENDKEYWORD", "", "Invalid keyword definition at lib.kr:1: GREET HELLO parameter b without a default follows one with a default", ""},
+		{"KEYWORD GREET HELLO a:list\nENDKEYWORD", "", "Invalid keyword definition at lib.kr:1: parameter a has unknown type list", ""},
+		{"KEYWORD GREET HELLO\nENDKEYWORD\nKEYWORD GREET HELLO\nENDKEYWORD", "", "Invalid keyword definition at lib.kr:3: GREET HELLO is already defined at lib.kr:1", ""},
+		{"{\"prefix\": \"JS\",\n\"main\": [\n\t{\"case\": \"A\" \"code\": []}\n]}", "", "Invalid keyword file lib.kr: line 3: invalid character '\"' after object key:value pair", ""},
+		{`{"prefix": "JS", "main": {}}`, "", "Invalid keyword file lib.kr: main must be a list of cases", ""},
+		{`{"prefix": "J S", "main": []}`, "", "Invalid keyword file lib.kr: prefix must be a single word", ""},
+		{`{"prefix": "JS", "main": [{"case": "A", "code": [1]}]}`, "", "Invalid keyword file lib.kr: JS A code line 1 must be a string", ""},
+		{`{"prefix": "JS", "main": [{"case": "A", "params": [{"name": "x", "type": "text"}], "code": []}]}`, "", "Invalid keyword file lib.kr: JS A parameter x has unknown type text", ""},
+	} {
+		ip, out := newtestinterpreter()
+		ip.SetFiles(map[string][]byte{"lib.kr": []byte(c.file)})
+		ip.Load("main.red", "KEYPORT lib.kr\n"+c.code)
+		err := ip.Run()
+		if c.msg == "" && err != nil {
+			t.Errorf("%q: %v", c.code, err)
+		} else if c.msg != "" && (err == nil || err.Error() != c.msg) {
+			t.Errorf("%q: got error %v, want %q", c.file, err, c.msg)
+		}
+		if c.msg == "" && out.String() != c.printed {
+			t.Errorf("%q: printed %q, want %q", c.code, out.String(), c.printed)
+		}
+	}
+}
+
+func TestKeywordPrefixes(t *testing.T) {
+	files := map[string][]byte{
+		"shop.kr":    []byte("KEYWORD PRICE OF\nPUSH 1\nENDKEYWORD"),
+		"greet.kr":   []byte("KEYWORD GREET HELLO\nPUSH \"hello\"\nPRINT\nENDKEYWORD"),
+		"greet2.kr":  []byte("KEYWORD GREET BYE\nPUSH \"bye\"\nPRINT\nENDKEYWORD"),
+		"push.kr":    []byte("KEYWORD PUSH TWICE\nPUSH 2\nENDKEYWORD"),
+		"print.kr":   []byte(`{"prefix": "PRINT", "main": [{"case": "TWICE", "code": ["PRINT"]}]}`),
+		"shout.mred": []byte("EXPORT x 1\nKEYWORD GREET SHOUT\nPUSH \"HI\"\nPRINT\nENDKEYWORD"),
+	}
+	for _, c := range []struct{ code, msg, out string }{
+		{"KEYPORT shop.kr", "Keyword prefix PRICE from shop.kr clashes with the registered keyword PRICE, use KEYPORT shop.kr AS <prefix> to rename it", ""},
+		{"KEYPORT push.kr", "Invalid keyword definition at push.kr:1: PUSH is a core keyword and cannot be used as a keyword prefix", ""},
+		{"KEYPORT print.kr", "Keyword prefix PRINT from print.kr is a reserved core keyword, use KEYPORT print.kr AS <prefix> to rename it", ""},
+		{"KEYPORT greet.kr AS PUSH", "Cannot use KEYPORT greet.kr AS PUSH as PUSH is a reserved core keyword, use another prefix", ""},
+		{"KEYPORT greet.kr AS PRICE", "Cannot use KEYPORT greet.kr AS PRICE as PRICE is a registered keyword, use another prefix", ""},
+		{"KEYPORT greet.kr EXTEND PRINT", "Cannot use KEYPORT greet.kr EXTEND PRINT as PRINT is a reserved core keyword, use another prefix", ""},
+		{"KEYPORT greet.kr\nKEYPORT greet2.kr", "Keyword prefix GREET from greet2.kr is already loaded from greet.kr, use KEYPORT greet2.kr AS <prefix> to load it under another name or KEYPORT greet2.kr EXTEND GREET to add its cases", ""},
+		{"KEYPORT shop.kr AS SHOP\nKEYPORT greet.kr\nKEYPORT greet2.kr EXTEND GREET\nGREET HELLO\nGREET BYE", "", "hello\nbye\n"},
+
+		// KEYWORD blocks in a program or module are checked the same way
+		{"KEYWORD PRICE OF\nPUSH 1\nENDKEYWORD", "Keyword prefix PRICE at prefixes.red:1 clashes with the registered keyword PRICE, use another prefix", ""},
+		{"KEYPORT greet.kr\nKEYWORD GREET SHOUT\nPUSH 1\nENDKEYWORD", "Keyword prefix GREET at prefixes.red:2 is already loaded from greet.kr, use another prefix or move the case into a file loaded with KEYPORT file EXTEND GREET", ""},
+		{"KEYPORT greet.kr\nIMPORT shout.mred s", "Keyword prefix GREET at shout.mred:2 is already loaded from greet.kr, use another prefix or move the case into a file loaded with KEYPORT file EXTEND GREET", ""},
+		{"KEYWORD GREET SHOUT\nPUSH 1\nENDKEYWORD\nKEYPORT greet.kr", "Keyword prefix GREET from greet.kr is already loaded from prefixes.red, use KEYPORT greet.kr AS <prefix> to load it under another name or KEYPORT greet.kr EXTEND GREET to add its cases", ""},
+		{"IMPORT shout.mred s\nKEYWORD LOUD A\nPUSH \"a\"\nPRINT\nENDKEYWORD\nKEYWORD LOUD B\nPUSH \"b\"\nPRINT\nENDKEYWORD\nLOUD A\nLOUD B\nGREET SHOUT", "", "a\nb\nHI\n"},
+	} {
+		ip, out := newtestinterpreter()
+		ip.Register("PRICE", Keyword{Func: func([]interface{}) ([]interface{}, error) { return nil, nil }})
+		ip.SetFiles(files)
+		ip.Load("prefixes.red", c.code)
+		err := ip.Run()
+		if c.msg == "" {
+			if err != nil || out.String() != c.out {
+				t.Errorf("%q: got error %v and printed %q, want %q", c.code, err, out.String(), c.out)
+			}
+		} else if err == nil || err.Error() != c.msg {
+			t.Errorf("%q: got error %v, want %q", c.code, err, c.msg)
+		}
+	}
+}
+
+func TestBundle(t *testing.T) {
+	files := map[string][]byte{
+		"main.red":         []byte("// IMPORT comment.mred c\nKEYPORT lib.kr\nPUSH \"IMPORT string.mred\"\nPUSH true\nSTORE c\nIF c IMPORT m.mred m"),
+		"m.mred":           []byte("EXPORT a 1\nKEYPORT built-in/math.kr"),
+		"lib.kr":           []byte(`{"prefix": "LIB", "main": [{"case": "GO", "code": ["PUSH 1", "IMPORT json.mred j"]}]}`),
+		"json.mred":        []byte("EXPORT b 1"),
+		"built-in/util.kr": []byte("KEYWORD UTIL NOP\nENDKEYWORD"),
+	}
+	ip, out := newtestinterpreter()
+	ip.SetFiles(files)
+	got, err := ip.Bundle("main.red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range got {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"built-in/util.kr", "json.mred", "lib.kr", "m.mred", "main.red"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("bundled %v, want %v", names, want)
+	}
+	if want := "m.mred:2: warning: built-in/math.kr is left out, the program downloads the built-in folder when it runs\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+
+	// Files that are not there stop the build with the line that loads them
+	for _, c := range []struct{ name, code, msg string }{
+		{"module.red", "PUSH 1\nIMPORT missing.mred m", "module.red:2: cannot find module missing.mred"},
+		{"keyport.red", "KEYPORT missing.kr", "keyport.red:1: cannot find keyword file missing.kr"},
+		{"nested.red", "KEYPORT nested.kr", "nested.kr:3: cannot find module missing.mred"},
+	} {
+		files[c.name] = []byte(c.code)
+		files["nested.kr"] = []byte("{\"prefix\": \"N\", \"main\": [\n\t{\"case\": \"A\", \"code\": [\n\t\t\"IMPORT missing.mred m\"\n\t]}\n]}")
+		ip.SetFiles(files)
+		if _, err := ip.Bundle(c.name); err == nil || err.Error() != c.msg {
+			t.Errorf("%s: got error %v, want %q", c.name, err, c.msg)
+		}
+	}
+}
+
+// Modules are found next to the file that imports them and in the vendor folders above it, not in
+// the folder red runs from
+func TestImportPaths(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "vendor", "json"), 0755)
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	os.WriteFile(filepath.Join(dir, "vendor", "json", "json.mred"), []byte("EXPORT v 2"), 0644)
+	os.WriteFile(filepath.Join(dir, "src", "m.mred"), []byte("EXPORT v 1"), 0644)
+	os.WriteFile(filepath.Join(dir, "src", "main.red"), []byte("IMPORT m.mred m\nIMPORT json/json.mred j\nMODGET m v\nMODGET j v\nADD\nPRINT"), 0644)
+
+	ip, out := newtestinterpreter()
+	if err := ip.LoadFile(filepath.Join(dir, "src", "main.red")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "3\n" {
+		t.Errorf("printed %q, want %q", out.String(), "3\n")
+	}
+}
+
+// A program that never ends, f loops for as long as forever stays true
+const endless = "PUSH true\nSTORE forever\nFUNC f\nPUSH 1\nSTORE x\nENDFUNC\nRUN f forever"
+
+func TestLimits(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		limits Limits
+		code   string
+		msg    string
+	}{
+		{"steps", Limits{Steps: 1000}, endless, "Step limit of 1000 lines exceeded"},
+		{"time", Limits{Time: 50 * time.Millisecond}, endless, "Time limit of 50ms exceeded"},
+		{"sleep", Limits{Time: 50 * time.Millisecond}, "PUSH 60000\nDELAYST", "Time limit of 50ms exceeded"},
+		{"empty loop steps", Limits{Steps: 1000}, "PUSH true\nSTORE forever\nFUNC f\nENDFUNC\nRUN f forever", "Step limit of 1000 lines exceeded"},
+		{"empty loop time", Limits{Time: 50 * time.Millisecond}, "PUSH true\nSTORE forever\nFUNC f\n// nothing to do\n\nENDFUNC\nRUN f forever", "Time limit of 50ms exceeded"},
+		{"depth", Limits{Depth: 5}, "FUNC f\nRUN f\nENDFUNC\nRUN f", "Recursion limit of 5 calls exceeded in function f"},
+		{"stack", Limits{Stack: 10}, "PUSH true\nSTORE forever\nFUNC f\nPUSH 1\nENDFUNC\nRUN f forever", "Stack limit of 10 values exceeded"},
+		{"memory", Limits{Memory: 100000}, "PUSH true\nSTORE forever\nPUSH \"text\"\nSTORE s\nFUNC f\nLOAD s\nLOAD s\nSTRCAT\nSTORE s\nENDFUNC\nRUN f forever", "Memory limit of 100000 bytes exceeded"},
+		{"memory stack", Limits{Memory: 100000}, "PUSH true\nSTORE forever\nFUNC f\nPUSH \"text\"\nENDFUNC\nRUN f forever", "Memory limit of 100000 bytes exceeded"},
+		{"memory array", Limits{Memory: 100000}, "PUSH true\nSTORE forever\nPUSH 1\nMAKEARRAY\nSTORE one\nPUSH 1\nMAKEARRAY\nFUNC f\nLOAD one\nAPPEND\nENDFUNC\nRUN f forever", "Memory limit of 100000 bytes exceeded"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ip, _ := newtestinterpreter()
+			ip.SetLimits(c.limits)
+			ip.Load(c.name+".red", c.code)
+			err := ip.Run()
+			if err == nil || err.Error() != c.msg {
+				t.Fatalf("got error %v, want %q", err, c.msg)
+			}
+			if c.name == "time" && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("%v is not context.DeadlineExceeded", err)
+			}
+		})
+	}
+
+	// Values that are taken off the stack again stay within the limit however long it runs
+	ip, out := newtestinterpreter()
+	ip.SetLimits(Limits{Memory: 10000})
+	ip.Load("steady.red", "PUSH 0\nSTORE n\nPUSH true\nSTORE more\nFUNC f\nLOAD n\nPUSH 1\nADD\nSTORE n\nPUSH \"text\"\nMAKEARRAY\nSTORE a\nPUSH 2000\nLOAD n\nLT\nSTORE more\nENDFUNC\nRUN f more")
+	if err := ip.Run(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if n, _ := ip.Get("n"); n != 2000.0 {
+		t.Errorf("the loop ran %v times, want 2000", n)
+	}
+
+	// Limits count from the start of every Run
+	ip, _ = newtestinterpreter()
+	ip.SetLimits(Limits{Steps: 3})
+	for i := 0; i < 3; i++ {
+		ip.Load("short.red", "PUSH 1\nSTORE x")
+		if err := ip.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ip, _ := newtestinterpreter()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	ip.Load("endless.red", endless)
+	if err := ip.RunContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	// Also when the loop has nothing in it
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	ip.Load("empty.red", "PUSH true\nSTORE forever\nFUNC f\nENDFUNC\nRUN f forever")
+	if err := ip.RunContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	// Also while it waits for input, the line it was waiting for is read by the next INPUT
+	in, w := io.Pipe()
+	ip.SetInput(in)
+	ip.SetLimits(Limits{Time: 50 * time.Millisecond})
+	ip.Load("input.red", "INPUT")
+	if err := ip.Run(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	go w.Write([]byte("late\n"))
+	ip.SetLimits(Limits{})
+	ip.Load("input.red", "CLEAR\nINPUT")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ip.Stack(); !reflect.DeepEqual(got, []interface{}{"late"}) {
+		t.Errorf("stack is %v", got)
+	}
+
+	// A cancelled program leaves the interpreter usable
+	ip.Load("more.red", "PUSH 1")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDisable(t *testing.T) {
+	ip, _ := newtestinterpreter()
+	ip.Disable("INPUT", "KEYPORT", "IMPORT", "UTIL")
+	for _, code := range []string{"INPUT", "KEYPORT built-in/util.kr", "IMPORT m.mred", "PUSH true\nSTORE c\nFUNC f\nIF c INPUT\nENDFUNC\nRUN f", "UTIL PRINT \"x\""} {
+		ip.Load("disabled.red", code)
+		err := ip.Run()
+		op := strings.Fields(code)[0]
+		if op == "PUSH" {
+			op = "INPUT"
+		}
+		if err == nil || err.Error() != op+" is disabled" {
+			t.Errorf("%q: got error %v, want %q", code, err, op+" is disabled")
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	code := "RANDINT 0 1000\nPUSH 1\nPUSH 2\nRANDFLOAT\nPUSH \"a,b,c,d,e\"\nSPLIT ,\nSHUFFLE\nJOIN\nPUSH \"a,b,c\"\nSPLIT ,\nRANDCHOICE"
+	run := func(seed int64) []interface{} {
+		ip, out := newtestinterpreter()
+		ip.Seed(seed)
+		ip.Load("random.red", code)
+		if err := ip.Run(); err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		return ip.Stack()
+	}
+	first := run(7)
+	if !reflect.DeepEqual(first, run(7)) {
+		t.Errorf("the same seed gave %v and %v", first, run(7))
+	}
+	if f := first[1].(float64); f < 1 || f >= 2 {
+		t.Errorf("RANDFLOAT 1 2 gave %v", f)
+	}
+	if s := first[2].(string); len(s) != 5 || strings.Count(s, "a")+strings.Count(s, "e") != 2 {
+		t.Errorf("SHUFFLE gave %q", s)
+	}
+
+	// SEED in the program does the same as Seed
+	ip, _ := newtestinterpreter()
+	ip.Load("seed.red", "SEED 7\n"+code)
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ip.Stack(), first) {
+		t.Errorf("SEED 7 gave %v, want %v", ip.Stack(), first)
+	}
+
+	ip, _ = newtestinterpreter()
+	ip.Load("secure.red", "SEED SECURE\nRANDINT 5 6\nPUSH 3\nSTORE n\nRANDFLOAT 0 n")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ip.Stack(); got[0] != 5.0 || got[1].(float64) >= 3 {
+		t.Errorf("secure random numbers out of range: %v", got)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	ip, out := newtestinterpreter()
+	ip.SetArgs("easy", "10")
+	t.Setenv("RED_TEST_NAME", "red")
+	t.Setenv("RED_TEST_OTHER", "")
+	ip.Load("args.red", "ARGS\nARGC\nGETENV RED_TEST_NAME\nPUSH \"set\"\nSETENV RED_TEST_OTHER\nPUSH 3\nSTORE code\nEXIT code\nPUSH 1")
+	err := ip.Run()
+	var e *Error
+	if !errors.As(err, &e) || e.Code != 3 {
+		t.Fatalf("EXIT code gave %v: %s", err, out)
+	}
+	if got := ip.Stack(); !reflect.DeepEqual(got, []interface{}{[]interface{}{"easy", "10"}, 2.0, "red"}) {
+		t.Errorf("stack is %v", got)
+	}
+	if v := os.Getenv("RED_TEST_OTHER"); v != "" {
+		t.Errorf("SETENV changed the environment of the process to %q", v)
+	}
+	ip.Load("env.red", "GETENV RED_TEST_OTHER")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ip.Stack(); got[len(got)-1] != "set" {
+		t.Errorf("GETENV after SETENV pushed %v", got[len(got)-1])
+	}
+
+	// Both need the name of a variable
+	for code, want := range map[string]string{
+		"GETENV":                         "Usage: GETENV name",
+		"PUSH \"x\"\nSETENV":             "Usage: SETENV name",
+		"FUNC f\nGETENV\nENDFUNC\nRUN f": "Usage: GETENV name",
+	} {
+		ip.Load("env.red", code)
+		if err := ip.Run(); err == nil || err.Error() != want {
+			t.Errorf("%q: got error %v, want %q", code, err, want)
+		}
+	}
+}
+
+func TestScript(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lib.mred"), []byte("EXPORT x 1\nFUNC hi\nPUSH \"hi\"\nPRINT\nENDFUNC"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ip, out := newtestinterpreter()
+	var trace strings.Builder
+	ip.Trace(&trace)
+	ip.SetIncludePaths(dir)
+	ip.Load("script.red", "#!/usr/bin/env red\nIMPORT lib.mred l\nMODRUN l hi")
+	if err := ip.Run(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if out.String() != "hi\n" {
+		t.Errorf("output is %q", out.String())
+	}
+	want := "script.red:2: IMPORT lib.mred l\nscript.red:3: MODRUN l hi\nlib.mred:3: PUSH \"hi\"\nlib.mred:4: PRINT\n"
+	if trace.String() != want {
+		t.Errorf("trace is %q, want %q", trace.String(), want)
+	}
+}
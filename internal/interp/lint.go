@@ -0,0 +1,480 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The rules of the linter and what they look for
+var lintrules = map[string]string{
+	"constant-reassigned": "storing into PI or EULER",
+	"infinite-loop":       "functions run with a condition that nothing inside them changes",
+	"unused-variable":     "variables stored but never used",
+	"unused-function":     "functions that are never run",
+	"load-before-store":   "variables used before anything stores into them",
+	"unreachable-code":    "lines after an EXIT that can never run",
+	"unused-import":       "modules imported but never used",
+}
+
+// A variable name used by a line, w is the word that names it
+type varuse struct {
+	name string
+	w    srcword
+}
+
+// The words of a line after its IF conditions, and the conditions
+func unwrapif(words []srcword) ([]srcword, []srcword) {
+	var conds []srcword
+	for len(words) > 2 && words[0].text == "IF" {
+		conds = append(conds, words[1])
+		words = words[2:]
+	}
+	return conds, words
+}
+
+// The variables a line reads and stores into, a keyword case uses the variables named by its
+// string arguments and those its code names directly
+func (e *srcenv) varuses(l srcline) (reads []varuse, writes []varuse) {
+	conds, words := unwrapif(l.words)
+	for _, c := range conds {
+		reads = append(reads, varuse{c.text, c})
+	}
+	if l.comment || len(words) < 2 {
+		return
+	}
+	op := words[0].text
+	args := words[1:]
+	switch op {
+	case "LOAD":
+		reads = append(reads, varuse{args[0].text, args[0]})
+		if len(args) > 1 {
+			if _, err := strconv.Atoi(args[1].text); err == nil {
+				break
+			}
+			reads = append(reads, varuse{args[1].text, args[1]})
+		}
+	case "STORE":
+		writes = append(writes, varuse{args[0].text, args[0]})
+	case "RUN":
+		if len(args) > 1 {
+			reads = append(reads, varuse{args[1].text, args[1]})
+		}
+	case "RANDINT", "RANDFLOAT", "SEED", "EXIT":
+		for _, a := range args {
+			if _, err := strconv.ParseFloat(a.text, 64); err != nil && a.text != "SECURE" {
+				reads = append(reads, varuse{a.text, a})
+			}
+		}
+	}
+	c, ok := e.keymods[op].cases[args[0].text]
+	if _, core := keywordinfos[op]; core || !ok {
+		return
+	}
+	for _, code := range c.code {
+		fields := strings.Fields(code)
+		if len(fields) != 2 || (fields[0] != "LOAD" && fields[0] != "STORE") {
+			continue
+		}
+		use := varuse{fields[1], words[0]}
+		i := -1
+		if n, err := strconv.Atoi(strings.TrimPrefix(fields[1], "term")); err == nil && c.params == nil && strings.HasPrefix(fields[1], "term") {
+			i = n
+		}
+		for n, p := range c.params {
+			if p.name == fields[1] {
+				i = n
+			}
+		}
+		if i >= 0 {
+			if i+1 >= len(args) {
+				continue
+			}
+			v, ok := parseliteral(args[i+1].text)
+			if !ok || v.dtype != 1 {
+				continue
+			}
+			use = varuse{v.sval, args[i+1]}
+		}
+		if fields[0] == "LOAD" {
+			reads = append(reads, use)
+		} else {
+			writes = append(writes, use)
+		}
+	}
+	return
+}
+
+// The lines of a function, without its FUNC and ENDFUNC
+func funclines(f *srcfile, b srcblock) []srcline {
+	if b.end == 0 {
+		return nil
+	}
+	return f.lines[b.line : b.end-1]
+}
+
+// Read the linter settings of a file from the nearest .redlint.json in its directory or above,
+// which turns rules on and off like {"rules": {"unused-variable": false}}
+func lintconfig(path string, readfile func(path string) ([]byte, error)) (map[string]bool, error) {
+	enabled := make(map[string]bool)
+	for name := range lintrules {
+		enabled[name] = true
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return enabled, nil
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		config := filepath.Join(dir, ".redlint.json")
+		if bytes, err := readfile(config); err == nil {
+			var settings struct {
+				Rules map[string]bool
+			}
+			if err := json.Unmarshal(bytes, &settings); err != nil {
+				return enabled, fmt.Errorf("%s: %v", config, err)
+			}
+			for name, on := range settings.Rules {
+				if _, ok := lintrules[name]; !ok {
+					return enabled, fmt.Errorf("%s: unknown rule %s", config, name)
+				}
+				enabled[name] = on
+			}
+			return enabled, nil
+		}
+		if filepath.Dir(dir) == dir {
+			return enabled, nil
+		}
+	}
+}
+
+// Look for common mistakes in a file. A comment holding lint:ignore, optionally followed by
+// rule names separated by commas, silences the next line and lint:ignore-file the whole file
+func (e *srcenv) lint(enabled map[string]bool) []problem {
+	f := e.file
+	var found []problem
+	report := func(rule string, n int, w srcword, format string, a ...interface{}) {
+		found = append(found, problem{line: n, col: w.start, end: w.end, msg: fmt.Sprintf(format, a...), warning: true, rule: rule})
+	}
+
+	// Which lines belong to keyword cases, their variables are named by the caller
+	incase := make(map[int]bool)
+	for _, b := range f.keywords {
+		for n := b.line; n <= b.end; n++ {
+			incase[n] = true
+		}
+	}
+	stored := make(map[string]varuse)
+	read := make(map[string]bool)
+	for _, l := range f.lines {
+		reads, writes := e.varuses(l)
+		for _, r := range reads {
+			read[r.name] = true
+		}
+		for _, w := range writes {
+			if _, ok := stored[w.name]; !ok && !(incase[l.n] && e.isparam(l, w.name)) {
+				stored[w.name] = w
+			}
+			if w.name == "PI" || w.name == "EULER" {
+				report("constant-reassigned", l.n, w.w, "%s is a constant, storing into it changes it for the whole program", w.name)
+			}
+		}
+	}
+	line := make(map[string]int)
+	for _, l := range f.lines {
+		_, writes := e.varuses(l)
+		for _, w := range writes {
+			if _, ok := line[w.name]; !ok {
+				line[w.name] = l.n
+			}
+		}
+	}
+
+	// Variables and functions nothing uses, the functions of a module are run from the program
+	// importing it and its variables may be their conditions there
+	if !f.library && !f.module {
+		for _, name := range sortedkeys(stored) {
+			if !read[name] && name != "PI" && name != "EULER" {
+				report("unused-variable", line[name], stored[name].w, "%s is stored but never used", name)
+			}
+		}
+	}
+	ran := make(map[string]bool)
+	for _, l := range f.lines {
+		if _, words := unwrapif(l.words); !l.comment && len(words) > 1 && words[0].text == "RUN" {
+			ran[words[1].text] = true
+		}
+	}
+	if !f.module && !f.library {
+		for _, name := range sortedkeys(f.funcs) {
+			if b := f.funcs[name]; !ran[name] && name != "" {
+				l := f.lines[b.line-1]
+				report("unused-function", l.n, l.words[1], "function %s is never run", name)
+			}
+		}
+	}
+
+	// Loops whose condition never changes
+	for _, l := range f.lines {
+		_, words := unwrapif(l.words)
+		if l.comment || len(words) < 3 {
+			continue
+		}
+		var body []srcline
+		var what string
+		switch words[0].text {
+		case "RUN":
+			b, ok := f.funcs[words[1].text]
+			if !ok {
+				continue
+			}
+			body, what = e.reachable(f, b, make(map[string]bool)), "function "+words[1].text
+		case "MODRUN":
+			m, ok := e.modules[words[1].text]
+			if !ok || len(words) < 4 {
+				continue
+			}
+			b, ok := m.funcs[words[2].text]
+			if !ok {
+				continue
+			}
+			body, what = e.reachable(m, b, make(map[string]bool)), "function "+words[2].text+" of module "+words[1].text
+		default:
+			continue
+		}
+		cond := words[len(words)-1]
+		changed := false
+		for _, bl := range body {
+			_, bw := unwrapif(bl.words)
+			if !bl.comment && len(bw) > 0 && bw[0].text == "EXIT" {
+				changed = true
+			}
+			_, writes := e.varuses(bl)
+			for _, w := range writes {
+				changed = changed || w.name == cond.text
+			}
+		}
+		if !changed {
+			report("infinite-loop", l.n, cond, "nothing inside %s changes %s, the loop never ends once it starts", what, cond.text)
+		}
+	}
+
+	// Variables used before they are stored, following RUN into functions in the order they run
+	known := varseed(f)
+	if f.module {
+		for _, l := range f.lines {
+			if l.where == inmodule {
+				_, writes := e.varuses(l)
+				for _, w := range writes {
+					known[w.name] = 0
+				}
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	var walk func(lines []srcline, done map[string]bool, visiting map[string]bool)
+	walk = func(lines []srcline, done map[string]bool, visiting map[string]bool) {
+		for _, l := range lines {
+			reads, writes := e.varuses(l)
+			for _, r := range reads {
+				key := fmt.Sprintf("%d:%d", l.n, r.w.start)
+				if _, ok := stored[r.name]; ok && !done[r.name] && !seen[key] {
+					seen[key] = true
+					report("load-before-store", l.n, r.w, "%s is used before anything stores into it", r.name)
+				}
+			}
+			for _, w := range writes {
+				done[w.name] = true
+			}
+			_, words := unwrapif(l.words)
+			if !l.comment && len(words) > 1 && words[0].text == "RUN" && !visiting[words[1].text] {
+				if b, ok := f.funcs[words[1].text]; ok {
+					visiting[words[1].text] = true
+					walk(funclines(f, b), done, visiting)
+					delete(visiting, words[1].text)
+				}
+			}
+		}
+	}
+	if !f.library {
+		done := make(map[string]bool)
+		for name := range known {
+			done[name] = true
+		}
+		var top []srcline
+		for _, l := range f.lines {
+			if l.where == intop || (f.module && l.where == inmodule) {
+				top = append(top, l)
+			}
+		}
+		walk(top, done, make(map[string]bool))
+
+		// A module's functions may run in any order, so only stores of the function itself count
+		if f.module {
+			for _, name := range sortedkeys(f.funcs) {
+				done := make(map[string]bool)
+				for v := range known {
+					done[v] = true
+				}
+				for other, b := range f.funcs {
+					if other == name {
+						continue
+					}
+					for _, l := range funclines(f, b) {
+						_, writes := e.varuses(l)
+						for _, w := range writes {
+							done[w.name] = true
+						}
+					}
+				}
+				walk(funclines(f, f.funcs[name]), done, map[string]bool{name: true})
+			}
+		}
+	}
+
+	// Lines after an EXIT that is not part of an IF
+	blocks := [][]srcline{nil}
+	for _, l := range f.lines {
+		if l.where == intop || l.where == inmodule {
+			blocks[0] = append(blocks[0], l)
+		}
+	}
+	for _, name := range sortedkeys(f.funcs) {
+		blocks = append(blocks, funclines(f, f.funcs[name]))
+	}
+	for _, name := range sortedkeys(f.keywords) {
+		b := f.keywords[name]
+		if b.end > 0 {
+			blocks = append(blocks, f.lines[b.line:b.end-1])
+		}
+	}
+	for _, block := range blocks {
+		exit := 0
+		for _, l := range block {
+			if l.comment || len(l.words) == 0 {
+				continue
+			}
+			if exit > 0 {
+				report("unreachable-code", l.n, l.words[0], "this line never runs, the program ends at the EXIT on line %d", exit)
+				break
+			}
+			if l.words[0].text == "EXIT" {
+				exit = l.n
+			}
+		}
+	}
+
+	// Modules nothing uses
+	for _, l := range f.lines {
+		if l.comment || len(l.words) < 3 || l.words[0].text != "IMPORT" {
+			continue
+		}
+		used := false
+		for _, o := range f.lines {
+			_, words := unwrapif(o.words)
+			if !o.comment && len(words) > 1 && strings.HasPrefix(words[0].text, "MOD") && words[1].text == l.words[2].text {
+				used = true
+			}
+		}
+		if !used {
+			report("unused-import", l.n, l.words[2], "module %s is imported but never used", l.words[2].text)
+		}
+	}
+
+	// Leave out what is turned off or silenced
+	ignored := make(map[int]map[string]bool)
+	file := make(map[string]bool)
+	var pending map[string]bool
+	for _, l := range f.lines {
+		if l.comment && len(l.words) > 1 {
+			fields := strings.Fields(strings.TrimSpace(l.raw[l.words[0].end:]))
+			if len(fields) > 0 && (fields[0] == "lint:ignore" || fields[0] == "lint:ignore-file") {
+				rules := map[string]bool{}
+				if len(fields) > 1 {
+					for _, r := range strings.Split(strings.Join(fields[1:], ""), ",") {
+						rules[r] = true
+					}
+				}
+				if fields[0] == "lint:ignore-file" {
+					if len(rules) == 0 {
+						rules[""] = true
+					}
+					for r := range rules {
+						file[r] = true
+					}
+				} else {
+					pending = rules
+				}
+			}
+			continue
+		}
+		if len(l.words) > 0 && pending != nil {
+			ignored[l.n] = pending
+			pending = nil
+		}
+	}
+	var kept []problem
+	for _, p := range found {
+		silenced := ignored[p.line] != nil && (len(ignored[p.line]) == 0 || ignored[p.line][p.rule])
+		if enabled[p.rule] && !silenced && !file[""] && !file[p.rule] {
+			kept = append(kept, p)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].line < kept[j].line })
+	return kept
+}
+
+// The lines of a function and of the functions it runs
+func (e *srcenv) reachable(f *srcfile, b srcblock, visiting map[string]bool) []srcline {
+	lines := funclines(f, b)
+	visiting[b.name] = true
+	for _, l := range funclines(f, b) {
+		_, words := unwrapif(l.words)
+		if l.comment || len(words) < 2 || words[0].text != "RUN" || visiting[words[1].text] {
+			continue
+		}
+		if other, ok := f.funcs[words[1].text]; ok {
+			lines = append(lines, e.reachable(f, other, visiting)...)
+		}
+	}
+	return lines
+}
+
+// Lint prints what the linter finds in files to out. Returns false when it finds anything
+func Lint(out io.Writer, paths []string) bool {
+	files, ok := sourcefiles(out, paths)
+	cwd, _ := os.Getwd()
+	for _, path := range files {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			ok = false
+			continue
+		}
+		enabled, err := lintconfig(path, ioutil.ReadFile)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			ok = false
+			continue
+		}
+		f := parsesource(path, string(bytes))
+		for _, p := range newsrcenv(f, []string{filepath.Dir(path), cwd}, ioutil.ReadFile).lint(enabled) {
+			fmt.Fprintf(out, "%s:%d:%d: warning: %s [%s]\n", path, p.line, p.col+1, p.msg, p.rule)
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,53 @@
+package interp
+
+import (
+	"strings"
+	"testing"
+)
+
+func lint(out *strings.Builder, paths []string) bool { return Lint(out, paths) }
+
+// Every rule with a program it finds something in and a similar one it leaves alone
+func TestLintRules(t *testing.T) {
+	module := "EXPORT a 1\nFUNC f\n\tPUSH 1\nENDFUNC"
+	for _, c := range []struct{ rule, found, fine, want string }{
+		{"constant-reassigned", "PUSH 3\nSTORE PI\nLOAD PI\nPRINT", "PUSH 3\nSTORE pie\nLOAD pie\nPRINT\nLOAD PI\nPRINT", "main.red:2:7: warning: PI is a constant, storing into it changes it for the whole program [constant-reassigned]"},
+		{"infinite-loop", "PUSH true\nSTORE c\nFUNC f\n\tPUSH 1\n\tPRINT\nENDFUNC\nRUN f c", "PUSH true\nSTORE c\nFUNC f\n\tPUSH false\n\tSTORE c\nENDFUNC\nRUN f c", "main.red:7:7: warning: nothing inside function f changes c, the loop never ends once it starts [infinite-loop]"},
+		{"unused-variable", "PUSH 1\nSTORE x", "PUSH 1\nSTORE x\nLOAD x\nPRINT", "main.red:2:7: warning: x is stored but never used [unused-variable]"},
+		{"unused-function", "FUNC f\n\tPUSH 1\n\tPRINT\nENDFUNC", "FUNC f\n\tPUSH 1\n\tPRINT\nENDFUNC\nRUN f", "main.red:1:6: warning: function f is never run [unused-function]"},
+		{"load-before-store", "LOAD x\nPRINT\nPUSH 1\nSTORE x", "PUSH 1\nSTORE x\nLOAD x\nPRINT", "main.red:1:6: warning: x is used before anything stores into it [load-before-store]"},
+		{"unreachable-code", "PUSH 1\nPRINT\nEXIT\nPUSH 2\nPRINT", "PUSH 1\nPRINT\nEXIT", "main.red:4:1: warning: this line never runs, the program ends at the EXIT on line 3 [unreachable-code]"},
+		{"unused-import", "IMPORT m.mred m\nPUSH 1\nPRINT", "IMPORT m.mred m\nMODRUN m f", "main.red:1:15: warning: module m is imported but never used [unused-import]"},
+	} {
+		t.Run(c.rule, func(t *testing.T) {
+			ok, got := runtool(t, lint, map[string]string{"m.mred": module, "main.red": c.found}, "main.red")
+			if ok || got != c.want+"\n" {
+				t.Errorf("lint returned %v and printed\n%s\nwant\n%s", ok, got, c.want)
+			}
+			ok, got = runtool(t, lint, map[string]string{"m.mred": module, "main.red": c.fine}, "main.red")
+			if !ok || got != "" {
+				t.Errorf("lint returned %v and printed\n%s\nfor a program without problems", ok, got)
+			}
+		})
+	}
+}
+
+func TestLintIgnore(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"comment", map[string]string{"main.red": "PUSH 1\n// lint:ignore unused-variable\nSTORE x\nPUSH 2\nSTORE y"}, "main.red:5:7: warning: y is stored but never used [unused-variable]\n"},
+		{"other rule", map[string]string{"main.red": "PUSH 1\n// lint:ignore unused-function\nSTORE x"}, "main.red:3:7: warning: x is stored but never used [unused-variable]\n"},
+		{"every rule", map[string]string{"main.red": "PUSH 1\n// lint:ignore\nSTORE x"}, ""},
+		{"file", map[string]string{"main.red": "// lint:ignore-file\nPUSH 1\nSTORE x\nPUSH 2\nSTORE y"}, ""},
+		{"config", map[string]string{"main.red": "PUSH 1\nSTORE x\nFUNC f\nENDFUNC", ".redlint.json": `{"rules": {"unused-variable": false}}`}, "main.red:3:6: warning: function f is never run [unused-function]\n"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if _, got := runtool(t, lint, c.files, "main.red"); got != c.want {
+				t.Errorf("printed\n%s\nwant\n%s", got, c.want)
+			}
+		})
+	}
+}
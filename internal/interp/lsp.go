@@ -0,0 +1,536 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A Language Server Protocol session for .red, .mred and .kr files
+type lspsession struct {
+	out  io.Writer
+	root string
+	docs map[string]string
+}
+
+// ServeLSP serves the Language Server Protocol until the client exits
+func ServeLSP(in io.Reader, out io.Writer) {
+	s := &lspsession{out: out, docs: make(map[string]string)}
+	reader := bufio.NewReader(in)
+	for {
+		msg, err := readmessage(reader)
+		if err != nil {
+			return
+		}
+		method := dapstr(msg, "method")
+		params, _ := msg["params"].(map[string]interface{})
+		if params == nil {
+			params = map[string]interface{}{}
+		}
+		if method == "exit" {
+			return
+		}
+		id, request := msg["id"]
+		if method == "" {
+			continue
+		}
+		result, fail := s.handle(method, params)
+		if !request {
+			continue
+		}
+		reply := map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result}
+		if fail != "" {
+			delete(reply, "result")
+			reply["error"] = map[string]interface{}{"code": -32601, "message": fail}
+		}
+		s.send(reply)
+	}
+}
+
+func (s *lspsession) send(msg map[string]interface{}) {
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *lspsession) handle(method string, params map[string]interface{}) (interface{}, string) {
+	doc, _ := params["textDocument"].(map[string]interface{})
+	uri := dapstr(doc, "uri")
+	pos, _ := params["position"].(map[string]interface{})
+	switch method {
+	case "initialize":
+		if root := dapstr(params, "rootUri"); root != "" {
+			s.root = uripath(root)
+		} else {
+			s.root = dapstr(params, "rootPath")
+		}
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1,
+				"completionProvider":     map[string]interface{}{"triggerCharacters": []string{" "}},
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]interface{}{"name": "red"},
+		}, ""
+	case "initialized", "$/cancelRequest", "$/setTrace", "textDocument/didSave", "workspace/didChangeConfiguration":
+		return nil, ""
+	case "shutdown":
+		return nil, ""
+	case "textDocument/didOpen":
+		s.docs[uri] = dapstr(doc, "text")
+		s.publish(uri)
+		return nil, ""
+	case "textDocument/didChange":
+		for _, c := range daplist(params, "contentChanges") {
+			s.docs[uri] = dapstr(c, "text")
+		}
+		s.publish(uri)
+		return nil, ""
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		s.send(map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": map[string]interface{}{"uri": uri, "diagnostics": []interface{}{}}})
+		return nil, ""
+	case "textDocument/completion":
+		f, e := s.analyze(uri)
+		return s.complete(f, e, dapint(pos, "line"), dapint(pos, "character")), ""
+	case "textDocument/hover":
+		f, e := s.analyze(uri)
+		return s.hover(f, e, dapint(pos, "line"), dapint(pos, "character")), ""
+	case "textDocument/definition":
+		f, e := s.analyze(uri)
+		return s.definition(f, e, dapint(pos, "line"), dapint(pos, "character")), ""
+	case "textDocument/documentSymbol":
+		f, _ := s.analyze(uri)
+		return s.symbols(f), ""
+	}
+	return nil, "Unsupported method " + method
+}
+
+func uripath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathuri(path string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
+
+// Read a file, preferring what is open in the editor
+func (s *lspsession) readfile(path string) ([]byte, error) {
+	if text, ok := s.docs[pathuri(path)]; ok {
+		return []byte(text), nil
+	}
+	return ioutil.ReadFile(path)
+}
+
+func (s *lspsession) analyze(uri string) (*srcfile, *srcenv) {
+	path := uripath(uri)
+	f := parsesource(path, s.docs[uri])
+	dirs := []string{filepath.Dir(path)}
+	if s.root != "" {
+		dirs = append(dirs, s.root)
+	}
+	return f, newsrcenv(f, dirs, s.readfile)
+}
+
+// Send the problems of a document to the client
+func (s *lspsession) publish(uri string) {
+	f, e := s.analyze(uri)
+	list := []interface{}{}
+	problems := checksource(f, e)
+	if enabled, err := lintconfig(f.path, s.readfile); err == nil {
+		problems = append(problems, e.lint(enabled)...)
+	}
+	for _, p := range problems {
+		severity := 1
+		if p.warning {
+			severity = 2
+		}
+		raw := f.lines[p.line-1].raw
+		diagnostic := map[string]interface{}{
+			"range":    lsprange(p.line, raw, p.col, p.end),
+			"severity": severity,
+			"source":   "red",
+			"message":  p.msg,
+		}
+		if p.rule != "" {
+			diagnostic["code"] = p.rule
+		}
+		list = append(list, diagnostic)
+	}
+	s.send(map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": map[string]interface{}{"uri": uri, "diagnostics": list}})
+}
+
+// Positions count UTF-16 units from 0, lines and columns of the tools count lines from 1 and bytes
+func lsprange(line int, raw string, start int, end int) map[string]interface{} {
+	return map[string]interface{}{
+		"start": map[string]interface{}{"line": line - 1, "character": utf16len(raw[:start])},
+		"end":   map[string]interface{}{"line": line - 1, "character": utf16len(raw[:end])},
+	}
+}
+
+func utf16len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r >= 0x10000 {
+			n++
+		}
+	}
+	return n
+}
+
+// The line at a position and the byte offset of the character in it
+func (f *srcfile) at(line int, char int) (srcline, int, bool) {
+	if line < 0 || line >= len(f.lines) {
+		return srcline{}, 0, false
+	}
+	l := f.lines[line]
+	n := 0
+	for i, r := range l.raw {
+		if n >= char {
+			return l, i, true
+		}
+		n++
+		if r >= 0x10000 {
+			n++
+		}
+	}
+	return l, len(l.raw), true
+}
+
+// The word of a line at a byte offset, -1 when there is none
+func wordat(l srcline, off int) int {
+	for i, w := range l.words {
+		if off >= w.start && off <= w.end {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *lspsession) complete(f *srcfile, e *srcenv, line int, char int) []interface{} {
+	list := []interface{}{}
+	add := func(label string, kind int, detail string, doc string) {
+		item := map[string]interface{}{"label": label, "kind": kind}
+		if detail != "" {
+			item["detail"] = detail
+		}
+		if doc != "" {
+			item["documentation"] = doc
+		}
+		list = append(list, item)
+	}
+	l, off, ok := f.at(line, char)
+	if !ok {
+		return list
+	}
+	// Words before the cursor, the last one is being typed
+	words := sourcewords(l.raw[:off])
+	if off == 0 || strings.HasSuffix(l.raw[:off], " ") || strings.HasSuffix(l.raw[:off], "\t") {
+		words = append(words, srcword{})
+	}
+	// The end of an IF line is a line of its own
+	for len(words) > 2 && words[0].text == "IF" {
+		words = words[2:]
+	}
+	if len(words) <= 1 {
+		names := make([]string, 0, len(keywordinfos))
+		for name, info := range keywordinfos {
+			if l.where&info.where != 0 {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(name, 14, keywordinfos[name].usage, keywordinfos[name].doc)
+		}
+		if l.where != inmodule {
+			for _, prefix := range sortedkeys(e.keymods) {
+				add(prefix, 9, "keyword library from "+e.keymods[prefix].source, "")
+			}
+		}
+		return list
+	}
+	op := words[0].text
+	n := len(words) - 1
+	switch {
+	case e.keymods[op].cases != nil && n == 1:
+		for _, name := range sortedkeys(e.keymods[op].cases) {
+			c := e.keymods[op].cases[name]
+			add(name, 3, op+" "+name+" "+signature(c.params), "Defined at "+c.source)
+		}
+	case op == "RUN" && n == 1:
+		for _, name := range sortedkeys(f.funcs) {
+			add(name, 3, "FUNC "+name, "")
+		}
+	case (op == "MODRUN" || op == "MODGET" || op == "MODSTORE") && n == 1:
+		for _, name := range sortedkeys(e.modules) {
+			add(name, 9, "module "+e.modules[name].path, "")
+		}
+	case op == "MODRUN" && n == 2:
+		if m, ok := e.modules[words[1].text]; ok {
+			for _, name := range sortedkeys(m.funcs) {
+				add(name, 3, "FUNC "+name, "")
+			}
+		}
+	case (op == "MODGET" || op == "MODSTORE") && n == 2:
+		if m, ok := e.modules[words[1].text]; ok {
+			for _, ml := range m.lines {
+				if !ml.comment && len(ml.words) > 1 && (ml.words[0].text == "EXPORT" || ml.words[0].text == "EXARR") {
+					add(ml.words[1].text, 6, strings.TrimSpace(ml.raw), "")
+				}
+			}
+		}
+	case (op == "LOAD" || op == "STORE" || op == "IF" || (op == "RUN" && n == 2)) && n <= 2:
+		names := []string{"PI", "EULER"}
+		for name := range e.symbols {
+			if name != "PI" && name != "EULER" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names[2:])
+		for _, name := range names {
+			add(name, 6, "", "")
+		}
+	case op == "LOADARG" && n == 1:
+		if b, ok := f.keywords[l.block]; ok {
+			for _, p := range b.params {
+				add(p.name, 6, p.name+":"+typename(p.dtype), "")
+			}
+		}
+	case op == "KEYPORT" && n == 2:
+		add("AS", 14, "", "Load the library under another prefix")
+		add("EXTEND", 14, "", "Add the cases of the library to a loaded one")
+	case (op == "KEYPORT" || op == "IMPORT") && n == 1:
+		ext := ".kr"
+		if op == "IMPORT" {
+			ext = ".mred"
+		}
+		matches, _ := filepath.Glob(filepath.Join(filepath.Dir(f.path), "*"+ext))
+		for _, m := range matches {
+			add(filepath.Base(m), 17, "", "")
+		}
+	}
+	return list
+}
+
+func (s *lspsession) hover(f *srcfile, e *srcenv, line int, char int) interface{} {
+	l, off, ok := f.at(line, char)
+	if !ok || l.comment {
+		return nil
+	}
+	i := wordat(l, off)
+	if i < 0 {
+		return nil
+	}
+	words := l.words
+	for len(words) > 2 && words[0].text == "IF" && i >= 2 {
+		words = words[2:]
+		i -= 2
+	}
+	w := words[i]
+	text := ""
+	op := words[0].text
+	switch {
+	case i == 0 && keywordinfos[w.text].usage != "":
+		info := keywordinfos[w.text]
+		text = "**" + info.usage + "**\n\n" + info.doc
+	case i == 0 && e.keymods[w.text].cases != nil:
+		k := e.keymods[w.text]
+		text = "Keyword library " + w.text + " from " + k.source + "\n"
+		for _, name := range sortedkeys(k.cases) {
+			text += "\n- " + w.text + " " + name + " " + signature(k.cases[name].params)
+		}
+	case i == 1 && e.keymods[op].cases != nil:
+		if c, ok := e.keymods[op].cases[w.text]; ok {
+			text = "**" + op + " " + w.text + " " + signature(c.params) + "**\n\nDefined at " + c.source
+			if len(c.code) > 0 {
+				text += "\n\n" + strings.Join(c.code, "\n")
+			}
+		}
+	case (op == "RUN" || op == "FUNC") && i == 1:
+		if b, ok := f.funcs[w.text]; ok {
+			text = fmt.Sprintf("FUNC %s, lines %d to %d", w.text, b.line, b.end)
+			if eff, ok := e.checkstack()[w.text]; ok {
+				text += "\n\nStack effect " + eff.String()
+			}
+		}
+	case (op == "MODRUN" || op == "MODGET" || op == "MODSTORE") && i == 1:
+		if m, ok := e.modules[w.text]; ok {
+			text = "Module " + w.text + " imported from " + m.path
+		}
+	case op == "MODRUN" && i == 2:
+		if m, ok := e.modules[words[1].text]; ok {
+			if b, ok := m.funcs[w.text]; ok {
+				text = fmt.Sprintf("FUNC %s of module %s, lines %d to %d of %s", w.text, words[1].text, b.line, b.end, m.path)
+			}
+		}
+	case (op == "LOAD" || op == "STORE" || op == "IF" || op == "RUN") && i >= 1:
+		if d, ok := e.symbols[w.text]; ok {
+			text = fmt.Sprintf("Variable %s, first stored on line %d: %s", w.text, d.n, strings.TrimSpace(d.raw))
+		} else if w.text == "PI" || w.text == "EULER" {
+			text = "Built-in constant " + w.text
+		}
+	}
+	if text == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"contents": map[string]interface{}{"kind": "markdown", "value": text},
+		"range":    lsprange(l.n, l.raw, w.start, w.end),
+	}
+}
+
+func lsplocation(path string, line int, col int, end int, raw string) map[string]interface{} {
+	if line < 1 {
+		line = 1
+	}
+	return map[string]interface{}{"uri": pathuri(path), "range": lsprange(line, raw, col, end)}
+}
+
+// Where the word under the cursor is defined
+func (s *lspsession) definition(f *srcfile, e *srcenv, line int, char int) interface{} {
+	l, off, ok := f.at(line, char)
+	if !ok || l.comment {
+		return nil
+	}
+	i := wordat(l, off)
+	if i < 0 {
+		return nil
+	}
+	words := l.words
+	for len(words) > 2 && words[0].text == "IF" && i >= 2 {
+		words = words[2:]
+		i -= 2
+	}
+	w := words[i]
+	op := words[0].text
+	whole := func(m *srcfile, n int) interface{} {
+		raw := m.lines[n-1].raw
+		return lsplocation(m.path, n, 0, len(raw), raw)
+	}
+	switch {
+	case (op == "IMPORT" || op == "KEYPORT") && i == 1:
+		if p, ok := e.resolve(w.text); ok {
+			return lsplocation(p, 1, 0, 0, "")
+		}
+	case (op == "RUN" || op == "FUNC") && i == 1:
+		if b, ok := f.funcs[w.text]; ok {
+			return whole(f, b.line)
+		}
+	case (op == "MODRUN" || op == "MODGET" || op == "MODSTORE") && i == 1:
+		for _, il := range f.lines {
+			if !il.comment && len(il.words) > 2 && il.words[0].text == "IMPORT" && il.words[2].text == w.text {
+				return whole(f, il.n)
+			}
+		}
+	case op == "MODRUN" && i == 2:
+		if m, ok := e.modules[words[1].text]; ok {
+			if b, ok := m.funcs[w.text]; ok {
+				return whole(m, b.line)
+			}
+		}
+	case (op == "MODGET" || op == "MODSTORE") && i == 2:
+		if m, ok := e.modules[words[1].text]; ok {
+			for _, ml := range m.lines {
+				if !ml.comment && len(ml.words) > 1 && (ml.words[0].text == "EXPORT" || ml.words[0].text == "EXARR") && ml.words[1].text == w.text {
+					return whole(m, ml.n)
+				}
+			}
+		}
+	case (op == "LOAD" || op == "STORE" || op == "IF" || op == "RUN") && i >= 1:
+		if d, ok := e.symbols[w.text]; ok {
+			return whole(f, d.n)
+		}
+	case i <= 1 && len(words) > 1 && e.keymods[op].cases != nil:
+		c, ok := e.keymods[op].cases[words[1].text]
+		if !ok {
+			return nil
+		}
+		file, n := casepos(c)
+		bytes, err := e.readfile(file)
+		if err != nil {
+			return nil
+		}
+		lines := strings.Split(string(bytes), "\n")
+		if n > len(lines) {
+			n = len(lines)
+		}
+		raw := strings.TrimRight(lines[n-1], "\r")
+		return lsplocation(file, n, 0, len(raw), raw)
+	}
+	return nil
+}
+
+// The functions, keyword cases, imports and variables of a document
+func (s *lspsession) symbols(f *srcfile) []interface{} {
+	list := []interface{}{}
+	add := func(name string, kind int, from int, to int) {
+		last := f.lines[to-1].raw
+		first := f.lines[from-1].raw
+		list = append(list, map[string]interface{}{
+			"name":           name,
+			"kind":           kind,
+			"range":          map[string]interface{}{"start": lsprange(from, first, 0, 0)["start"], "end": lsprange(to, last, 0, len(last))["end"]},
+			"selectionRange": lsprange(from, first, 0, len(first)),
+		})
+	}
+	if f.library && strings.HasPrefix(strings.TrimSpace(rawtext(f)), "{") {
+		re := regexp.MustCompile("\"case\"\\s*:\\s*\"([^\"]+)\"")
+		for _, l := range f.lines {
+			if m := re.FindStringSubmatch(l.raw); m != nil {
+				add(m[1], 12, l.n, l.n)
+			}
+		}
+		return list
+	}
+	seen := make(map[string]bool)
+	for _, l := range f.lines {
+		if l.comment || len(l.words) < 2 {
+			continue
+		}
+		switch l.words[0].text {
+		case "FUNC":
+			if b, ok := f.funcs[l.words[1].text]; ok && b.line == l.n {
+				add(b.name, 12, b.line, b.end)
+			}
+		case "KEYWORD":
+			if len(l.words) > 2 {
+				if b, ok := f.keywords[l.words[1].text+" "+l.words[2].text]; ok && b.line == l.n {
+					add(b.name, 6, b.line, b.end)
+				}
+			}
+		case "IMPORT":
+			if len(l.words) > 2 {
+				add(l.words[2].text, 2, l.n, l.n)
+			}
+		case "STORE", "SET", "EXPORT", "EXARR":
+			if !seen[l.words[1].text] {
+				seen[l.words[1].text] = true
+				add(l.words[1].text, 13, l.n, l.n)
+			}
+		}
+	}
+	return list
+}
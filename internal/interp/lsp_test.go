@@ -0,0 +1,90 @@
+package interp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Run a scripted session, the messages are sent in order and what the server sent back is returned
+func lspexchange(t *testing.T, messages ...map[string]interface{}) []map[string]interface{} {
+	t.Helper()
+	var in, out bytes.Buffer
+	for _, msg := range messages {
+		msg["jsonrpc"] = "2.0"
+		body, _ := json.Marshal(msg)
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	ServeLSP(&in, &out)
+	var replies []map[string]interface{}
+	r := bufio.NewReader(&out)
+	for {
+		msg, err := readmessage(r)
+		if err == io.EOF {
+			return replies
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, msg)
+	}
+}
+
+// Compare a message with what it should be written as JSON
+func lspexpect(t *testing.T, got interface{}, want string) {
+	t.Helper()
+	var w interface{}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(got)
+	var g interface{}
+	json.Unmarshal(data, &g)
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestLSPSession(t *testing.T) {
+	dir := t.TempDir()
+	uri := pathuri(filepath.Join(dir, "main.red"))
+	doc := func(text string) map[string]interface{} {
+		return map[string]interface{}{"uri": uri, "languageId": "red", "version": 1, "text": text}
+	}
+	at := func(line, char int) map[string]interface{} {
+		return map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}, "position": map[string]interface{}{"line": line, "character": char}}
+	}
+	replies := lspexchange(t,
+		map[string]interface{}{"id": 1, "method": "initialize", "params": map[string]interface{}{"rootUri": pathuri(dir)}},
+		map[string]interface{}{"method": "initialized", "params": map[string]interface{}{}},
+		map[string]interface{}{"method": "textDocument/didOpen", "params": map[string]interface{}{"textDocument": doc("FUNC double\n\tPUSH 2\n\tMULT\nENDFUNC\nPUSH 4\nRUN double\nRUN triple\nPUSH 1\nSTORE x")}},
+		map[string]interface{}{"id": 2, "method": "textDocument/definition", "params": at(5, 6)},
+		map[string]interface{}{"method": "textDocument/didChange", "params": map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri, "version": 2}, "contentChanges": []interface{}{map[string]interface{}{"text": "PUSH 1\nPRINT"}}}},
+		map[string]interface{}{"id": 3, "method": "textDocument/unknown", "params": map[string]interface{}{}},
+		map[string]interface{}{"id": 4, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+		map[string]interface{}{"id": 5, "method": "shutdown"},
+	)
+	if len(replies) != 6 {
+		t.Fatalf("got %d messages: %v", len(replies), replies)
+	}
+
+	if caps, _ := replies[0]["result"].(map[string]interface{}); replies[0]["id"] != 1.0 || caps["capabilities"] == nil {
+		t.Errorf("initialize answered %v", replies[0])
+	}
+	lspexpect(t, replies[1], `{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": {"uri": "`+uri+`", "diagnostics": [
+		{"range": {"start": {"line": 6, "character": 4}, "end": {"line": 6, "character": 10}}, "severity": 1, "source": "red", "message": "undefined function triple"},
+		{"range": {"start": {"line": 8, "character": 6}, "end": {"line": 8, "character": 7}}, "severity": 2, "source": "red", "message": "x is stored but never used", "code": "unused-variable"}
+	]}}`)
+	lspexpect(t, replies[2], `{"jsonrpc": "2.0", "id": 2, "result": {"uri": "`+uri+`", "range": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 11}}}}`)
+
+	// Fixing the document clears the diagnostics
+	lspexpect(t, replies[3], `{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": {"uri": "`+uri+`", "diagnostics": []}}`)
+	lspexpect(t, replies[4], `{"jsonrpc": "2.0", "id": 3, "error": {"code": -32601, "message": "Unsupported method textDocument/unknown"}}`)
+	lspexpect(t, replies[5], `{"jsonrpc": "2.0", "id": 4, "result": null}`)
+}
@@ -0,0 +1,167 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A Program is a program with the modules and keyword libraries it loads, parsed so it runs
+// without reading or parsing any source. Its fields are exported so it can be encoded with
+// encoding/gob
+type Program struct {
+	// The program to run, by the key of its lines
+	Main string
+
+	// Programs and modules split into lines and keyword libraries with their cases parsed, keyed
+	// by the path they are loaded with using forward slashes
+	Lines     map[string][]string
+	Libraries map[string]map[string]Library
+}
+
+// A Library is a keyword library loaded under a prefix
+type Library struct {
+	Cases  map[string]Case
+	Source string
+}
+
+// A Case is one keyword of a Library
+type Case struct {
+	Params []Param
+	Code   []string
+	Source string
+	File   string
+	Lines  []int
+}
+
+// A Param is a declared parameter of a Case, Type is -1 for any type
+type Param struct {
+	Name    string
+	Type    int
+	Default *Value
+}
+
+// A Value is a value on the stack
+type Value struct {
+	Number float64
+	Symbol string
+	String string
+	Type   int
+	Bool   bool
+	List   []Value
+}
+
+// Compile parses the program in file and every file Bundle collects for it. A keyword library
+// that does not parse is an error
+func Compile(ip *Interpreter, file string) (*Program, error) {
+	files, err := ip.Bundle(file)
+	if err != nil {
+		return nil, err
+	}
+	main := filepath.ToSlash(filepath.Clean(file))
+	p := &Program{Main: main, Lines: make(map[string][]string), Libraries: make(map[string]map[string]Library)}
+	p.Lines[main] = strings.Split(stripshebang(string(files[main])), "\n")
+	libs := map[string]bool{"built-in/util.kr": true}
+	for name, data := range files {
+		refs, err := loadrefs(name, data)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range refs {
+			key := filepath.ToSlash(filepath.Clean(r.path))
+			if r.kind != "module" {
+				libs[key] = true
+			} else if data, ok := files[key]; ok && p.Lines[key] == nil {
+				p.Lines[key] = strings.Split(string(data), "\n")
+			}
+		}
+	}
+	for key := range libs {
+		data, ok := files[key]
+		if !ok {
+			continue
+		}
+		var parsed map[string]keymod
+		if msg := ip.catchprint(func() { parsed = ip.loadkeymod(key, data) }); msg != "" {
+			return nil, errors.New(msg)
+		}
+		p.Libraries[key] = make(map[string]Library)
+		for prefix, k := range parsed {
+			p.Libraries[key][prefix] = exportkeymod(k)
+		}
+	}
+	return p, nil
+}
+
+// Load adds the program to be run by the next call to ip.Run, the modules and keyword libraries
+// it holds are used instead of files with the same path
+func (p *Program) Load(ip *Interpreter) {
+	ip.lines = p.Lines
+	ip.libs = make(map[string]map[string]keymod)
+	for key, libs := range p.Libraries {
+		ip.libs[key] = make(map[string]keymod)
+		for prefix, l := range libs {
+			ip.libs[key][prefix] = importkeymod(l)
+		}
+	}
+	ip.pending = append(ip.pending, program{path.Base(p.Main), p.Lines[p.Main]})
+}
+
+func exportkeymod(k keymod) Library {
+	l := Library{Cases: make(map[string]Case), Source: k.source}
+	for name, c := range k.cases {
+		e := Case{Code: c.code, Source: c.source, File: c.file, Lines: c.lines}
+		for _, p := range c.params {
+			param := Param{Name: p.name, Type: p.dtype}
+			if p.def != nil {
+				v := exportval(*p.def)
+				param.Default = &v
+			}
+			e.Params = append(e.Params, param)
+		}
+		l.Cases[name] = e
+	}
+	return l
+}
+
+func importkeymod(l Library) keymod {
+	k := keymod{cases: make(map[string]keycase), source: l.Source}
+	for name, e := range l.Cases {
+		c := keycase{code: e.Code, source: e.Source, file: e.File, lines: e.Lines}
+		for _, param := range e.Params {
+			p := keyparam{name: param.Name, dtype: param.Type}
+			if param.Default != nil {
+				v := importval(*param.Default)
+				p.def = &v
+			}
+			c.params = append(c.params, p)
+		}
+		k.cases[name] = c
+	}
+	return k
+}
+
+func exportval(s stackVal) Value {
+	v := Value{Number: s.val, Symbol: s.symbol, String: s.sval, Type: s.dtype, Bool: s.bval}
+	for _, item := range s.list {
+		v.List = append(v.List, exportval(item))
+	}
+	return v
+}
+
+func importval(v Value) stackVal {
+	s := stackVal{val: v.Number, symbol: v.Symbol, sval: v.String, dtype: v.Type, bval: v.Bool}
+	for _, item := range v.List {
+		s.list = append(s.list, importval(item))
+	}
+	return s
+}
@@ -0,0 +1,4124 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import (
+	"bufio"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// The random seed, RED_SEED fixes it so a program can be run again with the same numbers
+func randseed() int64 {
+	if seed, err := strconv.ParseInt(os.Getenv("RED_SEED"), 10, 64); err == nil {
+		return seed
+	}
+	return time.Now().UnixNano()
+}
+
+type mod struct {
+	funcs   map[string]funct
+	extvars map[string]stackVal
+	symbols map[string]stackVal
+}
+
+type funct struct {
+	name      string
+	args      []string
+	body      []string
+	condition string
+	file      string
+	lines     []int
+}
+type stackVal struct {
+	val    float64
+	symbol string
+	sval   string
+	dtype  int
+	bval   bool
+	list   []stackVal
+}
+
+func (ip *Interpreter) defimports() {
+	libs, err := ip.readkeymod("built-in/util.kr", "")
+
+	if err != nil {
+		cmd := exec.Command("git", "clone", "https://github.com/priyacoding/built-in")
+		fmt.Fprintln(ip.stdout, "[System] Built-in modules not found, attempting to download them automatically from github in current directory...") 
+		cmd.Run()
+		byteValue, err := ioutil.ReadFile("built-in/util.kr")
+		if err != nil {
+			fmt.Fprintln(ip.stdout, "[System] Built-in modules not found, please install them from https://github.com/priyacoding/built-in and make sure they are in directory you are running from") 
+			ip.exit(1)
+		}
+		fmt.Fprintln(ip.stdout, "[System] Built-in modules downloaded successfully! Running program...")
+		fmt.Fprintln(ip.stdout, "------------------------------------")
+		libs = ip.loadkeymod("built-in/util.kr", byteValue)
+	}
+
+	ip.registerkeymods("built-in/util.kr", libs, "", "")
+}
+
+// Files that are not found relative to the working directory are looked up next to the file
+// that loads them, from, in the include paths and then in the vendor folders that the package
+// manager installs dependencies into, next to from and in the folders above it
+func (ip *Interpreter) resolvepath(path string, from string) string {
+	if _, err := os.Stat(path); err == nil || filepath.IsAbs(path) {
+		return path
+	}
+	if found, ok := ip.found[path]; ok && from == "" {
+		return found
+	}
+	if found, ok := ip.found[from]; ok {
+		from = found
+	}
+	var dirs []string
+	if from != "" {
+		dirs = append(dirs, filepath.Dir(from))
+	}
+	dirs = append(dirs, ip.include...)
+	for dir := filepath.Dir(from); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, filepath.Join(dir, "vendor"))
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, path)); err == nil {
+			return filepath.Join(dir, path)
+		}
+	}
+	return path
+}
+
+// Read a file the program loads, from the files given to SetFiles when it is one of them. from
+// is the file that loads it, empty for files loaded before
+func (ip *Interpreter) readfile(path string, from string) ([]byte, error) {
+	if data, ok := ip.files[filepath.ToSlash(filepath.Clean(path))]; ok {
+		return data, nil
+	}
+	found := ip.resolvepath(path, from)
+	data, err := ioutil.ReadFile(found)
+	if err == nil && found != path {
+		ip.found[path] = found
+	}
+	return data, err
+}
+
+// Read the lines of a module, or take them from a parsed program
+func (ip *Interpreter) readlines(path string, from string) ([]string, error) {
+	if lines, ok := ip.lines[filepath.ToSlash(filepath.Clean(path))]; ok {
+		return lines, nil
+	}
+	bytes, err := ip.readfile(path, from)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(bytes), "\n"), nil
+}
+
+// Read and parse a keyword library, or take it from a parsed program
+func (ip *Interpreter) readkeymod(path string, from string) (map[string]keymod, error) {
+	if libs, ok := ip.libs[filepath.ToSlash(filepath.Clean(path))]; ok {
+		return libs, nil
+	}
+	bytes, err := ip.readfile(path, from)
+	if err != nil {
+		return nil, err
+	}
+	return ip.loadkeymod(path, bytes), nil
+}
+
+func (ip *Interpreter) runmod(code string) {
+	if code == "\n" || code == "" {
+		return
+	}
+	for name, v := range ip.module.extvars {
+		ip.setvar(ip.module.symbols, name, v)
+	}
+	// Split the line into parts
+	code = strings.ReplaceAll(code, "	", "")
+	code = strings.ReplaceAll(code, "    ", "")
+
+	// Split the line into parts
+	parts := strings.Split(code, " ")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+		parts[i] = strings.ReplaceAll(parts[i], "	", "")
+	}
+
+	// Determine the operation
+	op := parts[0]
+	ip.allow(op)
+
+	// Execute the operation
+	switch op {
+	case "PUSH":
+		var s stackVal = stackVal{}
+
+		// Push the value onto the temptempstack
+		val, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			if strings.HasPrefix(strings.Join(parts[1:], " "), "\"") && strings.HasSuffix(strings.Join(parts[1:], " "), "\"") {
+				s.sval = strings.Join(parts[1:], " ")[1 : len(strings.Join(parts[1:], " "))-1]
+				s.dtype = 1
+				ip.pushto(&ip.tempstack, s)
+			} else if strings.HasPrefix(strings.Join(parts[1:], " "), "'") && strings.HasSuffix(strings.Join(parts[1:], " "), "'") {
+				s.sval = strings.Join(parts[1:], " ")[1 : len(strings.Join(parts[1:], " "))-1]
+				s.dtype = 1
+				ip.pushto(&ip.tempstack, s)
+			} else if parts[1] == "true" || parts[1] == "false" {
+				s.dtype = 2
+				if parts[1] == "true" {
+					s.bval = true
+				} else {
+					s.bval = false
+				}
+				ip.pushto(&ip.tempstack, s)
+			}
+
+			/*
+				fmt.Fprintln(stdout, err)
+				exit(1)
+			*/
+		} else {
+			s.val = val
+			s.dtype = 0
+			ip.pushto(&ip.tempstack, s)
+		}
+
+	case "ADD":
+		// Pop the top two values from the tempstack and add them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		ip.pushto(&ip.tempstack, stackVal{val: val1.val + val2.val, dtype: 0})
+	case "SUB":
+		// Pop the top two values from the tempstack and subtract them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		ip.pushto(&ip.tempstack, stackVal{val: val1.val - val2.val, dtype: 0})
+	case "MULT":
+		// Pop the top two values from the tempstack and multiply them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		ip.pushto(&ip.tempstack, stackVal{val: val1.val * val2.val, dtype: 0})
+	case "DIV":
+		// Pop the top two values from the tempstack and divide them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+
+		if val2.val == 0 {
+			fmt.Fprintln(ip.stdout, "Cannot divide by zero")
+			ip.exit(1)
+		}
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		ip.pushto(&ip.tempstack, stackVal{val: val1.val / val2.val, dtype: 0})
+	case "STORE":
+		// Pop the top value from the tempstack and store it in the symbol table
+		val := ip.tempstack[len(ip.tempstack)-1]
+		ip.dropfrom(&ip.tempstack, 1)
+		ip.setvar(ip.module.symbols, parts[1], val)
+	case "LOAD":
+		// Load the value from the symbol table and push it onto the tempstack
+		val, ok := ip.module.symbols[parts[1]]
+		if !ok {
+
+			fmt.Fprintf(ip.stdout, "Undefined symbol: %s\n", parts[1])
+			ip.exit(1)
+		}
+		if len(parts) > 2 {
+			if val.dtype != 4 {
+				fmt.Fprintln(ip.stdout, "Cannot index non-array")
+				ip.exit(1)
+			}
+			index, err := strconv.Atoi(parts[2])
+			if err != nil {
+				valt, ok := ip.module.symbols[parts[2]]
+				if !ok {
+					fmt.Fprintf(ip.stdout, "Undefined symbol: %s\n", parts[2])
+					ip.exit(1)
+				} else if valt.dtype != 0 {
+					fmt.Fprintln(ip.stdout, "Index of array must be number")
+					ip.exit(1)
+				} else {
+					index = int(valt.val)
+				}
+			}
+			if index >= len(val.list) {
+				fmt.Fprintln(ip.stdout, "Index out of bounds")
+				ip.exit(1)
+			} else {
+				val = val.list[index]
+			}
+		}
+		ip.pushto(&ip.tempstack, val)
+	case "PRINT":
+		// Pop the top value from the tempstack and print it
+		val := ip.tempstack[len(ip.tempstack)-1]
+		ip.dropfrom(&ip.tempstack, 1)
+		if val.dtype == 1 {
+			fmt.Fprintln(ip.stdout, val.sval)
+		} else if val.dtype == 2 {
+			fmt.Fprintln(ip.stdout, val.bval)
+		} else if val.dtype == 0 {
+			fmt.Fprintln(ip.stdout, val.val)
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot print element")
+		}
+	case "STR":
+		var s stackVal = stackVal{}
+		s.dtype = 1
+		val := ip.tempstack[len(ip.tempstack)-1]
+		ip.dropfrom(&ip.tempstack, 1)
+		if val.dtype == 0 {
+			s.sval = strconv.FormatFloat(val.val, 'f', -1, 64)
+		} else if val.dtype == 2 {
+			s.sval = strconv.FormatBool(val.bval)
+		} else {
+			s.sval = val.sval
+		}
+		ip.pushto(&ip.tempstack, s)
+	case "FLOAT":
+		var s stackVal = stackVal{}
+		s.dtype = 0
+		val := ip.tempstack[len(ip.tempstack)-1]
+		ip.dropfrom(&ip.tempstack, 1)
+		if val.dtype == 1 {
+			i, err := strconv.ParseFloat(val.sval, 64)
+			if err != nil {
+				fmt.Fprintln(ip.stdout, "Cannot convert string to int")
+				ip.exit(1)
+			}
+			s.val = i
+		} else if val.dtype == 2 {
+			fmt.Fprintln(ip.stdout, "Cannot convert bool to int")
+			ip.exit(1)
+		} else {
+			s.val = val.val
+		}
+		ip.pushto(&ip.tempstack, s)
+	case "BOOL":
+		var s stackVal = stackVal{}
+		s.dtype = 2
+		val := ip.tempstack[len(ip.tempstack)-1]
+		ip.dropfrom(&ip.tempstack, 1)
+		if val.dtype == 1 {
+			b, err := strconv.ParseBool(val.sval)
+			if err != nil {
+				fmt.Fprintln(ip.stdout, "Cannot convert string to bool")
+				ip.exit(1)
+			}
+			s.bval = b
+		} else if val.dtype == 0 {
+			fmt.Fprintln(ip.stdout, "Cannot convert int to bool")
+			ip.exit(1)
+		} else {
+			s.bval = val.bval
+		}
+		ip.pushto(&ip.tempstack, s)
+	case "STRCAT":
+		// Pop the top two values from the tempstack and concatenate them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+		if !(val1.dtype == 1 || val2.dtype == 1) {
+			fmt.Fprintln(ip.stdout, "Cannot concatenate non-strings")
+			ip.exit(1)
+		}
+		ip.pushto(&ip.tempstack, stackVal{dtype: 1, sval: val1.sval + val2.sval})
+	case "EQ":
+		// Pop the top two values from the tempstack and compare them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.val == val2.val})
+		} else if val1.dtype == 1 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.sval == val2.sval})
+		} else {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.bval == val2.bval})
+		}
+	case "NEQ":
+		// Pop the top two values from the tempstack and compare them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.val != val2.val})
+		} else if val1.dtype == 1 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.sval != val2.sval})
+		} else {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.bval != val2.bval})
+		}
+	case "GT":
+		// Pop the top two values from the tempstack and compare them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.val > val2.val})
+		} else if val1.dtype == 1 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.sval > val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "GTE":
+		// Pop the top two values from the tempstack and compare them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.val >= val2.val})
+		} else if val1.dtype == 1 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.sval >= val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "LT":
+		// Pop the top two values from the tempstack and compare them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.val < val2.val})
+		} else if val1.dtype == 1 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.sval < val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "LTE":
+		// Pop the top two values from the tempstack and compare them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.val <= val2.val})
+		} else if val1.dtype == 1 {
+			ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.sval <= val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "NOT":
+		// Pop the top value from the stack and negate it
+		val := ip.tempstack[len(ip.tempstack)-1]
+		ip.stack = ip.tempstack[:len(ip.tempstack)-1]
+		if val.dtype != 2 {
+			fmt.Fprintln(ip.stdout, "Cannot negate non-bool")
+			ip.exit(1)
+		}
+		ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: !val.bval})
+	case "AND":
+		// Pop the top two values from the stack and AND them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+		if val1.dtype != 2 || val2.dtype != 2 {
+			fmt.Fprintln(ip.stdout, "Cannot AND non-bools")
+			ip.exit(1)
+		}
+		ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.bval && val2.bval})
+	case "OR":
+		// Pop the top two values from the stack and OR them
+		val1 := ip.tempstack[len(ip.tempstack)-1]
+		val2 := ip.tempstack[len(ip.tempstack)-2]
+		ip.dropfrom(&ip.tempstack, 2)
+		if val1.dtype != 2 || val2.dtype != 2 {
+			fmt.Fprintln(ip.stdout, "Cannot OR non-bools")
+			ip.exit(1)
+		}
+		ip.pushto(&ip.tempstack, stackVal{dtype: 2, bval: val1.bval || val2.bval})
+	case "DELAYST":
+		// Delay a certain amount of miliseconds
+		val := ip.tempstack[len(ip.tempstack)-1]
+		ip.dropfrom(&ip.tempstack, 1)
+		if val.dtype != 0 {
+			fmt.Fprintln(ip.stdout, "Cannot delay non-int")
+			ip.exit(1)
+		}
+		ip.sleep(time.Duration(val.val) * time.Millisecond)
+	case "EXIT", "ARGS", "ARGC", "GETENV", "SETENV":
+		ip.processop(op, parts[1:], &ip.tempstack, func(name string) (stackVal, bool) {
+			v, ok := ip.module.symbols[name]
+			return v, ok
+		})
+	case "INPUT", "EOF", "READALL":
+		ip.inputop(op, parts[1:], &ip.tempstack)
+	case "MODSTORE":
+		// Store a value in exported module variable
+		if len(parts) < 3 {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		if parts[1] == "" || parts[2] == "" {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		for name, m := range ip.modules {
+			if name == parts[1] {
+				val := ip.tempstack[len(ip.tempstack)-1]
+				ip.dropfrom(&ip.tempstack, 1)
+				ip.setvar(m.extvars, parts[2], val)
+			}
+		}
+	case "MODGET":
+		// Get a value from exported module variable
+		if len(parts) < 3 {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		if parts[1] == "" || parts[2] == "" {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		for name, m := range ip.modules {
+			if name == parts[1] {
+				for n, modu := range m.extvars {
+					if n == parts[2] {
+						ip.pushto(&ip.tempstack, modu)
+					}
+				}
+			}
+		}
+	case "CLEAR":
+		// Clear stack
+		ip.clearstack(&ip.tempstack)
+	case "MAKEARRAY":
+		// Make an array
+		var s stackVal = stackVal{dtype: 4, list: ip.tempstack}
+		ip.clearstack(&ip.tempstack)
+		ip.pushto(&ip.tempstack, s)
+	case "SPLIT":
+		// Split a string
+		if len(parts) > 1 {
+			if len(ip.tempstack) > 0 {
+				if ip.tempstack[len(ip.tempstack)-1].dtype == 1 {
+					split := strings.Split(ip.tempstack[len(ip.tempstack)-1].sval, parts[1])
+					ip.dropfrom(&ip.tempstack, 1)
+					var s stackVal = stackVal{dtype: 4, list: make([]stackVal, 0)}
+					for _, v := range split {
+						s.list = append(s.list, stackVal{dtype: 1, sval: v})
+					}
+					ip.pushto(&ip.tempstack, s)
+				} else {
+					fmt.Fprintln(ip.stdout, "Cannot split non-string")
+					ip.exit(1)
+				}
+			} else {
+				fmt.Fprintln(ip.stdout, "tempstack is empty")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Invalid split")
+			ip.exit(1)
+		}
+	case "JOIN":
+		// Join a string
+		if len(ip.tempstack) > 0 {
+			if ip.tempstack[len(ip.tempstack)-1].dtype == 4 {
+				join := ""
+				for _, v := range ip.tempstack[len(ip.tempstack)-1].list {
+					if v.dtype == 1 {
+						join += v.sval
+						/*
+							if index != len(tempstack[len(tempstack)-1].list)-1 {
+								if !strings.HasSuffix(parts, "JOIN") {
+									join += parts[1]
+								}
+							}*/
+					} else {
+						fmt.Fprintln(ip.stdout, "Cannot join non-string")
+						ip.exit(1)
+					}
+				}
+				ip.dropfrom(&ip.tempstack, 1)
+				var s stackVal = stackVal{dtype: 1, sval: join}
+				ip.pushto(&ip.tempstack, s)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot join non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "tempstack is empty")
+			ip.exit(1)
+		}
+	case "APPEND":
+		// Append to an array
+		if len(ip.tempstack) > 1 {
+			if ip.tempstack[len(ip.tempstack)-1].dtype == 4 {
+				if ip.tempstack[len(ip.tempstack)-2].dtype == 4 {
+					ip.tempstack[len(ip.tempstack)-2].list = append(ip.tempstack[len(ip.tempstack)-2].list, ip.tempstack[len(ip.tempstack)-1].list...)
+					ip.tempstack = ip.tempstack[:len(ip.tempstack)-1]
+				} else {
+					ip.tempstack[len(ip.tempstack)-2].list = append(ip.tempstack[len(ip.tempstack)-2].list, ip.tempstack[len(ip.tempstack)-1])
+					ip.tempstack = ip.tempstack[:len(ip.tempstack)-1]
+				}
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot append non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "tempstack is empty")
+			ip.exit(1)
+		}
+	case "LEN":
+		// Get the length of an array
+		if len(ip.tempstack) > 0 {
+			if ip.tempstack[len(ip.tempstack)-1].dtype == 4 {
+				ip.pushto(&ip.tempstack, stackVal{dtype: 0, val: float64(len(ip.tempstack[len(ip.tempstack)-1].list))})
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get length of non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "tempstack is empty")
+			ip.exit(1)
+		}
+	case "REMOVE":
+		// Remove an item from an array
+		if len(ip.tempstack) > 1 {
+			if ip.tempstack[len(ip.tempstack)-2].dtype == 4 {
+				if ip.tempstack[len(ip.tempstack)-1].dtype == 0 {
+					if int(ip.tempstack[len(ip.tempstack)-1].val) < len(ip.tempstack[len(ip.tempstack)-2].list) {
+						var i int = int(ip.tempstack[len(ip.tempstack)-1].val)
+						var s stackVal = stackVal{dtype: 4, list: make([]stackVal, 0)}
+						s.list = append(ip.tempstack[len(ip.tempstack)-2].list[:i], ip.tempstack[len(ip.tempstack)-2].list[i+1:]...)
+						ip.dropfrom(&ip.tempstack, 2)
+						ip.pushto(&ip.tempstack, s)
+					} else {
+						fmt.Fprintln(ip.stdout, "Index out of range")
+						ip.exit(1)
+					}
+				} else {
+					fmt.Fprintln(ip.stdout, "Cannot remove non-integer")
+					ip.exit(1)
+				}
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot remove from non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "tempstack is empty")
+			ip.exit(1)
+		}
+	case "RANDINT", "RANDFLOAT", "RANDCHOICE", "SHUFFLE", "SEED":
+		ip.randomop(op, parts[1:], &ip.tempstack, func(name string) (stackVal, bool) {
+			v, ok := ip.module.symbols[name]
+			return v, ok
+		})
+	case "SIN":
+		// Sine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Sin(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get sine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "COS":
+		// Cosine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Cos(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get cosine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "TAN":
+		// Tangent
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Tan(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get tangent of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "ASIN":
+		// Arcsine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Asin(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get arcsine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "ACOS":
+		// Arccosine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Acos(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get arccosine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "ATAN":
+		// Arctangent
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Atan(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get arctangent of non-number")
+				ip.exit(1)
+			}
+		} else {	
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "SQRT":
+		// Square root
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Sqrt(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get square root of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "LN":
+		// Natural logarithm
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Log(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get natural logarithm of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "LOG":
+		// Logarithm
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Log10(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get logarithm of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "IF":
+		// If
+		if len(parts)>2 {
+			cond := ip.symbols[parts[1]]
+			if !(cond.dtype == 2) {
+				fmt.Fprintln(ip.stdout, "Invalid condition")
+				ip.exit(1)
+			}
+			if cond.bval {
+				ip.run(strings.Join(parts[2:], " "))
+			}
+		}
+	case "COMM":
+		// Comment
+	case "MCOMM":
+		// Multi-line comment
+		ip.comment = true
+	case "/*":
+		// Multi-line comment
+		ip.comment = true
+	case "//":
+		// Comment
+	default:
+		if !ip.callkeyword(op, parts, &ip.tempstack) {
+			fmt.Fprintf(ip.stdout, "Invalid operation: %s\n", op)
+			ip.exit(1)
+		}
+	}
+	for name := range ip.module.extvars {
+		ip.module.extvars[name] = ip.module.symbols[name]
+	}
+	ip.modules[ip.modname] = ip.module
+
+}
+
+func (ip *Interpreter) run(code string) {
+	if code == "\n" || code == "" {
+		return
+	}
+	// Split the line into parts
+	code = strings.ReplaceAll(code, "	", "")
+	code = strings.ReplaceAll(code, "    ", "")
+
+	// Split the line into parts
+	parts := strings.Split(code, " ")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+		parts[i] = strings.ReplaceAll(parts[i], "	", "")
+	}
+
+	// Determine the operation
+	op := parts[0]
+	ip.allow(op)
+
+	// Execute the operation
+	switch op {
+	case "PUSH":
+		var s stackVal = stackVal{}
+
+		// Push the value onto the stack
+		val, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			if strings.HasPrefix(strings.Join(parts[1:], " "), "\"") && strings.HasSuffix(strings.Join(parts[1:], " "), "\"") {
+				s.sval = strings.Join(parts[1:], " ")[1 : len(strings.Join(parts[1:], " "))-1]
+				s.dtype = 1
+				ip.push(s)
+			} else if strings.HasPrefix(strings.Join(parts[1:], " "), "'") && strings.HasSuffix(strings.Join(parts[1:], " "), "'") {
+				s.sval = strings.Join(parts[1:], " ")[1 : len(strings.Join(parts[1:], " "))-1]
+				s.dtype = 1
+				ip.push(s)
+			} else if parts[1] == "true" || parts[1] == "false" {
+				s.dtype = 2
+				if parts[1] == "true" {
+					s.bval = true
+				} else {
+					s.bval = false
+				}
+				ip.push(s)
+			}
+
+			/*
+				fmt.Fprintln(stdout, err)
+				exit(1)
+			*/
+		} else {
+			s.val = val
+			s.dtype = 0
+			ip.push(s)
+		}
+
+	case "ADD":
+		// Pop the top two values from the stack and add them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		ip.push(stackVal{val: val1.val + val2.val, dtype: 0})
+	case "SUB":
+		// Pop the top two values from the stack and subtract them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		ip.push(stackVal{val: val1.val - val2.val, dtype: 0})
+	case "MULT":
+		// Pop the top two values from the stack and multiply them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		ip.push(stackVal{val: val1.val * val2.val, dtype: 0})
+	case "DIV":
+		// Pop the top two values from the stack and divide them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		if val1.dtype == 1 || val2.dtype == 1 {
+			fmt.Fprintln(ip.stdout, "Cannot divide strings")
+			ip.exit(1)
+		}
+
+		ip.push(stackVal{val: val1.val / val2.val, dtype: 0})
+	case "STORE":
+		// Pop the top value from the stack and store it in the symbol table
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		ip.setvar(ip.symbols, ip.symname(parts[1]), val)
+	case "LOADARG":
+		// Push an argument of the keyword library case being run
+		val, ok := ip.tempsymbols[parts[1]]
+		if !ok {
+			fmt.Fprintf(ip.stdout, "Undefined argument: %s\n", parts[1])
+			ip.exit(1)
+		}
+		ip.push(val)
+	case "LOAD":
+		// Load the value from the symbol table and push it onto the stack
+		val, ok := ip.symbols[ip.symname(parts[1])]
+		if !ok {
+			fmt.Fprintf(ip.stdout, "Undefined symbol: %s\n", parts[1])
+			ip.exit(1)
+		}
+		if len(parts) > 2 {
+			if val.dtype != 4 {
+				fmt.Fprintln(ip.stdout, "Cannot index non-array")
+				ip.exit(1)
+			}
+			index, err := strconv.Atoi(parts[2])
+			if err != nil {
+				valt, ok := ip.symbols[ip.symname(parts[2])]
+				if !ok {
+					fmt.Fprintf(ip.stdout, "Undefined symbol: %s\n", parts[1])
+					ip.exit(1)
+				} else if valt.dtype != 0 {
+					fmt.Fprintln(ip.stdout, "Index of array must be number")
+					ip.exit(1)
+				} else {
+					index = int(valt.val)
+				}
+			}
+			if index >= len(val.list) {
+				fmt.Fprintln(ip.stdout, "Index out of bounds")
+				ip.exit(1)
+			} else {
+				val = val.list[index]
+			}
+		}
+		ip.push(val)
+	case "PRINT":
+		// Pop the top value from the stack and print it
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype == 1 {
+			fmt.Fprintln(ip.stdout, val.sval)
+		} else if val.dtype == 2 {
+			fmt.Fprintln(ip.stdout, val.bval)
+		} else if val.dtype == 0 {
+			fmt.Fprintln(ip.stdout, val.val)
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot print element")
+		}
+	case "STR":
+		var s stackVal = stackVal{}
+		s.dtype = 1
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype == 0 {
+			s.sval = strconv.FormatFloat(val.val, 'f', -1, 64)
+		} else if val.dtype == 2 {
+			s.sval = strconv.FormatBool(val.bval)
+		} else {
+			s.sval = val.sval
+		}
+		ip.push(s)
+	case "FLOAT":
+		var s stackVal = stackVal{}
+		s.dtype = 0
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype == 1 {
+			i, err := strconv.ParseFloat(val.sval, 64)
+			if err != nil {
+				fmt.Fprintln(ip.stdout, "Cannot convert string to int")
+				ip.exit(1)
+			}
+			s.val = i
+		} else if val.dtype == 2 {
+			fmt.Fprintln(ip.stdout, "Cannot convert bool to int")
+			ip.exit(1)
+		} else {
+			s.val = val.val
+		}
+		ip.push(s)
+	case "BOOL":
+		var s stackVal = stackVal{}
+		s.dtype = 2
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype == 1 {
+			b, err := strconv.ParseBool(val.sval)
+			if err != nil {
+				fmt.Fprintln(ip.stdout, "Cannot convert string to bool")
+				ip.exit(1)
+			}
+			s.bval = b
+		} else if val.dtype == 0 {
+			fmt.Fprintln(ip.stdout, "Cannot convert int to bool")
+			ip.exit(1)
+		} else {
+			s.bval = val.bval
+		}
+		ip.push(s)
+	case "STRCAT":
+		// Pop the top two values from the stack and concatenate them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if !(val1.dtype == 1 || val2.dtype == 1) {
+			fmt.Fprintln(ip.stdout, "Cannot concatenate non-strings")
+			ip.exit(1)
+		}
+		ip.push(stackVal{dtype: 1, sval: val1.sval + val2.sval})
+	case "EQ":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val == val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval == val2.sval})
+		} else {
+			ip.push(stackVal{dtype: 2, bval: val1.bval == val2.bval})
+		}
+	case "NEQ":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val != val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval != val2.sval})
+		} else {
+			ip.push(stackVal{dtype: 2, bval: val1.bval != val2.bval})
+		}
+	case "GT":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val > val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval > val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "GTE":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val >= val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval >= val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "LT":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val < val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval < val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "LTE":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val <= val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval <= val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "NOT":
+		// Pop the top value from the stack and negate it
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype != 2 {
+			fmt.Fprintln(ip.stdout, "Cannot negate non-bool")
+			ip.exit(1)
+		}
+		ip.push(stackVal{dtype: 2, bval: !val.bval})
+	case "AND":
+		// Pop the top two values from the stack and AND them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != 2 || val2.dtype != 2 {
+			fmt.Fprintln(ip.stdout, "Cannot AND non-bools")
+			ip.exit(1)
+		}
+		ip.push(stackVal{dtype: 2, bval: val1.bval && val2.bval})
+	case "OR":
+		// Pop the top two values from the stack and OR them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != 2 || val2.dtype != 2 {
+			fmt.Fprintln(ip.stdout, "Cannot OR non-bools")
+			ip.exit(1)
+		}
+		ip.push(stackVal{dtype: 2, bval: val1.bval || val2.bval})
+	case "DELAYST":
+		// Delay a certain amount of miliseconds
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype != 0 {
+			fmt.Fprintln(ip.stdout, "Cannot delay non-int")
+			ip.exit(1)
+		}
+		ip.sleep(time.Duration(val.val) * time.Millisecond)
+	case "RUN":
+		// Run a function, the optional second argument is a condition to loop on
+		f, ok := ip.funcs[parts[1]]
+		if !ok {
+			fmt.Fprintf(ip.stdout, "No such function: %s\n", parts[1])
+			ip.exit(1)
+		}
+		if len(parts) > 2 {
+			cond, ok := ip.symbols[ip.symname(parts[2])]
+			if !ok {
+				fmt.Fprintf(ip.stdout, "No such symbol: %s\n", parts[2])
+				ip.exit(1)
+			} else if cond.dtype != 2 {
+				fmt.Fprintf(ip.stdout, "Cannot use %s as condition\n", parts[2])
+				ip.exit(1)
+			}
+			f.condition = ip.symname(parts[2])
+		}
+		// Functions do not see the arguments of a keyword case that runs them
+		outer := ip.tempsymbols
+		ip.tempsymbols = make(map[string]stackVal)
+		ip.enter("function " + parts[1])
+		ip.runfunc(f, false)
+		ip.tempsymbols = outer
+		ip.depth--
+	case "EXIT", "ARGS", "ARGC", "GETENV", "SETENV":
+		ip.processop(op, parts[1:], &ip.stack, func(name string) (stackVal, bool) {
+			v, ok := ip.symbols[ip.symname(name)]
+			return v, ok
+		})
+	case "INPUT", "EOF", "READALL":
+		ip.inputop(op, parts[1:], &ip.stack)
+	case "MODSTORE":
+		// Store a value in exported module variable
+		if len(parts) < 3 {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		if parts[1] == "" || parts[2] == "" {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		for name, m := range ip.modules {
+			if name == parts[1] {
+				val := ip.stack[len(ip.stack)-1]
+				ip.drop(1)
+				ip.setvar(m.extvars, parts[2], val)
+			}
+		}
+
+	case "MODGET":
+		// Get a value from exported module variable
+		if len(parts) < 3 {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		if parts[1] == "" || parts[2] == "" {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		for name, m := range ip.modules {
+			if name == parts[1] {
+				for n, modu := range m.extvars {
+					if n == parts[2] {
+						ip.push(modu)
+					}
+				}
+			}
+		}
+	case "CLEAR":
+		// Clear stack
+		ip.clearstack(&ip.stack)
+	case "MAKEARRAY":
+		// Make an array
+		var s stackVal = stackVal{dtype: 4, list: ip.stack}
+		ip.clearstack(&ip.stack)
+		ip.push(s)
+	case "SPLIT":
+		// Split a string
+		if len(parts) > 1 {
+			if len(ip.stack) > 0 {
+				if ip.stack[len(ip.stack)-1].dtype == 1 {
+					split := strings.Split(ip.stack[len(ip.stack)-1].sval, parts[1])
+					ip.drop(1)
+					var s stackVal = stackVal{dtype: 4, list: make([]stackVal, 0)}
+					for _, v := range split {
+						s.list = append(s.list, stackVal{dtype: 1, sval: v})
+					}
+					ip.push(s)
+				} else {
+					fmt.Fprintln(ip.stdout, "Cannot split non-string")
+					ip.exit(1)
+				}
+			} else {
+				fmt.Fprintln(ip.stdout, "Stack is empty")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Invalid split")
+			ip.exit(1)
+		}
+	case "JOIN":
+		// Join a string
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 4 {
+				join := ""
+				for _, v := range ip.stack[len(ip.stack)-1].list {
+					if v.dtype == 1 {
+						join += v.sval
+						/*
+							if index != len(stack[len(stack)-1].list)-1 {
+								if !strings.HasSuffix(parts, "JOIN") {
+									join += parts[1]
+								}
+							}*/
+					} else {
+						fmt.Fprintln(ip.stdout, "Cannot join non-string")
+						ip.exit(1)
+					}
+				}
+				ip.drop(1)
+				var s stackVal = stackVal{dtype: 1, sval: join}
+				ip.push(s)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot join non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "APPEND":
+		// Append to an array
+		if len(ip.stack) > 1 {
+			if ip.stack[len(ip.stack)-1].dtype == 4 {
+				if ip.stack[len(ip.stack)-2].dtype == 4 {
+					ip.stack[len(ip.stack)-2].list = append(ip.stack[len(ip.stack)-2].list, ip.stack[len(ip.stack)-1].list...)
+					ip.stack = ip.stack[:len(ip.stack)-1]
+				} else {
+					ip.stack[len(ip.stack)-2].list = append(ip.stack[len(ip.stack)-2].list, ip.stack[len(ip.stack)-1])
+					ip.stack = ip.stack[:len(ip.stack)-1]
+				}
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot append non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "LEN":
+		// Get the length of an array
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 4 {
+				ip.push(stackVal{dtype: 0, val: float64(len(ip.stack[len(ip.stack)-1].list))})
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get length of non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "REMOVE":
+		// Remove an item from an array
+		if len(ip.stack) > 1 {
+			if ip.stack[len(ip.stack)-2].dtype == 4 {
+				if ip.stack[len(ip.stack)-1].dtype == 0 {
+					if int(ip.stack[len(ip.stack)-1].val) < len(ip.stack[len(ip.stack)-2].list) {
+						var i int = int(ip.stack[len(ip.stack)-1].val)
+						var s stackVal = stackVal{dtype: 4, list: make([]stackVal, 0)}
+						s.list = append(ip.stack[len(ip.stack)-2].list[:i], ip.stack[len(ip.stack)-2].list[i+1:]...)
+						ip.drop(2)
+						ip.push(s)
+					} else {
+						fmt.Fprintln(ip.stdout, "Index out of range")
+						ip.exit(1)
+					}
+				} else {
+					fmt.Fprintln(ip.stdout, "Cannot remove non-integer")
+					ip.exit(1)
+				}
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot remove from non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "RANDINT", "RANDFLOAT", "RANDCHOICE", "SHUFFLE", "SEED":
+		ip.randomop(op, parts[1:], &ip.stack, func(name string) (stackVal, bool) {
+			v, ok := ip.symbols[ip.symname(name)]
+			return v, ok
+		})
+	case "SIN":
+		// Sine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Sin(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get sine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "COS":
+		// Cosine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Cos(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get cosine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "TAN":
+		// Tangent
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Tan(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get tangent of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "ASIN":
+		// Arcsine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Asin(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get arcsine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "ACOS":
+		// Arccosine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Acos(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get arccosine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "ATAN":
+		// Arctangent
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Atan(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get arctangent of non-number")
+				ip.exit(1)
+			}
+		} else {	
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "SQRT":
+		// Square root
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Sqrt(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get square root of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "LN":
+		// Natural logarithm
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Log(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get natural logarithm of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "LOG":
+		// Logarithm
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Log10(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get logarithm of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "IF":
+		// If
+		if len(parts)>2 {
+			cond, ok := ip.tempsymbols[parts[1]]
+			if !ok || cond.dtype != 2 {
+				cond = ip.symbols[ip.symname(parts[1])]
+			}
+			if !(cond.dtype == 2) {
+				fmt.Fprintln(ip.stdout, "Invalid condition")
+				ip.exit(1)
+			}
+			if cond.bval {
+				ip.run(strings.Join(parts[2:], " "))
+			}
+		}
+	case "COMM":
+		// Comment
+	case "MCOMM":
+		// Multi-line comment
+		ip.comment = true
+	case "/*":
+		// Multi-line comment
+		ip.comment = true
+	case "//":
+		// Comment
+	case "ASSERT", "ASSERTEQ", "ASSERTSTACK":
+		ip.assertop(op, parts)
+	default:
+		if !ip.callkeyword(op, parts, &ip.stack) {
+			fmt.Fprintf(ip.stdout, "Invalid operation: %s\n", op)
+			ip.exit(1)
+		}
+	}
+}
+
+// Inside a keyword library case, arguments holding a string refer to the
+// variable with that name, so UTIL SET "x" 5 can STORE into x
+func (ip *Interpreter) symname(name string) string {
+	if arg, ok := ip.tempsymbols[name]; ok {
+		if arg.dtype != 1 {
+			fmt.Fprintf(ip.stdout, "Argument %s is not a string so it cannot name a symbol\n", name)
+			ip.exit(1)
+		}
+		return arg.sval
+	}
+	return name
+}
+
+const maxdepth = 100
+
+// Track nested keyword and function calls so runaway recursion stops with an error
+func (ip *Interpreter) enter(what string) {
+	ip.depth++
+	limit := maxdepth
+	if ip.limits.Depth > 0 {
+		limit = ip.limits.Depth
+	}
+	if ip.depth > limit {
+		fmt.Fprintf(ip.stdout, "Recursion limit of %d calls exceeded in %s\n", limit, what)
+		ip.exit(1)
+	}
+}
+
+// Run the body of a function, repeating it while its condition holds. Every pass is checked
+// against the limits, so a loop whose body is empty or only comments can still be stopped
+func (ip *Interpreter) runfunc(f funct, inmod bool) {
+	name := f.name
+	if inmod {
+		name = ip.modname + " " + f.name
+	}
+	ip.frames = append(ip.frames, frame{name: name, inmod: inmod, args: ip.tempsymbols})
+	if inmod {
+		if f.condition == "" {
+			for i, code := range f.body {
+				ip.step(f.file, f.lines[i], code)
+				ip.runmod(code)
+			}
+		} else {
+			for ip.module.symbols[f.condition].bval {
+				ip.checklimits()
+				for i, code := range f.body {
+					ip.step(f.file, f.lines[i], code)
+					ip.runmod(code)
+				}
+			}
+		}
+	} else {
+		if f.condition == "" {
+			for i, code := range f.body {
+				ip.step(f.file, f.lines[i], code)
+				ip.run(code)
+			}
+		} else {
+			for ip.symbols[f.condition].bval {
+				ip.checklimits()
+				for i, code := range f.body {
+					ip.step(f.file, f.lines[i], code)
+					ip.run(code)
+				}
+			}
+		}
+	}
+	ip.frames = ip.frames[:len(ip.frames)-1]
+	ip.clearstack(&ip.tempstack)
+}
+
+// A function or keyword case being executed, with the line it is at
+type frame struct {
+	name  string
+	file  string
+	line  int
+	steps int
+	inmod bool
+	args  map[string]stackVal
+}
+
+// Record the line the innermost frame is about to execute
+func (ip *Interpreter) step(file string, line int, code string) {
+	if !executable(code) {
+		return
+	}
+	f := &ip.frames[len(ip.frames)-1]
+	f.file = file
+	f.line = line
+	f.steps++
+	ip.checklimits()
+	if ip.coverage != nil {
+		ip.coverline(file, line)
+	}
+	if ip.trace != nil {
+		fmt.Fprintf(ip.trace, "%s: %s\n", showpos(file, line), strings.TrimSpace(code))
+	}
+	if ip.hook != nil {
+		ip.hook(file, line, code)
+	}
+}
+
+// Blank and comment lines are not worth stopping at
+func executable(code string) bool {
+	fields := strings.Fields(code)
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "COMM", "//", "MCOMM", "/*", "ENDCOMM", "*/":
+		return false
+	}
+	return true
+}
+
+type keymod struct {
+	cases  map[string]keycase
+	source string
+}
+
+type keycase struct {
+	params []keyparam
+	code   []string
+	source string
+	file   string
+	lines  []int
+}
+
+// Add loaded keyword libraries to keymods. A prefix may not clash with a core keyword, a
+// registered keyword or a library loaded from another file, mode AS loads a library under the prefix target
+// instead and mode EXTEND adds its cases to the already loaded library target
+func (ip *Interpreter) registerkeymods(path string, libs map[string]keymod, mode string, target string) {
+	if mode != "" && len(libs) != 1 {
+		fmt.Fprintf(ip.stdout, "Cannot use KEYPORT %s %s %s as it defines %d keyword prefixes\n", path, mode, target, len(libs))
+		ip.exit(1)
+	}
+	for prefix, lib := range libs {
+		name := prefix
+		if mode != "" {
+			name = target
+		}
+		_, core := keywordinfos[name]
+		_, host := ip.hostkeywords[name]
+		if (core || host) && mode != "" {
+			kind := "a reserved core keyword"
+			if host {
+				kind = "a registered keyword"
+			}
+			fmt.Fprintf(ip.stdout, "Cannot use KEYPORT %s %s %s as %s is %s, use another prefix\n", path, mode, name, name, kind)
+			ip.exit(1)
+		}
+		if core {
+			fmt.Fprintf(ip.stdout, "Keyword prefix %s from %s is a reserved core keyword, use KEYPORT %s AS <prefix> to rename it\n", name, path, path)
+			ip.exit(1)
+		}
+		if host {
+			fmt.Fprintf(ip.stdout, "Keyword prefix %s from %s clashes with the registered keyword %s, use KEYPORT %s AS <prefix> to rename it\n", name, path, name, path)
+			ip.exit(1)
+		}
+		existing, ok := ip.keymods[name]
+		if mode == "EXTEND" {
+			if !ok {
+				fmt.Fprintf(ip.stdout, "Cannot extend %s as no keyword library with that prefix is loaded\n", name)
+				ip.exit(1)
+			}
+			for c, kc := range lib.cases {
+				if old, ok := existing.cases[c]; ok {
+					fmt.Fprintf(ip.stdout, "Cannot extend %s with %s as %s %s is already defined in %s\n", name, path, name, c, old.source)
+					ip.exit(1)
+				}
+				existing.cases[c] = kc
+			}
+			continue
+		}
+		if ok {
+			// Loading the same library again is harmless
+			if existing.source == lib.source {
+				continue
+			}
+			fmt.Fprintf(ip.stdout, "Keyword prefix %s from %s is already loaded from %s, use KEYPORT %s AS <prefix> to load it under another name or KEYPORT %s EXTEND %s to add its cases\n", name, path, existing.source, path, path, name)
+			ip.exit(1)
+		}
+		ip.keymods[name] = lib
+	}
+}
+
+// A named keyword argument, dtype -1 accepts any type and a
+// parameter with a default value may be left out at the call site
+type keyparam struct {
+	name  string
+	dtype int
+	def   *stackVal
+}
+
+var typenames = map[string]int{"number": 0, "string": 1, "bool": 2, "array": 4, "any": -1}
+
+func typename(dtype int) string {
+	for name, t := range typenames {
+		if t == dtype {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Parse a keyword library, either JSON like built-in/template.kr or KEYWORD blocks
+// written in RED, and check the declared parameters of every case
+func (ip *Interpreter) loadkeymod(path string, byteValue []byte) map[string]keymod {
+	if !strings.HasPrefix(strings.TrimSpace(string(byteValue)), "{") {
+		return ip.loadnativekeymod(path, string(byteValue))
+	}
+	fail := func(format string, a ...interface{}) {
+		fmt.Fprintf(ip.stdout, "Invalid keyword file %s: %s\n", path, fmt.Sprintf(format, a...))
+		ip.exit(1)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(byteValue, &result); err != nil {
+		if serr, ok := err.(*json.SyntaxError); ok {
+			line := 1 + strings.Count(string(byteValue[:serr.Offset]), "\n")
+			fail("line %d: %v", line, err)
+		}
+		fail("%v", err)
+	}
+	prefix, ok := result["prefix"].(string)
+	if !ok || prefix == "" || strings.ContainsAny(prefix, " \t") {
+		fail("prefix must be a single word")
+	}
+	cases, ok := result["main"].([]interface{})
+	if !ok {
+		fail("main must be a list of cases")
+	}
+
+	var util keymod = keymod{cases: make(map[string]keycase), source: path}
+	text := string(byteValue)
+	offset := 0
+	for n, v := range cases {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			fail("case %d must be an object", n+1)
+		}
+		name, ok := obj["case"].(string)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			fail("case %d needs a single word name", n+1)
+		}
+		if _, ok := util.cases[name]; ok {
+			fail("%s %s is defined twice", prefix, name)
+		}
+		code, ok := obj["code"].([]interface{})
+		if !ok {
+			fail("%s %s code must be a list of lines", prefix, name)
+		}
+		var c keycase = keycase{source: path, file: path}
+		for i, o := range code {
+			line, ok := o.(string)
+			if !ok {
+				fail("%s %s code line %d must be a string", prefix, name, i+1)
+			}
+			c.code = append(c.code, line)
+			c.lines = append(c.lines, jsonline(text, &offset, line))
+		}
+		if params, ok := obj["params"]; ok {
+			c.params = loadparams(fail, prefix+" "+name, params)
+		}
+		util.cases[name] = c
+	}
+	return map[string]keymod{prefix: util}
+}
+
+// Find the line of the file a JSON code string is on, searching onwards from offset,
+// 0 when it is written in a way that cannot be found
+func jsonline(text string, offset *int, code string) int {
+	i := strings.Index(text[*offset:], strconv.Quote(code))
+	if i < 0 {
+		return 0
+	}
+	*offset += i + len(strconv.Quote(code))
+	return 1 + strings.Count(text[:*offset], "\n")
+}
+
+func loadparams(fail func(string, ...interface{}), keyword string, params interface{}) []keyparam {
+	list, ok := params.([]interface{})
+	if !ok {
+		fail("%s params must be a list", keyword)
+	}
+	res := []keyparam{}
+	for n, p := range list {
+		obj, ok := p.(map[string]interface{})
+		if !ok {
+			fail("%s parameter %d must be an object", keyword, n+1)
+		}
+		name, ok := obj["name"].(string)
+		if !ok || strings.ContainsAny(name, " \t") {
+			fail("%s parameter %d needs a name without spaces", keyword, n+1)
+		}
+		param := keyparam{name: name, dtype: -1}
+		if t, ok := obj["type"]; ok {
+			tname, _ := t.(string)
+			dtype, ok := typenames[tname]
+			if !ok {
+				fail("%s parameter %s has unknown type %v", keyword, name, t)
+			}
+			param.dtype = dtype
+		}
+		if d, ok := obj["default"]; ok {
+			var s stackVal
+			switch d := d.(type) {
+			case float64:
+				s = stackVal{dtype: 0, val: d}
+			case string:
+				s = stackVal{dtype: 1, sval: d}
+			case bool:
+				s = stackVal{dtype: 2, bval: d}
+			default:
+				fail("%s parameter %s has an invalid default", keyword, name)
+			}
+			param.def = &s
+		}
+		res = append(res, param)
+	}
+	validparams(fail, keyword, res)
+	return res
+}
+
+// Parameter names must be unique, defaults must match their types and
+// parameters with a default can only be followed by others with a default
+func validparams(fail func(string, ...interface{}), keyword string, params []keyparam) {
+	seen := make(map[string]bool)
+	for n, p := range params {
+		if p.name == "" {
+			fail("%s parameter %d needs a name", keyword, n+1)
+		}
+		if seen[p.name] {
+			fail("%s has two parameters called %s", keyword, p.name)
+		}
+		seen[p.name] = true
+		if p.def != nil && p.dtype != -1 && p.def.dtype != p.dtype {
+			fail("%s parameter %s default must be %s", keyword, p.name, typename(p.dtype))
+		}
+		if p.def == nil && n > 0 && params[n-1].def != nil {
+			fail("%s parameter %s without a default follows one with a default", keyword, p.name)
+		}
+	}
+}
+
+// Parse a keyword library made of KEYWORD ... ENDKEYWORD blocks and comments
+func (ip *Interpreter) loadnativekeymod(path string, code string) map[string]keymod {
+	res := make(map[string]keymod)
+	var header string
+	var body []string
+	start := 0
+	incomment := false
+	for n, line := range strings.Split(code, "\n") {
+		line = strings.ReplaceAll(line, "	", "")
+		line = strings.ReplaceAll(line, "    ", "")
+		line = strings.TrimRight(line, "\r")
+		fields := strings.Fields(line)
+		if header != "" {
+			if len(fields) > 0 && fields[0] == "ENDKEYWORD" {
+				ip.definekeyword(res, path, start, header, body)
+				header = ""
+				body = nil
+			} else {
+				body = append(body, line)
+			}
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if incomment {
+			if fields[0] == "ENDCOMM" || fields[0] == "*/" {
+				incomment = false
+			}
+			continue
+		}
+		switch fields[0] {
+		case "KEYWORD":
+			header = line
+			start = n + 1
+		case "MCOMM", "/*":
+			incomment = true
+		case "COMM", "//":
+		default:
+			fmt.Fprintf(ip.stdout, "Invalid keyword file %s:%d: only KEYWORD blocks and comments are allowed\n", path, n+1)
+			ip.exit(1)
+		}
+	}
+	if header != "" {
+		fmt.Fprintf(ip.stdout, "Invalid keyword file %s:%d: KEYWORD without ENDKEYWORD\n", path, start)
+		ip.exit(1)
+	}
+	return res
+}
+
+// Add a case from a KEYWORD block, the header looks like
+// KEYWORD UTIL SET name:string value:any and parameters may have defaults such as count:number=1
+func (ip *Interpreter) definekeyword(into map[string]keymod, file string, line int, header string, body []string) {
+	where := file + ":" + strconv.Itoa(line)
+	fail := func(format string, a ...interface{}) {
+		fmt.Fprintf(ip.stdout, "Invalid keyword definition at %s: %s\n", where, fmt.Sprintf(format, a...))
+		ip.exit(1)
+	}
+	fields := splitargs(header)
+	if len(fields) < 3 {
+		fail("expected KEYWORD PREFIX CASE followed by its parameters")
+	}
+	prefix, name := fields[1], fields[2]
+	if _, core := keywordinfos[prefix]; core {
+		fail("%s is a core keyword and cannot be used as a keyword prefix", prefix)
+	}
+	params := []keyparam{}
+	for _, spec := range fields[3:] {
+		p := keyparam{dtype: -1}
+		def := ""
+		if i := strings.Index(spec, "="); i >= 0 {
+			def = spec[i+1:]
+			spec = spec[:i]
+			v, ok := parseliteral(def)
+			if !ok {
+				fail("parameter %s has an invalid default %s", spec, def)
+			}
+			p.def = &v
+		}
+		if i := strings.Index(spec, ":"); i >= 0 {
+			dtype, ok := typenames[spec[i+1:]]
+			if !ok {
+				fail("parameter %s has unknown type %s", spec[:i], spec[i+1:])
+			}
+			p.dtype = dtype
+			spec = spec[:i]
+		}
+		p.name = spec
+		params = append(params, p)
+	}
+	validparams(fail, prefix+" "+name, params)
+
+	k, ok := into[prefix]
+	if !ok {
+		k = keymod{cases: make(map[string]keycase), source: file}
+	}
+	if old, ok := k.cases[name]; ok {
+		fail("%s %s is already defined at %s", prefix, name, old.source)
+	}
+	lines := make([]int, len(body))
+	for i := range body {
+		lines[i] = line + i + 1
+	}
+	k.cases[name] = keycase{params: params, code: body, source: where, file: file, lines: lines}
+	into[prefix] = k
+}
+
+// Define a KEYWORD block written in a program or module. Like a library loaded with KEYPORT its
+// prefix may not clash with a registered keyword or a library loaded from another file, the
+// blocks of one file add their cases to the same library
+func (ip *Interpreter) defineinline(file string, line int, header string, body []string) {
+	if fields := splitargs(header); len(fields) > 1 {
+		prefix := fields[1]
+		if _, host := ip.hostkeywords[prefix]; host {
+			fmt.Fprintf(ip.stdout, "Keyword prefix %s at %s:%d clashes with the registered keyword %s, use another prefix\n", prefix, file, line, prefix)
+			ip.exit(1)
+		}
+		if k, ok := ip.keymods[prefix]; ok && k.source != file {
+			fmt.Fprintf(ip.stdout, "Keyword prefix %s at %s:%d is already loaded from %s, use another prefix or move the case into a file loaded with KEYPORT file EXTEND %s\n", prefix, file, line, k.source, prefix)
+			ip.exit(1)
+		}
+	}
+	ip.definekeyword(ip.keymods, file, line, header, body)
+}
+
+// Turn a literal keyword argument such as 5, true or "x" into a value, inside
+// a keyword case a bare name passes on one of that case's own arguments
+func (ip *Interpreter) parsekeyarg(a string) stackVal {
+	if v, ok := ip.tempsymbols[a]; ok {
+		return v
+	}
+	v, ok := parseliteral(a)
+	if !ok {
+		fmt.Fprintf(ip.stdout, "%sInvalid argument: %s\n", ip.callsite(), a)
+		ip.exit(1)
+	}
+	return v
+}
+
+// Where the line running now is, eg. main.red:3: to put before errors about how it calls
+// something, or nothing when it is not from a file
+func (ip *Interpreter) callsite() string {
+	f := ip.frames[len(ip.frames)-1]
+	if f.file == "" {
+		return ""
+	}
+	return showpos(f.file, f.line) + ": "
+}
+
+func parseliteral(a string) (stackVal, bool) {
+	num, err := strconv.ParseFloat(a, 64)
+	if err == nil {
+		return stackVal{dtype: 0, val: num}, true
+	}
+	if a == "true" {
+		return stackVal{dtype: 2, bval: true}, true
+	} else if a == "false" {
+		return stackVal{dtype: 2, bval: false}, true
+	} else if len(a) > 1 && strings.HasPrefix(a, "\"") && strings.HasSuffix(a, "\"") {
+		return stackVal{dtype: 1, sval: a[1 : len(a)-1]}, true
+	} else if len(a) > 1 && strings.HasPrefix(a, "'") && strings.HasSuffix(a, "'") {
+		return stackVal{dtype: 1, sval: a[1 : len(a)-1]}, true
+	}
+	return stackVal{}, false
+}
+
+// Split keyword arguments on spaces, keeping quoted strings such as "a b" together
+func splitargs(line string) []string {
+	var args []string
+	var quote rune
+	start := -1
+	for i, r := range line {
+		if quote != 0 {
+			if r == quote {
+				quote = 0
+			}
+			continue
+		}
+		if r == ' ' {
+			if start >= 0 {
+				args = append(args, line[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		if r == '"' || r == '\'' {
+			quote = r
+		}
+	}
+	if start >= 0 {
+		args = append(args, line[start:])
+	}
+	return args
+}
+
+// The problem with calling a keyword case with given arguments, eg. UTIL SET expects 2
+// arguments (name:string, value:any), got 1, or nothing when it is the right number
+func argcount(keyword string, params []keyparam, given int) string {
+	required := 0
+	for _, p := range params {
+		if p.def == nil {
+			required++
+		}
+	}
+	if given >= required && given <= len(params) {
+		return ""
+	}
+	expects := strconv.Itoa(len(params))
+	if required != len(params) {
+		expects = strconv.Itoa(required) + " to " + expects
+	}
+	plural := "s"
+	if expects == "1" {
+		plural = ""
+	}
+	return fmt.Sprintf("%s expects %s argument%s %s, got %d", keyword, expects, plural, signature(params), given)
+}
+
+// Describe a case's parameters for error messages, eg. (name:string, value:any)
+func signature(params []keyparam) string {
+	var list []string
+	for _, p := range params {
+		desc := p.name + ":" + typename(p.dtype)
+		if p.def != nil {
+			desc += "?"
+		}
+		list = append(list, desc)
+	}
+	return "(" + strings.Join(list, ", ") + ")"
+}
+
+// Run a keyword library call such as UTIL SET "x" 5, the arguments are made available to
+// the case's code under their parameter names and as term0, term1 and so on. Keywords
+// registered by an embedding program are called here too, on stack, the stack of the code
+// calling them
+func (ip *Interpreter) callkeyword(op string, parts []string, stack *[]stackVal) bool {
+	if h, ok := ip.hostkeywords[op]; ok {
+		ip.callhost(op, h, stack)
+		return true
+	}
+	v, ok := ip.keymods[op]
+	if !ok {
+		return false
+	}
+	if !(len(parts) > 1) {
+		fmt.Fprintln(ip.stdout, "Invalid operation")
+		ip.exit(1)
+	}
+	c, ok := v.cases[parts[1]]
+	if !ok {
+		return false
+	}
+
+	var args []stackVal
+	for _, a := range splitargs(strings.Join(parts[2:], " ")) {
+		args = append(args, ip.parsekeyarg(a))
+	}
+
+	outer := ip.tempsymbols
+	ip.tempsymbols = make(map[string]stackVal)
+	ip.enter(op + " " + parts[1])
+
+	if c.params != nil {
+		if msg := argcount(op+" "+parts[1], c.params, len(args)); msg != "" {
+			fmt.Fprintln(ip.stdout, ip.callsite()+msg)
+			ip.exit(1)
+		}
+		for n, p := range c.params {
+			if n >= len(args) {
+				args = append(args, *p.def)
+			}
+			if p.dtype != -1 && args[n].dtype != p.dtype {
+				fmt.Fprintf(ip.stdout, "%s%s %s argument %s must be %s, got %s\n", ip.callsite(), op, parts[1], p.name, typename(p.dtype), typename(args[n].dtype))
+				ip.exit(1)
+			}
+			ip.setvar(ip.tempsymbols, p.name, args[n])
+		}
+	}
+	for n, a := range args {
+		ip.setvar(ip.tempsymbols, "term"+strconv.Itoa(n), a)
+	}
+
+	ip.frames = append(ip.frames, frame{name: op + " " + parts[1], args: ip.tempsymbols})
+	for i, line := range c.code {
+		ip.step(c.file, c.lines[i], line)
+		ip.run(line)
+	}
+	ip.frames = ip.frames[:len(ip.frames)-1]
+	ip.tempsymbols = outer
+	ip.depth--
+	return true
+}
+
+// A TEST block, line is where it starts
+type testblock struct {
+	funct
+	line int
+}
+
+// Initialize the symbol table and the stack
+func (ip *Interpreter) initstate() {
+	ip.activefuncwrite, ip.activekeywrite, ip.activetestwrite, ip.runningfunc, ip.comment = false, false, false, false, false
+	ip.activefunc, ip.activetest, ip.running = funct{}, testblock{}, funct{}
+	ip.tests = nil
+	ip.tempsymbols = make(map[string]stackVal)
+	ip.tempstack = make([]stackVal, 0)
+	ip.depth = 0
+	ip.modules = make(map[string]mod)
+	ip.symbols = make(map[string]stackVal)
+	ip.funcs = make(map[string]funct)
+	ip.keymods = make(map[string]keymod)
+	ip.stack = make([]stackVal, 0)
+	ip.frames = []frame{{name: "main", args: ip.tempsymbols}}
+
+	ip.symbols["PI"] = stackVal{dtype: 0, val: math.Pi}
+	ip.symbols["EULER"] = stackVal{dtype: 0, val: math.E}
+}
+
+// Execute the lines of a program file
+func (ip *Interpreter) runlines(filename string, lines []string) {
+	if ip.coverage != nil && filename != "" {
+		if _, ok := ip.coverage[filepath.Clean(filename)]; !ok {
+			ip.coverage[filepath.Clean(filename)] = make(map[int]int)
+		}
+	}
+	// Iterate through the lines and compile them
+	for n, line := range lines {
+		ip.runline(filename, n+1, line)
+	}
+
+	if ip.activekeywrite {
+		fmt.Fprintf(ip.stdout, "Invalid keyword definition at %s:%d: KEYWORD without ENDKEYWORD\n", filename, ip.keyline)
+		ip.exit(1)
+	}
+	if ip.activetestwrite {
+		fmt.Fprintf(ip.stdout, "Invalid test at %s:%d: TEST without ENDTEST\n", filename, ip.activetest.line)
+		ip.exit(1)
+	}
+
+	ip.runpending()
+}
+
+// Execute a single top level line, n is its line number in filename
+func (ip *Interpreter) runline(filename string, n int, line string) {
+	// Skip empty lines
+	if line == "" {
+		return
+	}
+
+	line = strings.ReplaceAll(line, "	", "")
+	line = strings.ReplaceAll(line, "    ", "")
+
+	// Split the line into parts
+	parts := strings.Split(line, " ")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+		parts[i] = strings.ReplaceAll(parts[i], "	", "")
+	}
+	// Determine the operation
+	op := parts[0]
+	if ip.comment {
+		if op == "ENDCOMM" || op == "*/" {
+			ip.comment = false
+		}
+		return
+	}
+	if ip.activefuncwrite == true {
+		if op == "ENDFUNC" {
+
+			ip.activefuncwrite = false
+			ip.funcs[ip.activefunc.name] = ip.activefunc
+			ip.activefunc = funct{}
+			return
+		} else {
+			ip.activefunc.body = append(ip.activefunc.body, line)
+			ip.activefunc.lines = append(ip.activefunc.lines, n)
+			return
+		}
+	}
+	if ip.activetestwrite {
+		if op == "ENDTEST" {
+			ip.activetestwrite = false
+			ip.tests = append(ip.tests, ip.activetest)
+			ip.activetest = testblock{}
+		} else {
+			ip.activetest.body = append(ip.activetest.body, line)
+			ip.activetest.lines = append(ip.activetest.lines, n)
+		}
+		return
+	}
+	if ip.activekeywrite {
+		if op == "ENDKEYWORD" {
+			ip.activekeywrite = false
+			ip.defineinline(filename, ip.keyline, ip.keyheader, ip.keybody)
+		} else {
+			ip.keybody = append(ip.keybody, line)
+		}
+		return
+	}
+
+	ip.runpending()
+	ip.step(filename, n, line)
+	ip.allow(op)
+
+	// Execute the operation
+	switch op {
+	case "KEYPORT":
+		// import .kr file with keywords, optionally AS another prefix or to EXTEND a loaded one
+		if !(len(parts) == 2 || (len(parts) == 4 && (parts[2] == "AS" || parts[2] == "EXTEND"))) {
+			fmt.Fprintln(ip.stdout, "Invalid keyword call, expected KEYPORT file, KEYPORT file AS PREFIX or KEYPORT file EXTEND PREFIX")
+			ip.exit(1)
+		} else {
+			libs, err := ip.readkeymod(parts[1], filename)
+
+			if err != nil {
+				fmt.Fprintln(ip.stdout, "Invalid keyword file")
+				ip.exit(1)
+			}
+
+			mode, target := "", ""
+			if len(parts) == 4 {
+				mode, target = parts[2], parts[3]
+			}
+			ip.registerkeymods(parts[1], libs, mode, target)
+		}
+
+	case "PUSH":
+		var s stackVal = stackVal{}
+
+		// Push the value onto the stack
+		val, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			if strings.HasPrefix(strings.Join(parts[1:], " "), "\"") && strings.HasSuffix(strings.Join(parts[1:], " "), "\"") {
+				s.sval = strings.Join(parts[1:], " ")[1 : len(strings.Join(parts[1:], " "))-1]
+				s.dtype = 1
+				ip.push(s)
+			} else if strings.HasPrefix(strings.Join(parts[1:], " "), "'") && strings.HasSuffix(strings.Join(parts[1:], " "), "'") {
+				s.sval = strings.Join(parts[1:], " ")[1 : len(strings.Join(parts[1:], " "))-1]
+				s.dtype = 1
+				ip.push(s)
+			} else if parts[1] == "true" || parts[1] == "false" {
+				s.dtype = 2
+				if parts[1] == "true" {
+					s.bval = true
+				} else {
+					s.bval = false
+				}
+				ip.push(s)
+			}
+
+			/*
+				fmt.Fprintln(stdout, err)
+				exit(1)
+			*/
+		} else {
+			s.val = val
+			s.dtype = 0
+			ip.push(s)
+		}
+
+	case "ADD":
+		// Pop the top two values from the stack and add them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		ip.push(stackVal{val: val1.val + val2.val, dtype: 0})
+	case "SUB":
+		// Pop the top two values from the stack and subtract them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		ip.push(stackVal{val: val1.val - val2.val, dtype: 0})
+	case "MULT":
+		// Pop the top two values from the stack and multiply them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		ip.push(stackVal{val: val1.val * val2.val, dtype: 0})
+	case "DIV":
+		// Pop the top two values from the stack and divide them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot operate non-numbers")
+			ip.exit(1)
+		}
+
+		if !(val1.dtype == 0 || val2.dtype == 0) {
+			fmt.Fprintln(ip.stdout, "Cannot divide non-numbers")
+			ip.exit(1)
+		}
+
+		ip.push(stackVal{val: val1.val / val2.val, dtype: 0})
+	case "STORE":
+		// Pop the top value from the stack and store it in the symbol table
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		ip.setvar(ip.symbols, parts[1], val)
+	case "LOAD":
+		// Load the value from the symbol table and push it onto the stack
+
+		val, ok := ip.symbols[parts[1]]
+		if !ok {
+			fmt.Fprintf(ip.stdout, "Undefined symbol: %s\n", parts[1])
+			ip.exit(1)
+		}
+		if len(parts) > 2 {
+			if val.dtype != 4 {
+				fmt.Fprintln(ip.stdout, "Cannot index non-array")
+				ip.exit(1)
+			}
+			index, err := strconv.Atoi(parts[2])
+			if err != nil {
+				valt, ok := ip.symbols[parts[2]]
+				if !ok {
+					fmt.Fprintf(ip.stdout, "Undefined symbol: %s\n", parts[1])
+					ip.exit(1)
+				} else if valt.dtype != 0 {
+					fmt.Fprintln(ip.stdout, "Index of array must be number")
+					ip.exit(1)
+				} else {
+					index = int(valt.val)
+				}
+			}
+			if index >= len(val.list) {
+				fmt.Fprintln(ip.stdout, "Index out of bounds")
+				ip.exit(1)
+			} else {
+				val = val.list[index]
+			}
+		}
+		ip.push(val)
+	case "PRINT":
+		// Pop the top value from the stack and print it
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype == 1 {
+			fmt.Fprintln(ip.stdout, val.sval)
+		} else if val.dtype == 2 {
+			fmt.Fprintln(ip.stdout, val.bval)
+		} else if val.dtype == 0 {
+			fmt.Fprintln(ip.stdout, val.val)
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot print element")
+		}
+	case "STR":
+		var s stackVal = stackVal{}
+		s.dtype = 1
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype == 0 {
+			s.sval = strconv.FormatFloat(val.val, 'f', -1, 64)
+		} else if val.dtype == 2 {
+			s.sval = strconv.FormatBool(val.bval)
+		} else {
+			s.sval = val.sval
+		}
+		ip.push(s)
+	case "FLOAT":
+		var s stackVal = stackVal{}
+		s.dtype = 0
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype == 1 {
+			i, err := strconv.ParseFloat(val.sval, 64)
+			if err != nil {
+				fmt.Fprintln(ip.stdout, "Cannot convert string to int")
+				ip.exit(1)
+			}
+			s.val = i
+		} else if val.dtype == 2 {
+			fmt.Fprintln(ip.stdout, "Cannot convert bool to int")
+			ip.exit(1)
+		} else {
+			s.val = val.val
+		}
+		ip.push(s)
+	case "BOOL":
+		var s stackVal = stackVal{}
+		s.dtype = 2
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype == 1 {
+			b, err := strconv.ParseBool(val.sval)
+			if err != nil {
+				fmt.Fprintln(ip.stdout, "Cannot convert string to bool")
+				ip.exit(1)
+			}
+			s.bval = b
+		} else if val.dtype == 0 {
+			fmt.Fprintln(ip.stdout, "Cannot convert int to bool")
+			ip.exit(1)
+		} else {
+			s.bval = val.bval
+		}
+		ip.push(s)
+	case "STRCAT":
+		// Pop the top two values from the stack and concatenate them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if !(val1.dtype == 1 || val2.dtype == 1) {
+			fmt.Fprintln(ip.stdout, "Cannot concatenate non-strings")
+			ip.exit(1)
+		}
+		ip.push(stackVal{dtype: 1, sval: val1.sval + val2.sval})
+	case "EQ":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val == val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval == val2.sval})
+		} else {
+			ip.push(stackVal{dtype: 2, bval: val1.bval == val2.bval})
+		}
+	case "NEQ":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val != val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval != val2.sval})
+		} else {
+			ip.push(stackVal{dtype: 2, bval: val1.bval != val2.bval})
+		}
+	case "GT":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val > val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval > val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "GTE":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val >= val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval >= val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "LT":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val < val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval < val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "LTE":
+		// Pop the top two values from the stack and compare them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != val2.dtype {
+			fmt.Fprintln(ip.stdout, "Cannot compare different types")
+			ip.exit(1)
+		}
+		if val1.dtype == 0 {
+			ip.push(stackVal{dtype: 2, bval: val1.val <= val2.val})
+		} else if val1.dtype == 1 {
+			ip.push(stackVal{dtype: 2, bval: val1.sval <= val2.sval})
+		} else {
+			fmt.Fprintln(ip.stdout, "Cannot compare bools")
+			ip.exit(1)
+		}
+	case "NOT":
+		// Pop the top value from the stack and negate it
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype != 2 {
+			fmt.Fprintln(ip.stdout, "Cannot negate non-bool")
+			ip.exit(1)
+		}
+		ip.push(stackVal{dtype: 2, bval: !val.bval})
+	case "AND":
+		// Pop the top two values from the stack and AND them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != 2 || val2.dtype != 2 {
+			fmt.Fprintln(ip.stdout, "Cannot AND non-bools")
+			ip.exit(1)
+		}
+		ip.push(stackVal{dtype: 2, bval: val1.bval && val2.bval})
+	case "OR":
+		// Pop the top two values from the stack and OR them
+		val1 := ip.stack[len(ip.stack)-1]
+		val2 := ip.stack[len(ip.stack)-2]
+		ip.drop(2)
+		if val1.dtype != 2 || val2.dtype != 2 {
+			fmt.Fprintln(ip.stdout, "Cannot OR non-bools")
+			ip.exit(1)
+		}
+		ip.push(stackVal{dtype: 2, bval: val1.bval || val2.bval})
+	case "DELAYST":
+		// Delay a certain amount of miliseconds
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype != 0 {
+			fmt.Fprintln(ip.stdout, "Cannot delay non-int")
+			ip.exit(1)
+		}
+		ip.sleep(time.Duration(val.val) * time.Millisecond)
+	case "FUNC":
+		ip.activefuncwrite = true
+		ip.activefunc.name = parts[1]
+		ip.activefunc.file = filename
+
+	case "TEST":
+		// Collect a test until ENDTEST, only red test runs it
+		if len(parts) < 2 {
+			fmt.Fprintln(ip.stdout, "Invalid syntax, expected TEST name")
+			ip.exit(1)
+		}
+		ip.activetestwrite = true
+		ip.activetest = testblock{funct: funct{name: parts[1], file: filename}, line: n}
+
+	case "KEYWORD":
+		// Define a keyword library case in place, ending at ENDKEYWORD
+		ip.activekeywrite = true
+		ip.keyheader = line
+		ip.keybody = nil
+		ip.keyline = n
+
+	case "RUN":
+		for i, f := range ip.funcs {
+			if i == parts[1] {
+				ip.runningfunc = true
+				ip.running = f
+				ip.frommod = false
+				break
+			}
+		}
+		if len(parts) > 2 {
+			ip.running.condition = ""
+			for l, v := range ip.symbols {
+				if l == parts[2] {
+					if v.dtype == 2 {
+						ip.running.condition = l
+						break
+					} else {
+						fmt.Fprintf(ip.stdout, "Cannot use %s as condition\n", parts[2])
+						ip.exit(1)
+					}
+				}
+			}
+			if ip.running.condition == "" {
+				fmt.Fprintf(ip.stdout, "No such symbol: %s\n", parts[2])
+				ip.exit(1)
+			}
+			if len(parts) > 3 {
+				for i := 3; i < len(parts); i++ {
+					ip.running.args = append(ip.running.args, parts[i])
+				}
+			}
+		}
+		if !ip.runningfunc {
+			fmt.Fprintf(ip.stdout, "No such function: %s\n", parts[1])
+			ip.exit(1)
+		}
+	case "EXIT", "ARGS", "ARGC", "GETENV", "SETENV":
+		ip.processop(op, parts[1:], &ip.stack, func(name string) (stackVal, bool) {
+			v, ok := ip.symbols[name]
+			return v, ok
+		})
+	case "MODSTORE":
+		// Store a value in exported module variable
+		if len(parts) < 3 {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		if parts[1] == "" || parts[2] == "" {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		for name, m := range ip.modules {
+			if name == parts[1] {
+				val := ip.stack[len(ip.stack)-1]
+				ip.drop(1)
+				ip.setvar(m.extvars, parts[2], val)
+			}
+		}
+
+	case "MODGET":
+		// Get a value from exported module variable
+		if len(parts) < 3 {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		if parts[1] == "" || parts[2] == "" {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		for name, m := range ip.modules {
+			if name == parts[1] {
+				for n, modu := range m.extvars {
+					if n == parts[2] {
+						ip.push(modu)
+					}
+				}
+			}
+		}
+
+	case "MODRUN":
+		// Run a function from a module
+		if len(parts) < 3 {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		if parts[1] == "" || parts[2] == "" {
+			fmt.Fprintln(ip.stdout, "Invalid syntax")
+			ip.exit(1)
+		}
+		ip.running.condition = ""
+		for name, m := range ip.modules {
+			if name == parts[1] {
+				for n, modu := range m.funcs {
+					if n == parts[2] {
+						ip.runningfunc = true
+						ip.running = modu
+						ip.frommod = true
+						ip.module = m
+						ip.modname = name
+						break
+					}
+				}
+			}
+		}
+		if len(parts) > 3 {
+			for l, v := range ip.module.symbols {
+				if l == parts[3] {
+					if v.dtype == 2 {
+						ip.running.condition = l
+						break
+					} else {
+						fmt.Fprintf(ip.stdout, "Cannot use %s as condition\n", parts[3])
+						ip.exit(1)
+					}
+				}
+			}
+			if ip.running.condition == "" {
+				fmt.Fprintf(ip.stdout, "No such symbol: %s\n", parts[3])
+				ip.exit(1)
+			}
+		}
+	case "CLEAR":
+		// Clear stack
+		ip.clearstack(&ip.stack)
+	case "MAKEARRAY":
+		// Make an array
+		var s stackVal = stackVal{dtype: 4, list: ip.stack}
+		ip.clearstack(&ip.stack)
+		ip.push(s)
+	case "IMPORT":
+		// Import a file
+		lines, err := ip.readlines(parts[1], filename)
+		if err != nil {
+			fmt.Fprintln(ip.stdout, "Invalid module")
+			ip.exit(1)
+		}
+		m := mod{funcs: make(map[string]funct), symbols: make(map[string]stackVal, 0), extvars: make(map[string]stackVal, 0)}
+		active := false
+		activef := funct{}
+		activekey := false
+		var keyheader string
+		var keybody []string
+		keyline := 0
+		for n, line := range lines {
+			if activekey {
+				if strings.HasPrefix(strings.TrimSpace(line), "ENDKEYWORD") {
+					activekey = false
+					ip.defineinline(parts[1], keyline, keyheader, keybody)
+				} else {
+					keybody = append(keybody, line)
+				}
+				continue
+			}
+			if active {
+				if strings.HasPrefix(line, "ENDFUNC") {
+					active = false
+					m.funcs[activef.name] = activef
+					activef = funct{}
+					continue
+				} else {
+					activef.body = append(activef.body, line)
+					activef.lines = append(activef.lines, n+1)
+					continue
+				}
+			}
+			if line != "" {
+				partsin := strings.Split(line, " ")
+				switch partsin[0] {
+				case "EXPORT":
+					// Export a symbol
+					if len(partsin) > 2 {
+						val, err := strconv.ParseFloat(partsin[2], 64)
+						if err != nil {
+							fmt.Fprintln(ip.stdout, "Invalid export")
+							ip.exit(1)
+						}
+						var s stackVal = stackVal{dtype: 0, val: val}
+						m.extvars[partsin[1]] = s
+					} else {
+						fmt.Fprintln(ip.stdout, "Invalid export")
+						ip.exit(1)
+					}
+				case "EXARR":
+					// Export an array
+					if len(partsin) > 1 {
+						var s stackVal = stackVal{dtype: 4, list: ip.stack}
+						m.extvars[partsin[1]] = s
+					} else {
+						fmt.Fprintln(ip.stdout, "Invalid export")
+						ip.exit(1)
+					}
+				case "COMM":
+					// Comment
+				case "MCOMM":
+					// Multi-line comment
+					ip.comment = true
+				case "/*":
+					// Multi-line comment
+					ip.comment = true
+				case "//":
+					// Comment
+				case "SET":
+					// Set a symbol
+					if len(partsin) > 2 {
+						if partsin[2] == "true" || partsin[2] == "false" {
+							if partsin[2] == "true" {
+								m.symbols[partsin[1]] = stackVal{dtype: 2, bval: true}
+							} else {
+								m.symbols[partsin[1]] = stackVal{dtype: 2, bval: false}
+							}
+						} else {
+							fmt.Fprintln(ip.stdout, "SET is used for boolean values only")
+							ip.exit(1)
+						}
+					} else {
+						fmt.Fprintln(ip.stdout, "Invalid set")
+						ip.exit(1)
+					}
+				case "FUNC":
+					active = true
+					activef.name = partsin[1]
+					activef.file = parts[1]
+				case "KEYWORD":
+					// Keyword library case defined by the module
+					activekey = true
+					keyheader = strings.TrimSpace(strings.ReplaceAll(line, "	", ""))
+					keybody = nil
+					keyline = n + 1
+
+				default:
+					fmt.Fprintln(ip.stdout, "Invalid module")
+					ip.exit(1)
+				}
+
+			}
+		}
+		if activekey {
+			fmt.Fprintf(ip.stdout, "Invalid keyword definition at %s:%d: KEYWORD without ENDKEYWORD\n", parts[1], keyline)
+			ip.exit(1)
+		}
+		ip.modules[parts[2]] = m
+	case "SPLIT":
+		// Split a string
+		if len(parts) > 1 {
+			if len(ip.stack) > 0 {
+				if ip.stack[len(ip.stack)-1].dtype == 1 {
+					split := strings.Split(ip.stack[len(ip.stack)-1].sval, parts[1])
+					ip.drop(1)
+					var s stackVal = stackVal{dtype: 4, list: make([]stackVal, 0)}
+					for _, v := range split {
+						s.list = append(s.list, stackVal{dtype: 1, sval: v})
+					}
+					ip.push(s)
+				} else {
+					fmt.Fprintln(ip.stdout, "Cannot split non-string")
+					ip.exit(1)
+				}
+			} else {
+				fmt.Fprintln(ip.stdout, "Stack is empty")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Invalid split")
+			ip.exit(1)
+		}
+	case "JOIN":
+		// Join a string
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 4 {
+				join := ""
+				for _, v := range ip.stack[len(ip.stack)-1].list {
+					if v.dtype == 1 {
+						join += v.sval
+						/*
+							if index != len(stack[len(stack)-1].list)-1 {
+								if !strings.HasSuffix(parts, "JOIN") {
+									join += parts[1]
+								}
+							}*/
+					} else {
+						fmt.Fprintln(ip.stdout, "Cannot join non-string")
+						ip.exit(1)
+					}
+				}
+				ip.drop(1)
+				var s stackVal = stackVal{dtype: 1, sval: join}
+				ip.push(s)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot join non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "APPEND":
+		// Append to an array
+		if len(ip.stack) > 1 {
+			if ip.stack[len(ip.stack)-1].dtype == 4 {
+				if ip.stack[len(ip.stack)-2].dtype == 4 {
+					ip.stack[len(ip.stack)-2].list = append(ip.stack[len(ip.stack)-2].list, ip.stack[len(ip.stack)-1].list...)
+					ip.stack = ip.stack[:len(ip.stack)-1]
+				} else {
+					ip.stack[len(ip.stack)-2].list = append(ip.stack[len(ip.stack)-2].list, ip.stack[len(ip.stack)-1])
+					ip.stack = ip.stack[:len(ip.stack)-1]
+				}
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot append non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "LEN":
+		// Get the length of an array
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 4 {
+				ip.push(stackVal{dtype: 0, val: float64(len(ip.stack[len(ip.stack)-1].list))})
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get length of non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "REMOVE":
+		// Remove an item from an array
+		if len(ip.stack) > 1 {
+			if ip.stack[len(ip.stack)-2].dtype == 4 {
+				if ip.stack[len(ip.stack)-1].dtype == 0 {
+					if int(ip.stack[len(ip.stack)-1].val) < len(ip.stack[len(ip.stack)-2].list) {
+						var i int = int(ip.stack[len(ip.stack)-1].val)
+						var s stackVal = stackVal{dtype: 4, list: make([]stackVal, 0)}
+						s.list = append(ip.stack[len(ip.stack)-2].list[:i], ip.stack[len(ip.stack)-2].list[i+1:]...)
+						ip.drop(2)
+						ip.push(s)
+					} else {
+						fmt.Fprintln(ip.stdout, "Index out of range")
+						ip.exit(1)
+					}
+				} else {
+					fmt.Fprintln(ip.stdout, "Cannot remove non-integer")
+					ip.exit(1)
+				}
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot remove from non-array")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "COMM":
+		// Comment
+	case "MCOMM":
+		// Multi-line comment
+		ip.comment = true
+	case "/*":
+		// Multi-line comment
+		ip.comment = true
+	case "//":
+		// Comment
+	case "RANDINT", "RANDFLOAT", "RANDCHOICE", "SHUFFLE", "SEED":
+		ip.randomop(op, parts[1:], &ip.stack, func(name string) (stackVal, bool) {
+			v, ok := ip.symbols[name]
+			return v, ok
+		})
+	case "SIN":
+		// Sine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Sin(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get sine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "COS":
+		// Cosine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Cos(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get cosine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "TAN":
+		// Tangent
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Tan(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get tangent of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "ASIN":
+		// Arcsine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Asin(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get arcsine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "ACOS":
+		// Arccosine
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Acos(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get arccosine of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "ATAN":
+		// Arctangent
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Atan(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get arctangent of non-number")
+				ip.exit(1)
+			}
+		} else {	
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "SQRT":
+		// Square root
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Sqrt(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get square root of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "LN":
+		// Natural logarithm
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Log(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get natural logarithm of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "INPUT", "EOF", "READALL":
+		ip.inputop(op, parts[1:], &ip.stack)
+	case "LOG":
+		// Logarithm
+		if len(ip.stack) > 0 {
+			if ip.stack[len(ip.stack)-1].dtype == 0 {
+				ip.stack[len(ip.stack)-1].val = math.Log10(ip.stack[len(ip.stack)-1].val)
+			} else {
+				fmt.Fprintln(ip.stdout, "Cannot get logarithm of non-number")
+				ip.exit(1)
+			}
+		} else {
+			fmt.Fprintln(ip.stdout, "Stack is empty")
+			ip.exit(1)
+		}
+	case "IF":
+		// If
+		if len(parts)>2 {
+			cond := ip.symbols[parts[1]]
+			if !(cond.dtype == 2) {
+				fmt.Fprintln(ip.stdout, "Invalid condition")
+				ip.exit(1)
+			}
+			if cond.bval {
+				ip.run(strings.Join(parts[2:], " "))
+			}
+		}
+
+	case "ASSERT", "ASSERTEQ", "ASSERTSTACK":
+		ip.assertop(op, parts)
+
+	default:
+		if ip.callkeyword(op, parts, &ip.stack) {
+			return
+		}
+		fmt.Fprintf(ip.stdout, "Invalid operation: %s\n", op)
+		ip.exit(1)
+
+	}
+}
+
+// Stop the program because an assertion does not hold
+func (ip *Interpreter) assertfail(format string, a ...interface{}) {
+	f := ip.frames[len(ip.frames)-1]
+	ip.failed = showpos(f.file, f.line) + ": " + fmt.Sprintf(format, a...)
+	fmt.Fprintln(ip.stdout, "Assertion failed at "+ip.failed)
+	ip.exit(1)
+}
+
+// Whether two values have the same type and value, arrays item by item
+func sameval(a stackVal, b stackVal) bool {
+	if a.dtype != b.dtype {
+		return false
+	}
+	switch a.dtype {
+	case 0:
+		return a.val == b.val
+	case 1:
+		return a.sval == b.sval
+	case 2:
+		return a.bval == b.bval
+	case 4:
+		if len(a.list) != len(b.list) {
+			return false
+		}
+		for i := range a.list {
+			if !sameval(a.list[i], b.list[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// Run ASSERT, ASSERTEQ or ASSERTSTACK
+func (ip *Interpreter) assertop(op string, parts []string) {
+	args := splitargs(strings.Join(parts[1:], " "))
+	switch op {
+	case "ASSERT":
+		if len(ip.stack) == 0 {
+			ip.assertfail("ASSERT needs a bool but the stack is empty")
+		}
+		val := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if val.dtype != 2 {
+			ip.assertfail("ASSERT needs a bool, got %s", showval(val))
+		}
+		if !val.bval {
+			msg := "ASSERT failed"
+			if len(args) > 0 {
+				if v, ok := parseliteral(strings.Join(args, " ")); ok && v.dtype == 1 {
+					msg = v.sval
+				} else {
+					msg = strings.Join(args, " ")
+				}
+			}
+			ip.assertfail("%s", msg)
+		}
+	case "ASSERTEQ":
+		var expected stackVal
+		if len(args) > 0 {
+			v, ok := parseliteral(args[0])
+			if !ok {
+				fmt.Fprintf(ip.stdout, "Invalid value %s\n", args[0])
+				ip.exit(1)
+			}
+			expected = v
+		} else {
+			if len(ip.stack) == 0 {
+				ip.assertfail("ASSERTEQ needs two values but the stack is empty")
+			}
+			expected = ip.stack[len(ip.stack)-1]
+			ip.drop(1)
+		}
+		if len(ip.stack) == 0 {
+			ip.assertfail("ASSERTEQ expected %s but the stack is empty", showval(expected))
+		}
+		got := ip.stack[len(ip.stack)-1]
+		ip.drop(1)
+		if !sameval(expected, got) {
+			ip.assertfail("ASSERTEQ expected %s, got %s", showval(expected), showval(got))
+		}
+	case "ASSERTSTACK":
+		var expected []stackVal
+		for _, a := range args {
+			v, ok := parseliteral(a)
+			if !ok {
+				fmt.Fprintf(ip.stdout, "Invalid value %s\n", a)
+				ip.exit(1)
+			}
+			expected = append(expected, v)
+		}
+		if !sameval(stackVal{dtype: 4, list: expected}, stackVal{dtype: 4, list: ip.stack}) {
+			ip.assertfail("ASSERTSTACK expected the stack %s, got %s", showstack(expected), showstack(ip.stack))
+		}
+	}
+}
+
+// RANDINT, RANDFLOAT, RANDCHOICE, SHUFFLE and SEED working on stack, lookup finds the
+// variables that numbers can be given as
+func (ip *Interpreter) randomop(op string, args []string, stack *[]stackVal, lookup func(name string) (stackVal, bool)) {
+	pop := func(dtype int, what string) stackVal {
+		if len(*stack) == 0 {
+			fmt.Fprintf(ip.stdout, "%s needs %s on the stack\n", op, what)
+			ip.exit(1)
+		}
+		v := (*stack)[len(*stack)-1]
+		if v.dtype != dtype {
+			fmt.Fprintf(ip.stdout, "%s needs %s on the stack, got %s\n", op, what, typename(v.dtype))
+			ip.exit(1)
+		}
+		ip.dropfrom(stack, 1)
+		return v
+	}
+	// A number written out or the name of a variable holding one
+	number := func(arg string, what string) float64 {
+		if n, err := strconv.ParseFloat(arg, 64); err == nil {
+			return n
+		}
+		v, ok := lookup(arg)
+		if !ok {
+			fmt.Fprintf(ip.stdout, "Undefined symbol: %s\n", arg)
+			ip.exit(1)
+		}
+		if v.dtype != 0 {
+			fmt.Fprintf(ip.stdout, "Invalid %s\n", what)
+			ip.exit(1)
+		}
+		return v.val
+	}
+
+	switch op {
+	case "RANDINT", "RANDFLOAT":
+		// The bounds follow the keyword or are on the stack with the maximum on top
+		var min, max float64
+		switch len(args) {
+		case 0:
+			max = pop(0, "a maximum").val
+			min = pop(0, "a minimum").val
+		case 2:
+			min, max = number(args[0], "minimum"), number(args[1], "maximum")
+		default:
+			fmt.Fprintln(ip.stdout, "Missing minimum and maximum")
+			ip.exit(1)
+		}
+		if max <= min {
+			fmt.Fprintf(ip.stdout, "%s maximum must be greater than the minimum\n", op)
+			ip.exit(1)
+		}
+		if op == "RANDFLOAT" {
+			ip.pushto(stack, stackVal{dtype: 0, val: ip.rng.Float64()*(max-min) + min})
+			break
+		}
+		if min != math.Trunc(min) || max != math.Trunc(max) {
+			fmt.Fprintln(ip.stdout, "RANDINT bounds must be whole numbers")
+			ip.exit(1)
+		}
+		ip.pushto(stack, stackVal{dtype: 0, val: float64(ip.rng.Intn(int(max-min)) + int(min))})
+	case "RANDCHOICE":
+		list := pop(4, "an array").list
+		if len(list) == 0 {
+			fmt.Fprintln(ip.stdout, "RANDCHOICE needs an array with items")
+			ip.exit(1)
+		}
+		ip.pushto(stack, list[ip.rng.Intn(len(list))])
+	case "SHUFFLE":
+		list := append([]stackVal(nil), pop(4, "an array").list...)
+		ip.rng.Shuffle(len(list), func(i, j int) { list[i], list[j] = list[j], list[i] })
+		ip.pushto(stack, stackVal{dtype: 4, list: list})
+	case "SEED":
+		switch {
+		case len(args) == 0:
+			ip.Seed(int64(pop(0, "a number").val))
+		case args[0] == "SECURE":
+			ip.SecureRandom()
+		default:
+			ip.Seed(int64(number(args[0], "seed")))
+		}
+	}
+}
+
+// INPUT, EOF and READALL reading from stdin and pushing to stack, INPUT shows the quoted
+// prompt in args first
+func (ip *Interpreter) inputop(op string, args []string, stack *[]stackVal) {
+	switch op {
+	case "INPUT":
+		if len(args) > 0 {
+			prompt, ok := parseliteral(strings.Join(args, " "))
+			if !ok || prompt.dtype != 1 {
+				fmt.Fprintln(ip.stdout, "INPUT prompt must be a string")
+				ip.exit(1)
+			}
+			fmt.Fprint(ip.stdout, prompt.sval)
+		}
+		// At the end of the input the line is empty, EOF tells the two apart
+		line, _ := ip.read(func(in *bufio.Reader) (string, error) {
+			return in.ReadString('\n')
+		})
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		ip.pushto(stack, stackVal{dtype: 1, sval: line})
+	case "EOF":
+		_, err := ip.read(func(in *bufio.Reader) (string, error) {
+			_, err := in.Peek(1)
+			return "", err
+		})
+		ip.pushto(stack, stackVal{dtype: 2, bval: err != nil})
+	case "READALL":
+		all, err := ip.read(func(in *bufio.Reader) (string, error) {
+			b, err := io.ReadAll(in)
+			return string(b), err
+		})
+		if err != nil {
+			fmt.Fprintf(ip.stdout, "Cannot read input: %s\n", err)
+			ip.exit(1)
+		}
+		ip.pushto(stack, stackVal{dtype: 1, sval: all})
+	}
+}
+
+// EXIT, ARGS, ARGC, GETENV and SETENV, the keywords that talk to the process running the
+// program, working on stack. lookup finds the variable an exit code can be given as
+func (ip *Interpreter) processop(op string, args []string, stack *[]stackVal, lookup func(name string) (stackVal, bool)) {
+	if (op == "GETENV" || op == "SETENV") && len(args) != 1 {
+		fmt.Fprintf(ip.stdout, "Usage: %s\n", keywordinfos[op].usage)
+		ip.exit(1)
+	}
+	switch op {
+	case "EXIT":
+		if len(args) == 0 {
+			panic(replerror{quit: true})
+		}
+		code, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			v, ok := lookup(args[0])
+			if !ok {
+				fmt.Fprintf(ip.stdout, "Undefined symbol: %s\n", args[0])
+				ip.exit(1)
+			}
+			if v.dtype != 0 {
+				fmt.Fprintln(ip.stdout, "Invalid exit code")
+				ip.exit(1)
+			}
+			code = v.val
+		}
+		if code != math.Trunc(code) || code < 0 || code > 255 {
+			fmt.Fprintln(ip.stdout, "Exit code must be a whole number from 0 to 255")
+			ip.exit(1)
+		}
+		panic(replerror{code: int(code), quit: true})
+	case "ARGS":
+		list := make([]stackVal, len(ip.args))
+		for i, a := range ip.args {
+			list[i] = stackVal{dtype: 1, sval: a}
+		}
+		ip.pushto(stack, stackVal{dtype: 4, list: list})
+	case "ARGC":
+		ip.pushto(stack, stackVal{dtype: 0, val: float64(len(ip.args))})
+	case "GETENV":
+		v, ok := ip.env[args[0]]
+		if !ok {
+			v = os.Getenv(args[0])
+		}
+		ip.pushto(stack, stackVal{dtype: 1, sval: v})
+	case "SETENV":
+		if len(*stack) == 0 || (*stack)[len(*stack)-1].dtype != 1 {
+			fmt.Fprintln(ip.stdout, "SETENV needs a string on the stack")
+			ip.exit(1)
+		}
+		v := (*stack)[len(*stack)-1]
+		ip.dropfrom(stack, 1)
+		ip.env[args[0]] = v.sval
+	}
+}
+
+// A source of random numbers for math/rand that reads them from crypto/rand
+type securesource struct{}
+
+func (securesource) Uint64() uint64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (s securesource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (securesource) Seed(int64) {}
+
+// Run the function that the last RUN or MODRUN line asked for
+func (ip *Interpreter) runpending() {
+	if ip.runningfunc == true {
+		ip.runfunc(ip.running, ip.frommod)
+		ip.runningfunc = false
+		ip.running = funct{}
+	}
+}
+
+// Raised by exit and recovered where the interpreter was entered, so an error never ends the
+// process of a program embedding it
+type replerror struct {
+	code int
+
+	// Set by EXIT, which ends a REPL session whatever the code is
+	quit bool
+}
+
+// Stop the program with an exit code, in the REPL an error only abandons the current line
+func (ip *Interpreter) exit(code int) {
+	panic(replerror{code: code})
+}
+
+// Forget the functions that were running when an error stopped the program
+func (ip *Interpreter) unwind() {
+	ip.runningfunc = false
+	ip.running = funct{}
+	ip.tempsymbols = make(map[string]stackVal)
+	ip.depth = 0
+	ip.frames = ip.frames[:1]
+}
+
+// Describe a runtime error that happened while running a line
+func panicmessage(r interface{}) string {
+	msg := fmt.Sprint(r)
+	if strings.Contains(msg, "out of range [-") || strings.Contains(msg, "out of range [:-") {
+		return "Not enough values on the stack"
+	} else if strings.Contains(msg, "index out of range") {
+		return "Missing argument"
+	}
+	return "Error: " + msg
+}
+
+// Format a value the way it would be written in RED
+func showval(v stackVal) string {
+	switch v.dtype {
+	case 0:
+		return strconv.FormatFloat(v.val, 'f', -1, 64)
+	case 1:
+		return strconv.Quote(v.sval)
+	case 2:
+		return strconv.FormatBool(v.bval)
+	case 4:
+		return showstack(v.list)
+	}
+	return "?"
+}
+
+func showstack(list []stackVal) string {
+	var items []string
+	for _, v := range list {
+		items = append(items, showval(v))
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// Where a line is, as file:line
+func showpos(file string, line int) string {
+	if line == 0 {
+		return file
+	}
+	return file + ":" + strconv.Itoa(line)
+}
+
+// The keys of a map in order
+func sortedkeys[T any](m map[string]T) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Where a line of code is, core keywords are only allowed in some places
+const (
+	intop     = 1 << iota // top level of a program
+	infunc                // FUNC body of a program or a keyword case
+	inmodule              // top level of a module
+	inmodfunc             // FUNC body of a module
+)
+
+const incode = intop | infunc | inmodfunc
+const anywhere = incode | inmodule
+
+// How a core keyword is used, min and max count the words after it and max is -1 without a limit
+type keywordinfo struct {
+	min   int
+	max   int
+	where int
+	usage string
+	doc   string
+}
+
+var keywordinfos = map[string]keywordinfo{
+	"PUSH":        {1, -1, incode, "PUSH value", "Push a number, a quoted string or true or false onto the stack"},
+	"ADD":         {0, 0, incode, "ADD", "Pop two numbers and push their sum"},
+	"SUB":         {0, 0, incode, "SUB", "Pop two numbers and push the top one minus the one below it"},
+	"MULT":        {0, 0, incode, "MULT", "Pop two numbers and push their product"},
+	"DIV":         {0, 0, incode, "DIV", "Pop two numbers and push the top one divided by the one below it"},
+	"STORE":       {1, 1, incode, "STORE name", "Pop the top value and store it in a variable"},
+	"LOAD":        {1, 2, incode, "LOAD name [index]", "Push the value of a variable, or of an item of an array variable"},
+	"LOADARG":     {1, 1, infunc, "LOADARG name", "Push an argument of the keyword case being run"},
+	"PRINT":       {0, 0, incode, "PRINT", "Pop the top value and print it"},
+	"STR":         {0, 0, incode, "STR", "Turn the top value into a string"},
+	"FLOAT":       {0, 0, incode, "FLOAT", "Turn the top value into a number"},
+	"BOOL":        {0, 0, incode, "BOOL", "Turn the top value into a bool"},
+	"STRCAT":      {0, 0, incode, "STRCAT", "Pop two strings and push the top one followed by the one below it"},
+	"EQ":          {0, 0, incode, "EQ", "Pop two values of the same type and push whether they are equal"},
+	"NEQ":         {0, 0, incode, "NEQ", "Pop two values of the same type and push whether they differ"},
+	"GT":          {0, 0, incode, "GT", "Pop two values and push whether the top one is greater"},
+	"GTE":         {0, 0, incode, "GTE", "Pop two values and push whether the top one is greater or equal"},
+	"LT":          {0, 0, incode, "LT", "Pop two values and push whether the top one is smaller"},
+	"LTE":         {0, 0, incode, "LTE", "Pop two values and push whether the top one is smaller or equal"},
+	"NOT":         {0, 0, incode, "NOT", "Pop a bool and push its opposite"},
+	"AND":         {0, 0, incode, "AND", "Pop two bools and push whether both are true"},
+	"OR":          {0, 0, incode, "OR", "Pop two bools and push whether either is true"},
+	"DELAYST":     {0, 0, incode, "DELAYST", "Pop a number and wait that many milliseconds"},
+	"EXIT":        {0, 1, incode, "EXIT [code]", "Stop the program, with the exit code given as a number or a variable"},
+	"ARGS":        {0, 0, incode, "ARGS", "Push the arguments given to the program after its file as an array of strings"},
+	"ARGC":        {0, 0, incode, "ARGC", "Push how many arguments were given to the program"},
+	"GETENV":      {1, 1, incode, "GETENV name", "Push the value of an environment variable, empty when it is not set"},
+	"SETENV":      {1, 1, incode, "SETENV name", "Pop a string and set an environment variable of the program to it"},
+	"INPUT":       {0, -1, incode, "INPUT [prompt]", "Show the quoted prompt, read a line from the user and push it as a string"},
+	"EOF":         {0, 0, incode, "EOF", "Push whether all of the input has been read"},
+	"READALL":     {0, 0, incode, "READALL", "Read the rest of the input and push it as a string"},
+	"MODSTORE":    {2, 2, incode, "MODSTORE module name", "Pop the top value and store it in an export of a module"},
+	"MODGET":      {2, 2, incode, "MODGET module name", "Push the value of an export of a module"},
+	"MODRUN":      {2, 3, intop, "MODRUN module function [condition]", "Run a function of a module, repeating it while the condition is true"},
+	"CLEAR":       {0, 0, incode, "CLEAR", "Empty the stack"},
+	"MAKEARRAY":   {0, 0, incode, "MAKEARRAY", "Replace everything on the stack with one array holding it"},
+	"SPLIT":       {1, 1, incode, "SPLIT separator", "Pop a string and push an array of its parts"},
+	"JOIN":        {0, 0, incode, "JOIN", "Pop an array of strings and push them joined together"},
+	"APPEND":      {0, 0, incode, "APPEND", "Pop a value and add it to the array below it"},
+	"LEN":         {0, 0, incode, "LEN", "Push the length of the array on top of the stack"},
+	"REMOVE":      {0, 0, incode, "REMOVE", "Pop an index and remove that item from the array below it"},
+	"RANDINT":     {0, 2, incode, "RANDINT [min max]", "Push a random whole number from min up to but not including max, numbers or variables, without them pop max and then min"},
+	"RANDFLOAT":   {0, 2, incode, "RANDFLOAT [min max]", "Push a random number from min up to max, numbers or variables, without them pop max and then min"},
+	"RANDCHOICE":  {0, 0, incode, "RANDCHOICE", "Replace the array on top of the stack with one of its items picked at random"},
+	"SHUFFLE":     {0, 0, incode, "SHUFFLE", "Replace the array on top of the stack with its items in random order"},
+	"SEED":        {0, 1, incode, "SEED [seed]", "Seed the random numbers with a number, a variable or a number popped off the stack so they repeat, SEED SECURE picks them with the system's secure random source"},
+	"SIN":         {0, 0, incode, "SIN", "Replace the number on top of the stack with its sine"},
+	"COS":         {0, 0, incode, "COS", "Replace the number on top of the stack with its cosine"},
+	"TAN":         {0, 0, incode, "TAN", "Replace the number on top of the stack with its tangent"},
+	"ASIN":        {0, 0, incode, "ASIN", "Replace the number on top of the stack with its inverse sine"},
+	"ACOS":        {0, 0, incode, "ACOS", "Replace the number on top of the stack with its inverse cosine"},
+	"ATAN":        {0, 0, incode, "ATAN", "Replace the number on top of the stack with its inverse tangent"},
+	"SQRT":        {0, 0, incode, "SQRT", "Replace the number on top of the stack with its square root"},
+	"LN":          {0, 0, incode, "LN", "Replace the number on top of the stack with its natural logarithm"},
+	"LOG":         {0, 0, incode, "LOG", "Replace the number on top of the stack with its base 10 logarithm"},
+	"IF":          {2, -1, incode, "IF condition line", "Run the rest of the line when the bool variable condition is true"},
+	"COMM":        {0, -1, anywhere, "COMM text", "A comment"},
+	"//":          {0, -1, anywhere, "// text", "A comment"},
+	"MCOMM":       {0, -1, anywhere, "MCOMM", "Start a comment that lasts until ENDCOMM"},
+	"/*":          {0, -1, anywhere, "/*", "Start a comment that lasts until */"},
+	"ENDCOMM":     {0, -1, anywhere, "ENDCOMM", "End a comment started with MCOMM"},
+	"*/":          {0, -1, anywhere, "*/", "End a comment started with /*"},
+	"KEYPORT":     {1, 3, intop, "KEYPORT file [AS|EXTEND prefix]", "Load a keyword library, AS loads it under another prefix and EXTEND adds its cases to a loaded one"},
+	"IMPORT":      {2, 2, intop, "IMPORT file name", "Import a module under a name"},
+	"FUNC":        {1, 1, intop | inmodule, "FUNC name", "Start a function that lasts until ENDFUNC"},
+	"ENDFUNC":     {0, 0, intop | inmodule, "ENDFUNC", "End a function"},
+	"RUN":         {1, 2, intop | infunc, "RUN function [condition]", "Run a function, repeating it while the bool variable condition is true"},
+	"KEYWORD":     {2, -1, intop | inmodule, "KEYWORD PREFIX CASE [name:type=default ...]", "Define a keyword library case that lasts until ENDKEYWORD"},
+	"ENDKEYWORD":  {0, 0, intop | inmodule, "ENDKEYWORD", "End a keyword library case"},
+	"EXPORT":      {2, 2, inmodule, "EXPORT name number", "Export a variable of a module with a starting value"},
+	"EXARR":       {1, 1, inmodule, "EXARR name", "Export an array variable of a module"},
+	"SET":         {2, 2, inmodule, "SET name bool", "Set a bool variable of a module"},
+	"TEST":        {1, 1, intop, "TEST name", "Start a test that lasts until ENDTEST, only red test runs it"},
+	"ENDTEST":     {0, 0, intop, "ENDTEST", "End a test"},
+	"ASSERT":      {0, -1, incode, "ASSERT [message]", "Pop a bool and fail when it is false"},
+	"ASSERTEQ":    {0, 1, incode, "ASSERTEQ [value]", "Pop a value and fail unless it equals the value given, without one pop two values and fail unless they are equal"},
+	"ASSERTSTACK": {0, -1, incode, "ASSERTSTACK [value ...]", "Fail unless the stack holds exactly the values given, from the bottom up"},
+}
+
+// A word of a source line and where it is, quoted strings are one word
+type srcword struct {
+	text  string
+	start int
+	end   int
+}
+
+// A line of RED source as the tools see it
+type srcline struct {
+	n       int
+	raw     string
+	words   []srcword
+	where   int
+	block   string
+	comment bool
+}
+
+// A FUNC or KEYWORD block of a source file
+type srcblock struct {
+	name   string
+	line   int
+	end    int
+	params []keyparam
+}
+
+// The structure of a .red, .mred or native .kr file, problems holds what is wrong with its layout
+type srcfile struct {
+	path     string
+	module   bool
+	library  bool
+	lines    []srcline
+	funcs    map[string]srcblock
+	keywords map[string]srcblock
+	tests    []srcblock
+	problems []problem
+}
+
+// Something wrong with a line, col and end are byte offsets in the line and rule is the
+// linter rule that found it
+type problem struct {
+	line    int
+	col     int
+	end     int
+	msg     string
+	warning bool
+	rule    string
+}
+
+// Split a line into words the way keyword library arguments are split
+func sourcewords(line string) []srcword {
+	var words []srcword
+	var quote rune
+	start := -1
+	for i, r := range line {
+		if quote != 0 {
+			if r == quote {
+				quote = 0
+			}
+			continue
+		}
+		if r == ' ' || r == '\t' || r == '\r' {
+			if start >= 0 {
+				words = append(words, srcword{line[start:i], start, i})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		if r == '"' || r == '\'' {
+			quote = r
+		}
+	}
+	if start >= 0 {
+		words = append(words, srcword{line[start:], start, len(line)})
+	}
+	return words
+}
+
+// Read the layout of a source file, a .mred path is a module and a .kr path a keyword library
+// A #! line at the start lets a program run as a script, it is blanked so the other lines keep
+// their numbers
+func stripshebang(text string) string {
+	if !strings.HasPrefix(text, "#!") {
+		return text
+	}
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return text[i:]
+	}
+	return ""
+}
+
+func parsesource(path string, text string) *srcfile {
+	f := &srcfile{path: path, funcs: make(map[string]srcblock), keywords: make(map[string]srcblock)}
+	f.module = strings.HasSuffix(path, ".mred")
+	f.library = strings.HasSuffix(path, ".kr")
+	top := intop
+	body := infunc
+	if f.module {
+		top, body = inmodule, inmodfunc
+	}
+	where := top
+	var block *srcblock
+	blockkind := ""
+	incomment := ""
+	for i, raw := range strings.Split(stripshebang(text), "\n") {
+		l := srcline{n: i + 1, raw: strings.TrimRight(raw, "\r"), where: where}
+		l.words = sourcewords(l.raw)
+		if block != nil {
+			l.block = block.name
+		}
+		if len(l.words) == 0 {
+			f.lines = append(f.lines, l)
+			continue
+		}
+		op := l.words[0].text
+		if incomment != "" {
+			l.comment = true
+			if op == "ENDCOMM" || op == "*/" {
+				incomment = ""
+			}
+			f.lines = append(f.lines, l)
+			continue
+		}
+		switch op {
+		case "COMM", "//":
+			l.comment = true
+		case "MCOMM", "/*":
+			l.comment = true
+			incomment = op
+		case "FUNC", "KEYWORD", "TEST":
+			if block != nil {
+				f.problem(l, 0, "%s inside %s %s, end it with END%s first", op, blockkind, block.name, blockkind)
+				break
+			}
+			if f.library && op != "KEYWORD" {
+				f.problem(l, 0, "only KEYWORD blocks and comments are allowed in a keyword library")
+				break
+			}
+			block = &srcblock{line: l.n}
+			blockkind = op
+			if op == "FUNC" && len(l.words) > 1 {
+				block.name = l.words[1].text
+				where = body
+			} else if op == "TEST" {
+				if f.module {
+					f.problem(l, 0, "tests cannot be written in a module")
+				}
+				if len(l.words) > 1 {
+					block.name = l.words[1].text
+				}
+				where = infunc
+			} else if op == "KEYWORD" && len(l.words) > 2 {
+				if _, core := keywordinfos[l.words[1].text]; core {
+					f.problem(l, 1, "%s is a core keyword and cannot be used as a keyword prefix", l.words[1].text)
+				}
+				block.name = l.words[1].text + " " + l.words[2].text
+				block.params = sourceparams(f, l)
+				where = infunc
+			}
+		case "ENDFUNC", "ENDKEYWORD", "ENDTEST":
+			if block == nil || "END"+blockkind != op {
+				f.problem(l, 0, "%s without %s", op, strings.TrimPrefix(op, "END"))
+				break
+			}
+			block.end = l.n
+			if blockkind == "FUNC" {
+				if old, ok := f.funcs[block.name]; ok && block.name != "" {
+					f.problem(l, 0, "function %s is already defined on line %d", block.name, old.line)
+				}
+				f.funcs[block.name] = *block
+			} else if blockkind == "TEST" {
+				f.tests = append(f.tests, *block)
+			} else if block.name != "" {
+				if old, ok := f.keywords[block.name]; ok {
+					f.problem(f.lines[block.line-1], -1, "%s is already defined on line %d", block.name, old.line)
+				}
+				f.keywords[block.name] = *block
+			}
+			l.block = block.name
+			block = nil
+			where = top
+		default:
+			if f.library && block == nil {
+				f.problem(l, 0, "only KEYWORD blocks and comments are allowed in a keyword library")
+			}
+		}
+		f.lines = append(f.lines, l)
+	}
+	if block != nil {
+		f.problems = append(f.problems, problem{line: block.line, col: 0, end: len(f.lines[block.line-1].raw), msg: blockkind + " " + block.name + " has no END" + blockkind})
+	}
+	if incomment != "" {
+		last := len(f.lines)
+		f.problems = append(f.problems, problem{line: last, end: len(f.lines[last-1].raw), msg: "comment is never ended", warning: true})
+	}
+	return f
+}
+
+// Note a problem with a word of a line, word -1 marks the whole line
+func (f *srcfile) problem(l srcline, word int, format string, a ...interface{}) {
+	p := problem{line: l.n, col: 0, end: len(l.raw), msg: fmt.Sprintf(format, a...)}
+	if word >= 0 && word < len(l.words) {
+		p.col, p.end = l.words[word].start, l.words[word].end
+	}
+	f.problems = append(f.problems, p)
+}
+
+// Read the parameters of a KEYWORD header the way definekeyword does
+func sourceparams(f *srcfile, l srcline) []keyparam {
+	var params []keyparam
+	ip := New()
+	for i, w := range l.words[3:] {
+		msg := ip.catchprint(func() {
+			into := make(map[string]keymod)
+			ip.definekeyword(into, f.path, l.n, "KEYWORD X Y "+w.text, nil)
+			params = append(params, into["X"].cases["Y"].params...)
+		})
+		if msg != "" {
+			f.problem(l, i+3, "%s", strings.TrimPrefix(msg, "Invalid keyword definition at "+f.path+":"+strconv.Itoa(l.n)+": "))
+		}
+	}
+	return params
+}
+
+// Run part of the interpreter, returning what it printed when it failed
+func (ip *Interpreter) catchprint(f func()) (msg string) {
+	out := ip.stdout
+	var buf strings.Builder
+	ip.stdout = &buf
+	defer func() {
+		ip.stdout = out
+		if r := recover(); r != nil {
+			msg = strings.TrimSpace(buf.String())
+			if _, ok := r.(replerror); !ok {
+				msg = panicmessage(r)
+			}
+			if msg == "" {
+				msg = "failed"
+			}
+		}
+	}()
+	f()
+	return ""
+}
+
+// Coverage starts recording how often each line runs, ReportCoverage writes the report to name
+// with .lcov and .html added, or to coverage when name is empty
+func (ip *Interpreter) Coverage(name string) {
+	ip.coverage = make(map[string]map[int]int)
+	if name != "" {
+		ip.coverout = name
+	}
+}
+
+func (ip *Interpreter) coverline(file string, line int) {
+	if file == "" || line <= 0 {
+		return
+	}
+	file = filepath.Clean(file)
+	hits, ok := ip.coverage[file]
+	if !ok {
+		hits = make(map[int]int)
+		ip.coverage[file] = hits
+	}
+	hits[line]++
+}
+
+// Make sure the files the program loaded are in the report, even those nothing of ran
+func (ip *Interpreter) coverfiles() {
+	add := func(file string) {
+		if file == "" || file == "<repl>" {
+			return
+		}
+		file = filepath.Clean(file)
+		if _, ok := ip.coverage[file]; !ok {
+			ip.coverage[file] = make(map[int]int)
+		}
+	}
+	for _, k := range ip.keymods {
+		for _, c := range k.cases {
+			add(c.file)
+		}
+	}
+	for _, f := range ip.funcs {
+		add(f.file)
+	}
+	for _, m := range ip.modules {
+		for _, f := range m.funcs {
+			add(f.file)
+		}
+	}
+}
+
+// The lines of a file that can run and the text of the file, read from where it was found.
+// Definitions, END lines, comments and the top level of a module, which only declares exports,
+// do not count
+func coverable(path string, found string) (map[int]bool, []string) {
+	lines := make(map[int]bool)
+	bytes, err := ioutil.ReadFile(found)
+	if err != nil {
+		return lines, nil
+	}
+	text := string(bytes)
+	if strings.HasSuffix(path, ".kr") && strings.HasPrefix(strings.TrimSpace(text), "{") {
+		var libs map[string]keymod
+		ip := New()
+		ip.catchprint(func() {
+			libs = ip.loadkeymod(path, bytes)
+		})
+		for _, k := range libs {
+			for _, c := range k.cases {
+				for i, code := range c.code {
+					if i < len(c.lines) && c.lines[i] > 0 && executable(code) {
+						lines[c.lines[i]] = true
+					}
+				}
+			}
+		}
+		return lines, strings.Split(text, "\n")
+	}
+	f := parsesource(path, text)
+	for _, l := range f.lines {
+		if l.comment || len(l.words) == 0 || l.where == inmodule {
+			continue
+		}
+		switch l.words[0].text {
+		case "FUNC", "ENDFUNC", "KEYWORD", "ENDKEYWORD", "TEST", "ENDTEST":
+			continue
+		}
+		lines[l.n] = true
+	}
+	return lines, strings.Split(text, "\n")
+}
+
+// The coverage of one file, hits holds the runs of every line that can run
+type filecoverage struct {
+	path  string
+	lines []string
+	hits  map[int]int
+	total int
+	hit   int
+}
+
+func (c filecoverage) percent() float64 {
+	if c.total == 0 {
+		return 100
+	}
+	return float64(c.hit) * 100 / float64(c.total)
+}
+
+// ReportCoverage prints a summary of the coverage where SetReportOutput says and writes it as
+// LCOV and HTML, it does nothing unless Coverage was called. The built-in library is left out
+func (ip *Interpreter) ReportCoverage() {
+	if ip.coverage == nil {
+		return
+	}
+	ip.coverfiles()
+	var files []filecoverage
+	total, hit := 0, 0
+	for _, path := range sortedkeys(ip.coverage) {
+		if strings.HasPrefix(filepath.ToSlash(path), "built-in/") {
+			continue
+		}
+		lines, text := coverable(path, ip.resolvepath(path, ""))
+		c := filecoverage{path: path, lines: text, hits: make(map[int]int)}
+		for n := range lines {
+			c.hits[n] = ip.coverage[path][n]
+			c.total++
+			if c.hits[n] > 0 {
+				c.hit++
+			}
+		}
+		total += c.total
+		hit += c.hit
+		files = append(files, c)
+	}
+	all := filecoverage{path: "total", total: total, hit: hit}
+
+	width := len(all.path)
+	for _, c := range files {
+		if len(c.path) > width {
+			width = len(c.path)
+		}
+	}
+	fmt.Fprintln(ip.report, "Coverage:")
+	for _, c := range append(files, all) {
+		fmt.Fprintf(ip.report, "  %-*s %11s lines %6.1f%%\n", width, c.path, fmt.Sprintf("%d/%d", c.hit, c.total), c.percent())
+	}
+
+	var lcov strings.Builder
+	for _, c := range files {
+		abs, _ := filepath.Abs(ip.resolvepath(c.path, ""))
+		fmt.Fprintf(&lcov, "TN:\nSF:%s\n", abs)
+		for _, n := range sortedlines(c.hits) {
+			fmt.Fprintf(&lcov, "DA:%d,%d\n", n, c.hits[n])
+		}
+		fmt.Fprintf(&lcov, "LF:%d\nLH:%d\nend_of_record\n", c.total, c.hit)
+	}
+	if err := ioutil.WriteFile(ip.coverout+".lcov", []byte(lcov.String()), 0644); err != nil {
+		fmt.Fprintln(ip.report, err)
+		return
+	}
+	if err := ioutil.WriteFile(ip.coverout+".html", []byte(coveragehtml(files, all)), 0644); err != nil {
+		fmt.Fprintln(ip.report, err)
+		return
+	}
+	fmt.Fprintf(ip.report, "Wrote %s.lcov and %s.html\n", ip.coverout, ip.coverout)
+}
+
+func sortedlines(m map[int]int) []int {
+	var lines []int
+	for n := range m {
+		lines = append(lines, n)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// A page listing every file with the lines that ran in green and those that did not in red
+func coveragehtml(files []filecoverage, all filecoverage) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>RED coverage</title>\n<style>\n")
+	b.WriteString("body { font-family: sans-serif; margin: 2em; }\n")
+	b.WriteString("table.summary td, table.summary th { padding: 0.2em 1em; text-align: left; }\n")
+	b.WriteString("table.source { border-collapse: collapse; font-family: monospace; white-space: pre; }\n")
+	b.WriteString("table.source td { padding: 0 0.5em; }\n")
+	b.WriteString("td.n, td.hits { color: #888; text-align: right; }\n")
+	b.WriteString("tr.hit { background: #dfd; }\ntr.miss { background: #fdd; }\n")
+	b.WriteString("</style>\n</head>\n<body>\n<h1>RED coverage</h1>\n<table class=\"summary\">\n<tr><th>File</th><th>Lines</th><th>Covered</th></tr>\n")
+	for i, c := range append(files, all) {
+		name := html.EscapeString(c.path)
+		if i < len(files) {
+			name = fmt.Sprintf("<a href=\"#file%d\">%s</a>", i, name)
+		}
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%d/%d</td><td>%.1f%%</td></tr>\n", name, c.hit, c.total, c.percent())
+	}
+	b.WriteString("</table>\n")
+	for i, c := range files {
+		fmt.Fprintf(&b, "<h2 id=\"file%d\">%s</h2>\n<table class=\"source\">\n", i, html.EscapeString(c.path))
+		for n, text := range c.lines {
+			class, count := "", ""
+			if hits, ok := c.hits[n+1]; ok {
+				class, count = "miss", "0"
+				if hits > 0 {
+					class, count = "hit", strconv.Itoa(hits)
+				}
+			}
+			fmt.Fprintf(&b, "<tr class=\"%s\"><td class=\"n\">%d</td><td class=\"hits\">%s</td><td>%s</td></tr>\n", class, n+1, count, html.EscapeString(strings.TrimRight(text, "\r")))
+		}
+		b.WriteString("</table>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
@@ -0,0 +1,391 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Repl reads lines from the user and executes them against the same symbols and stack of ip.
+// Like a shell it returns the error of the last line when the input ends, or the Error of the
+// EXIT that ended the session
+func Repl(ip *Interpreter) error {
+	reader := newlinereader(ip.input, ip.stdout, ip.interactive())
+	if reader.term {
+		fmt.Fprintln(ip.stdout, "RED interactive session, type :help for a list of commands and :quit to leave")
+	}
+	n := 0
+	var last error
+	for {
+		prompt := "red> "
+		if ip.activefuncwrite || ip.activekeywrite || ip.activetestwrite || ip.comment {
+			prompt = "...  "
+		}
+		line, ok := reader.readline(prompt)
+		if !ok {
+			if reader.term {
+				fmt.Fprintln(ip.stdout)
+			}
+			return last
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		reader.remember(trimmed)
+
+		if strings.HasPrefix(trimmed, ":") {
+			if !ip.replcommand(trimmed, &last) {
+				return last
+			}
+			continue
+		}
+		n++
+		more, err := ip.replrun(func() {
+			ip.runline("<repl>", n, line)
+			ip.runpending()
+		})
+		last = err
+		if !more {
+			return last
+		}
+		if !(ip.activefuncwrite || ip.activekeywrite || ip.activetestwrite || ip.comment) {
+			fmt.Fprintln(ip.stdout, "stack:", showstack(ip.stack))
+		}
+	}
+}
+
+// Run part of a session, recovering from errors so the session can go on. Returns false when
+// the program used EXIT, which ends the session, and the error it ended with
+func (ip *Interpreter) replrun(f func()) (bool, error) {
+	more := true
+	err := ip.guard(context.Background(), func() {
+		defer func() {
+			if r := recover(); r != nil {
+				if e, ok := r.(replerror); ok && e.quit {
+					more = false
+				}
+				panic(r)
+			}
+		}()
+		f()
+	})
+	return more, err
+}
+
+// Handle a REPL command such as :vars, returns false when the session should end. :load sets
+// last to how the file it ran ended
+func (ip *Interpreter) replcommand(line string, last *error) bool {
+	parts := strings.Fields(line)
+	switch parts[0] {
+	case ":help":
+		fmt.Fprintln(ip.stdout, ":stack          show every value on the stack with its type")
+		fmt.Fprintln(ip.stdout, ":vars           show all variables")
+		fmt.Fprintln(ip.stdout, ":funcs          show all functions, including those of imported modules")
+		fmt.Fprintln(ip.stdout, ":keywords       show loaded keyword libraries")
+		fmt.Fprintln(ip.stdout, ":load file.red  run a file in this session")
+		fmt.Fprintln(ip.stdout, ":clear          empty the stack")
+		fmt.Fprintln(ip.stdout, ":reset          forget all variables, functions, modules and keyword libraries")
+		fmt.Fprintln(ip.stdout, ":quit           leave the session")
+	case ":quit", ":exit", ":q":
+		return false
+	case ":stack":
+		if len(ip.stack) == 0 {
+			fmt.Fprintln(ip.stdout, "(empty)")
+		}
+		for i := len(ip.stack) - 1; i >= 0; i-- {
+			fmt.Fprintf(ip.stdout, "%d: %s (%s)\n", i, showval(ip.stack[i]), typename(ip.stack[i].dtype))
+		}
+	case ":vars":
+		names := make([]string, 0, len(ip.symbols))
+		for name := range ip.symbols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(ip.stdout, "%s = %s (%s)\n", name, showval(ip.symbols[name]), typename(ip.symbols[name].dtype))
+		}
+	case ":funcs":
+		var names []string
+		for name, f := range ip.funcs {
+			names = append(names, fmt.Sprintf("%s (%d lines)", name, len(f.body)))
+		}
+		for modname, m := range ip.modules {
+			for name, f := range m.funcs {
+				names = append(names, fmt.Sprintf("%s %s (%d lines, MODRUN)", modname, name, len(f.body)))
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(ip.stdout, name)
+		}
+	case ":keywords":
+		var names []string
+		for prefix, k := range ip.keymods {
+			for name, c := range k.cases {
+				names = append(names, prefix+" "+name+" "+signature(c.params))
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(ip.stdout, name)
+		}
+	case ":load":
+		if len(parts) < 2 {
+			fmt.Fprintln(ip.stdout, "Usage: :load file.red")
+			break
+		}
+		path := strings.Join(parts[1:], " ")
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(ip.stdout, err)
+			*last = &Error{Code: 1, Message: err.Error()}
+			break
+		}
+		var more bool
+		more, *last = ip.replrun(func() {
+			ip.runlines(path, strings.Split(stripshebang(string(bytes)), "\n"))
+		})
+		if !more {
+			return false
+		}
+		fmt.Fprintln(ip.stdout, "stack:", showstack(ip.stack))
+	case ":clear":
+		ip.clearstack(&ip.stack)
+	case ":reset":
+		ip.initstate()
+		ip.replrun(ip.defimports)
+		*last = nil
+		fmt.Fprintln(ip.stdout, "Session reset")
+	default:
+		fmt.Fprintf(ip.stdout, "Unknown command %s, type :help for a list of commands\n", parts[0])
+	}
+	return true
+}
+
+// Reads lines with editing and history when attached to a terminal
+type linereader struct {
+	history []string
+	term    bool
+	file    string
+	in      func() *bufio.Reader
+	out     io.Writer
+}
+
+// Lines are read from what in returns, which INPUT reads from too, prompts and the edited line
+// are shown on out. When in is a terminal lines can be edited
+func newlinereader(in func() *bufio.Reader, out io.Writer, term bool) *linereader {
+	r := &linereader{in: in, out: out, term: term}
+	if home, err := os.UserHomeDir(); err == nil {
+		r.file = filepath.Join(home, ".red_history")
+		if bytes, err := ioutil.ReadFile(r.file); err == nil {
+			for _, l := range strings.Split(string(bytes), "\n") {
+				if l != "" {
+					r.history = append(r.history, l)
+				}
+			}
+		}
+		if len(r.history) > 500 {
+			r.history = r.history[len(r.history)-500:]
+		}
+	}
+	return r
+}
+
+// Add a line to the history and save it for later sessions
+func (r *linereader) remember(line string) {
+	if len(r.history) > 0 && r.history[len(r.history)-1] == line {
+		return
+	}
+	r.history = append(r.history, line)
+	if r.file != "" && r.term {
+		if f, err := os.OpenFile(r.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+			f.WriteString(line + "\n")
+			f.Close()
+		}
+	}
+}
+
+// The reader is shared with INPUT so neither reads lines meant for the other
+func (r *linereader) readbyte() (byte, error) {
+	return r.in().ReadByte()
+}
+
+func (r *linereader) readrune() (rune, error) {
+	c, _, err := r.in().ReadRune()
+	return c, err
+}
+
+// Whether the REPL and the debugger read from a terminal, where lines can be edited
+func (ip *Interpreter) interactive() bool {
+	return ip.stdin == nil && terminal(os.Stdin)
+}
+
+// Whether f is a terminal that stty can switch to reading single key presses, which is never
+// the case on Windows or when the input is piped in
+func terminal(f *os.File) bool {
+	if runtime.GOOS == "windows" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	_, err = exec.LookPath("stty")
+	return err == nil
+}
+
+// Switch the terminal to reading single key presses, returning its previous settings
+func rawterminal() (string, bool) {
+	cmd := exec.Command("stty", "-g")
+	cmd.Stdin = os.Stdin
+	saved, err := cmd.Output()
+	if err != nil {
+		return "", false
+	}
+	cmd = exec.Command("stty", "-icanon", "-echo", "-isig", "min", "1")
+	cmd.Stdin = os.Stdin
+	if cmd.Run() != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(saved)), true
+}
+
+func restoreterminal(saved string) {
+	cmd := exec.Command("stty", saved)
+	cmd.Stdin = os.Stdin
+	cmd.Run()
+}
+
+func (r *linereader) readline(prompt string) (string, bool) {
+	if r.term {
+		if saved, ok := rawterminal(); ok {
+			defer restoreterminal(saved)
+			return r.edit(prompt)
+		}
+		fmt.Fprint(r.out, prompt)
+	}
+	var line []byte
+	for {
+		b, err := r.readbyte()
+		if err != nil {
+			return string(line), len(line) > 0
+		}
+		if b == '\n' {
+			return strings.TrimRight(string(line), "\r"), true
+		}
+		line = append(line, b)
+	}
+}
+
+// Edit a line with the arrow keys, up and down go through the history
+func (r *linereader) edit(prompt string) (string, bool) {
+	var buf []rune
+	pos := 0
+	hist := len(r.history)
+	var draft []rune
+	fmt.Fprint(r.out, prompt)
+	for {
+		c, err := r.readrune()
+		if err != nil {
+			return "", false
+		}
+		switch c {
+		case '\r', '\n':
+			fmt.Fprint(r.out, "\n")
+			return string(buf), true
+		case 4:
+			// Ctrl-D ends the session on an empty line
+			if len(buf) == 0 {
+				return "", false
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 3:
+			// Ctrl-C abandons the line
+			fmt.Fprint(r.out, "^C\n")
+			return "", true
+		case 127, 8:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1:
+			pos = 0
+		case 5:
+			pos = len(buf)
+		case 21:
+			buf = append([]rune{}, buf[pos:]...)
+			pos = 0
+		case 11:
+			buf = buf[:pos]
+		case 27:
+			seq, _ := r.readrune()
+			if seq != '[' && seq != 'O' {
+				break
+			}
+			key, _ := r.readrune()
+			switch key {
+			case 'A', 'B':
+				if key == 'A' && hist > 0 {
+					if hist == len(r.history) {
+						draft = buf
+					}
+					hist--
+					buf = []rune(r.history[hist])
+				} else if key == 'B' && hist < len(r.history) {
+					hist++
+					if hist == len(r.history) {
+						buf = draft
+					} else {
+						buf = []rune(r.history[hist])
+					}
+				}
+				pos = len(buf)
+			case 'C':
+				if pos < len(buf) {
+					pos++
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(buf)
+			case '3':
+				r.readrune()
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if c >= 32 {
+				buf = append(buf[:pos], append([]rune{c}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		fmt.Fprint(r.out, "\r"+prompt+string(buf)+"\x1b[K")
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(r.out, "\x1b[%dD", back)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package interp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Lines piped into a session run one after another against the same stack, an error only
+// abandons its own line
+func TestRepl(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.red")
+	os.WriteFile(script, []byte("#!/usr/bin/env red\nPUSH 10\nSTORE y"), 0644)
+
+	ip, out := newtestinterpreter()
+	ip.SetInput(strings.NewReader("PUSH 2\nPUSH 3\nADD\nFUNC f\n\tPUSH 1\nENDFUNC\nRUN f\nNOPE\n:stack\n:load " + script + "\nLOAD y\n:funcs\n:clear\n:wat\n"))
+	if err := Repl(ip); err != nil {
+		t.Fatal(err)
+	}
+	want := `stack: [2]
+stack: [2, 3]
+stack: [5]
+stack: [5]
+stack: [5, 1]
+Invalid operation: NOPE
+stack: [5, 1]
+1: 1 (number)
+0: 5 (number)
+stack: [5, 1]
+stack: [5, 1, 10]
+f (1 lines)
+Unknown command :wat, type :help for a list of commands
+`
+	if got := out.String(); got != want {
+		t.Errorf("printed\n%s\nwant\n%s", got, want)
+	}
+}
+
+// A session ends with the code EXIT gives it or with the error of its last line
+func TestReplExit(t *testing.T) {
+	for _, c := range []struct {
+		input string
+		code  int
+		rest  bool
+	}{
+		{"PUSH 1\n", 0, false},
+		{"NOPE\nPUSH 1\n", 0, false},
+		{"PUSH 1\nNOPE\n", 1, false},
+		{":load missing.red\n", 1, false},
+		{"NOPE\n:quit\nPUSH 1\n", 1, true},
+		{"EXIT 3\nPUSH 1\n", 3, true},
+		{"NOPE\nEXIT\nPUSH 1\n", 0, true},
+	} {
+		ip, out := newtestinterpreter()
+		ip.SetInput(strings.NewReader(c.input))
+		err := Repl(ip)
+		var e *Error
+		if c.code == 0 && err != nil {
+			t.Errorf("%q: %v", c.input, err)
+		} else if c.code != 0 && (!errors.As(err, &e) || e.Code != c.code) {
+			t.Errorf("%q: got error %v, want exit code %d", c.input, err, c.code)
+		}
+		if ran := strings.Contains(out.String(), "stack: [1]"); c.rest && ran {
+			t.Errorf("%q: the session went on after it ended", c.input)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The outcome of one test, failure is set when an assertion failed and err when the test
+// stopped with an error
+type testresult struct {
+	file    string
+	name    string
+	line    int
+	failure string
+	err     string
+	output  string
+	time    time.Duration
+}
+
+// Test runs the TEST blocks of the *_test.red files among paths with the settings of ip, printing
+// how each went and writing a JUnit XML report to junit when it is set. Every test starts from a
+// fresh state that runs the top level of its file first. Returns false when a test did not pass
+func Test(ip *Interpreter, paths []string, junit string) bool {
+	out := ip.stdout
+	files, ok := sourcefiles(out, paths)
+	var results []testresult
+	found := false
+	for _, path := range files {
+		// Files named on the command line are run whatever their name
+		if !strings.HasSuffix(path, "_test.red") && !(strings.HasSuffix(path, ".red") && containspath(paths, path)) {
+			continue
+		}
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			ok = false
+			continue
+		}
+		lines := strings.Split(string(bytes), "\n")
+		found = true
+
+		// Find the tests by running the top level once
+		setup := ip.runtest(path, lines, -1)
+		if setup.failure != "" || setup.err != "" {
+			setup.name = "(top level)"
+			results = append(results, setup)
+			continue
+		}
+		for i := 0; i < len(ip.tests); i++ {
+			results = append(results, ip.runtest(path, lines, i))
+		}
+	}
+	ip.stdout = out
+	if !found {
+		fmt.Fprintln(out, "No test files found")
+		return ok
+	}
+
+	passed, failedcount := 0, 0
+	for _, r := range results {
+		where := showpos(r.file, r.line)
+		if r.failure == "" && r.err == "" {
+			passed++
+			fmt.Fprintf(out, "PASS %s (%s)\n", r.name, where)
+			continue
+		}
+		failedcount++
+		fmt.Fprintf(out, "FAIL %s (%s)\n", r.name, where)
+		if r.failure != "" {
+			fmt.Fprintf(out, "    %s\n", r.failure)
+		} else {
+			fmt.Fprintf(out, "    %s\n", r.err)
+		}
+		for _, l := range strings.Split(strings.TrimRight(r.output, "\n"), "\n") {
+			if l != "" && !strings.HasPrefix(l, "Assertion failed at ") {
+				fmt.Fprintf(out, "    | %s\n", l)
+			}
+		}
+	}
+	fmt.Fprintf(out, "%d passed, %d failed\n", passed, failedcount)
+	if ip.coverage != nil {
+		ip.ReportCoverage()
+	}
+
+	if junit != "" {
+		if err := ioutil.WriteFile(junit, []byte(junitreport(results)), 0644); err != nil {
+			fmt.Fprintln(out, err)
+			ok = false
+		}
+	}
+	return ok && failedcount == 0
+}
+
+func containspath(paths []string, path string) bool {
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run the top level of a test file in a fresh interpreter and then its test number i, with i
+// -1 only the top level. What the program prints is kept in the result
+func (ip *Interpreter) runtest(path string, lines []string, i int) (r testresult) {
+	var buf strings.Builder
+	ip.stdout = &buf
+	ip.failed = ""
+	start := time.Now()
+	r = testresult{file: path, line: 1}
+	defer func() {
+		r.time = time.Since(start)
+		if ip.coverage != nil {
+			ip.coverfiles()
+		}
+		r.output = buf.String()
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		if e, ok := rec.(replerror); ok && e.code == 0 {
+			// EXIT ends a test early
+			return
+		}
+		f := ip.frames[len(ip.frames)-1]
+		if ip.failed != "" {
+			r.failure = ip.failed
+			return
+		}
+		msg := ""
+		if _, ok := rec.(replerror); ok {
+			output := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			msg = output[len(output)-1]
+		} else {
+			msg = panicmessage(rec)
+		}
+		if f.file == "" {
+			f.file, f.line = path, 0
+		}
+		r.err = showpos(f.file, f.line) + ": " + msg
+	}()
+	ip.initstate()
+	ip.defimports()
+	ip.runlines(path, lines)
+	if i < 0 {
+		return r
+	}
+	t := ip.tests[i]
+	r.name, r.line, r.file = t.name, t.line, t.file
+	ip.enter("test " + t.name)
+	ip.runfunc(t.funct, false)
+	ip.depth--
+	return r
+}
+
+// A JUnit XML report of test results, one test suite per file
+func junitreport(results []testresult) string {
+	var suites []string
+	bysuite := make(map[string][]testresult)
+	for _, r := range results {
+		if _, ok := bysuite[r.file]; !ok {
+			suites = append(suites, r.file)
+		}
+		bysuite[r.file] = append(bysuite[r.file], r)
+	}
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	total, failures, errors := 0, 0, 0
+	var alltime time.Duration
+	var body strings.Builder
+	for _, file := range suites {
+		list := bysuite[file]
+		sfail, serr := 0, 0
+		var stime time.Duration
+		var cases strings.Builder
+		for _, r := range list {
+			stime += r.time
+			fmt.Fprintf(&cases, "    <testcase name=\"%s\" classname=\"%s\" file=\"%s\" line=\"%d\" time=\"%.3f\"", xmlescape(r.name), xmlescape(strings.TrimSuffix(filepath.Base(file), ".red")), xmlescape(file), r.line, r.time.Seconds())
+			switch {
+			case r.failure != "":
+				sfail++
+				fmt.Fprintf(&cases, ">\n      <failure message=\"%s\">%s</failure>\n", xmlescape(r.failure), xmlescape(r.output))
+				fmt.Fprintf(&cases, "    </testcase>\n")
+			case r.err != "":
+				serr++
+				fmt.Fprintf(&cases, ">\n      <error message=\"%s\">%s</error>\n", xmlescape(r.err), xmlescape(r.output))
+				fmt.Fprintf(&cases, "    </testcase>\n")
+			case r.output != "":
+				fmt.Fprintf(&cases, ">\n      <system-out>%s</system-out>\n    </testcase>\n", xmlescape(r.output))
+			default:
+				cases.WriteString("/>\n")
+			}
+		}
+		fmt.Fprintf(&body, "  <testsuite name=\"%s\" tests=\"%d\" failures=\"%d\" errors=\"%d\" time=\"%.3f\">\n", xmlescape(file), len(list), sfail, serr, stime.Seconds())
+		body.WriteString(cases.String())
+		body.WriteString("  </testsuite>\n")
+		total += len(list)
+		failures += sfail
+		errors += serr
+		alltime += stime
+	}
+	fmt.Fprintf(&b, "<testsuites tests=\"%d\" failures=\"%d\" errors=\"%d\" time=\"%.3f\">\n", total, failures, errors, alltime.Seconds())
+	b.WriteString(body.String())
+	b.WriteString("</testsuites>\n")
+	return b.String()
+}
+
+func xmlescape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
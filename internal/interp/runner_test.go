@@ -0,0 +1,137 @@
+package interp
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A test file whose tests pass, fail and stop with an error. isolated only passes when nothing
+// changes carried over from the test before it
+const testfile = `PUSH 0
+STORE count
+
+TEST changes
+	PUSH 5
+	STORE count
+	PUSH 1
+	PUSH 2
+	ASSERTEQ 2
+ENDTEST
+
+TEST isolated
+	LOAD count
+	ASSERTEQ 0
+	ASSERTSTACK
+ENDTEST
+
+TEST a<b&"c"
+	PUSH 2
+	PUSH 2
+	ADD
+	ASSERTEQ 5
+ENDTEST
+
+TEST broken
+	LOAD missing
+ENDTEST
+`
+
+// Run the tests of files in a temporary folder, returning whether they passed and what was
+// printed with the folder left out of the paths
+func runtests(t *testing.T, files map[string]string, junit string) (bool, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	builtin, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, out := newtestinterpreter()
+	ip.SetIncludePaths(builtin)
+	ok := Test(ip, []string{dir}, junit)
+	return ok, strings.ReplaceAll(out.String(), dir+string(filepath.Separator), "")
+}
+
+func TestRunTests(t *testing.T) {
+	ok, got := runtests(t, map[string]string{"math_test.red": testfile, "math.red": "PUSH 1\nPRINT"}, "")
+	want := `PASS changes (math_test.red:4)
+PASS isolated (math_test.red:12)
+FAIL a<b&"c" (math_test.red:18)
+    math_test.red:22: ASSERTEQ expected 5, got 4
+FAIL broken (math_test.red:25)
+    math_test.red:26: Undefined symbol: missing
+    | Undefined symbol: missing
+2 passed, 2 failed
+`
+	if ok || got != want {
+		t.Errorf("Test returned %v and printed\n%s\nwant\n%s", ok, got, want)
+	}
+
+	ok, got = runtests(t, map[string]string{"pass_test.red": "TEST fine\n\tPUSH 1\n\tASSERTEQ 1\nENDTEST"}, "")
+	if !ok || got != "PASS fine (pass_test.red:1)\n1 passed, 0 failed\n" {
+		t.Errorf("Test returned %v and printed\n%s", ok, got)
+	}
+
+	// An error outside of the tests fails the whole file
+	ok, got = runtests(t, map[string]string{"setup_test.red": "LOAD nothing\nTEST never\nENDTEST"}, "")
+	if ok || !strings.HasPrefix(got, "FAIL (top level) (setup_test.red:1)\n    setup_test.red:1: Undefined symbol: nothing\n") {
+		t.Errorf("Test returned %v and printed\n%s", ok, got)
+	}
+}
+
+func TestJUnitReport(t *testing.T) {
+	report := filepath.Join(t.TempDir(), "report.xml")
+	runtests(t, map[string]string{"math_test.red": testfile}, report)
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type testcase struct {
+		Name    string `xml:"name,attr"`
+		Line    int    `xml:"line,attr"`
+		Failure *struct {
+			Message string `xml:"message,attr"`
+		} `xml:"failure"`
+		Error *struct {
+			Message string `xml:"message,attr"`
+		} `xml:"error"`
+	}
+	var suites struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Errors   int `xml:"errors,attr"`
+		Suites   []struct {
+			Tests    int        `xml:"tests,attr"`
+			Failures int        `xml:"failures,attr"`
+			Errors   int        `xml:"errors,attr"`
+			Cases    []testcase `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("%v in\n%s", err, data)
+	}
+	if suites.Tests != 4 || suites.Failures != 1 || suites.Errors != 1 || len(suites.Suites) != 1 {
+		t.Fatalf("report counts %d tests, %d failures, %d errors in %d suites", suites.Tests, suites.Failures, suites.Errors, len(suites.Suites))
+	}
+	s := suites.Suites[0]
+	if s.Tests != 4 || s.Failures != 1 || s.Errors != 1 || len(s.Cases) != 4 {
+		t.Fatalf("suite counts %d tests, %d failures, %d errors and has %d cases", s.Tests, s.Failures, s.Errors, len(s.Cases))
+	}
+	failed := s.Cases[2]
+	if failed.Name != `a<b&"c"` || failed.Line != 18 || failed.Failure == nil || !strings.HasSuffix(failed.Failure.Message, "math_test.red:22: ASSERTEQ expected 5, got 4") {
+		t.Errorf("failed case is %+v", failed)
+	}
+	if broken := s.Cases[3]; broken.Error == nil || broken.Failure != nil {
+		t.Errorf("broken case is %+v", broken)
+	}
+	if s.Cases[0].Failure != nil || s.Cases[0].Error != nil {
+		t.Errorf("passing case is %+v", s.Cases[0])
+	}
+}
@@ -0,0 +1,18 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+package interp
+
+import "embed"
+
+// Source holds the Go files of the interpreter itself, without the tools in the other files and
+// the tests. red build copies them into every program it compiles so the program builds on its
+// own, which is why nothing in them may use the tools
+//
+//go:embed interpreter.go red.go
+var Source embed.FS
@@ -0,0 +1,977 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+// Package pkg is the package manager of RED, it installs the dependencies listed in red.json
+// from a registry into vendor and keeps red.lock up to date
+package pkg
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const manifestfile = "red.json"
+const lockfilename = "red.lock"
+const vendordir = "vendor"
+
+type manifest struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Registry     string            `json:"registry,omitempty"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+type lockentry struct {
+	Version      string            `json:"version"`
+	Source       string            `json:"source"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+type lockfile struct {
+	Packages map[string]lockentry `json:"packages"`
+}
+
+type semver struct {
+	major int
+	minor int
+	patch int
+	pre   string
+}
+
+// A single comparison such as >=1.2.0, a constraint is a list of
+// alternatives (||) each made of comparisons that must all hold
+type comparison struct {
+	op  string
+	ver semver
+}
+
+type constraint [][]comparison
+
+// A version of a package available in the registry
+type pkgversion struct {
+	name    string
+	version semver
+	source  string
+	deps    map[string]string
+}
+
+type registry struct {
+	root     string
+	packages map[string][]pkgversion
+}
+
+func parsesemver(s string) (semver, error) {
+	var v semver
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.pre = s[i+1:]
+		s = s[:i]
+	}
+	nums := strings.Split(s, ".")
+	if len(nums) != 3 {
+		return v, fmt.Errorf("invalid version: %s", s)
+	}
+	var vals [3]int
+	for i, n := range nums {
+		num, err := strconv.Atoi(n)
+		if err != nil || num < 0 {
+			return v, fmt.Errorf("invalid version: %s", s)
+		}
+		vals[i] = num
+	}
+	v.major, v.minor, v.patch = vals[0], vals[1], vals[2]
+	return v, nil
+}
+
+func (v semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if v.pre != "" {
+		s += "-" + v.pre
+	}
+	return s
+}
+
+func (v semver) compare(o semver) int {
+	if v.major != o.major {
+		return cmpint(v.major, o.major)
+	}
+	if v.minor != o.minor {
+		return cmpint(v.minor, o.minor)
+	}
+	if v.patch != o.patch {
+		return cmpint(v.patch, o.patch)
+	}
+	// A release is always newer than its prereleases
+	if v.pre == o.pre {
+		return 0
+	}
+	if v.pre == "" {
+		return 1
+	}
+	if o.pre == "" {
+		return -1
+	}
+	return comparepre(v.pre, o.pre)
+}
+
+// Compare prereleases the way semver does, identifier by identifier with numbers compared as
+// numbers and before words, and a prerelease that runs out first is the older one
+func comparepre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				return cmpint(an, bn)
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return cmpint(len(as), len(bs))
+}
+
+func cmpint(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Parse constraints like "^1.2.0", "~1.2", ">=1.0.0 <2.0.0", "1.x" or "1.0.0 || ^2.0.0"
+func parseconstraint(s string) (constraint, error) {
+	var c constraint
+	for _, alt := range strings.Split(s, "||") {
+		var all []comparison
+		fields := strings.Fields(alt)
+		if len(fields) == 0 {
+			fields = []string{"*"}
+		}
+		for _, f := range fields {
+			comps, err := parsecomparison(f)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, comps...)
+		}
+		c = append(c, all)
+	}
+	return c, nil
+}
+
+func parsecomparison(s string) ([]comparison, error) {
+	if s == "*" || s == "x" || s == "latest" {
+		return nil, nil
+	}
+	op := ""
+	for _, o := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, o) {
+			op = o
+			s = s[len(o):]
+			break
+		}
+	}
+
+	// Fill in partial versions such as 1 or 1.2 or 1.x, remembering how
+	// many parts were given so ranges can be widened accordingly
+	nums := strings.SplitN(strings.Split(s, "-")[0], ".", 3)
+	given := 0
+	for _, n := range nums {
+		if n == "x" || n == "X" || n == "*" {
+			break
+		}
+		given++
+	}
+	full := s
+	if given < 3 {
+		parts := append([]string{}, nums[:given]...)
+		for len(parts) < 3 {
+			parts = append(parts, "0")
+		}
+		full = strings.Join(parts, ".")
+	}
+	v, err := parsesemver(full)
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint: %s", s)
+	}
+
+	switch op {
+	case ">=", "<=", ">", "<":
+		return []comparison{{op, v}}, nil
+	case "^":
+		upper := semver{major: v.major + 1}
+		if v.major == 0 && given > 1 {
+			upper = semver{minor: v.minor + 1}
+			if v.minor == 0 && given > 2 {
+				upper = semver{patch: v.patch + 1}
+			}
+		}
+		return []comparison{{">=", v}, {"<", upper}}, nil
+	case "~":
+		upper := semver{major: v.major, minor: v.minor + 1}
+		if given == 1 {
+			upper = semver{major: v.major + 1}
+		}
+		return []comparison{{">=", v}, {"<", upper}}, nil
+	default:
+		if given == 3 {
+			return []comparison{{"=", v}}, nil
+		}
+		if given == 0 {
+			return nil, nil
+		}
+		upper := semver{major: v.major + 1}
+		if given == 2 {
+			upper = semver{major: v.major, minor: v.minor + 1}
+		}
+		return []comparison{{">=", v}, {"<", upper}}, nil
+	}
+}
+
+func (c constraint) allows(v semver) bool {
+	for _, all := range c {
+		ok := true
+		for _, comp := range all {
+			if !comp.allows(v) {
+				ok = false
+				break
+			}
+		}
+		// Prereleases only match when a comparison explicitly names one
+		if ok && v.pre != "" {
+			ok = false
+			for _, comp := range all {
+				if comp.ver.pre != "" && comp.ver.major == v.major && comp.ver.minor == v.minor && comp.ver.patch == v.patch {
+					ok = true
+				}
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c comparison) allows(v semver) bool {
+	r := v.compare(c.ver)
+	switch c.op {
+	case ">=":
+		return r >= 0
+	case "<=":
+		return r <= 0
+	case ">":
+		return r > 0
+	case "<":
+		return r < 0
+	default:
+		return r == 0
+	}
+}
+
+func readmanifest(path string) (manifest, error) {
+	var m manifest
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(bytes, &m); err != nil {
+		return m, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, m.validate(path)
+}
+
+func (m manifest) validate(path string) error {
+	if m.Name == "" {
+		return fmt.Errorf("%s: missing package name", path)
+	}
+	if err := validname(m.Name); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if _, err := parsesemver(m.Version); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for name, c := range m.Dependencies {
+		if err := validname(name); err != nil {
+			return fmt.Errorf("%s: dependency %v", path, err)
+		}
+		if _, err := parseconstraint(c); err != nil {
+			return fmt.Errorf("%s: dependency %s: %v", path, name, err)
+		}
+	}
+	return nil
+}
+
+// A package is installed into a folder named after it under vendor, so its name must not be
+// able to point anywhere else
+func validname(name string) error {
+	if name == "" || name == "." || strings.Contains(name, "..") || strings.ContainsAny(name, `/\:`) || filepath.IsAbs(name) {
+		return fmt.Errorf("invalid package name %q", name)
+	}
+	return nil
+}
+
+// Whether path is inside dir, checked on the cleaned paths
+func inside(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || filepath.IsAbs(rel) {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func writejson(path string, v interface{}) error {
+	bytes, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(bytes, '\n'), 0644)
+}
+
+// Scan a registry directory, packages can be laid out as
+// <name>/<version>/ directories, <name>/<version>.tar.gz or <name>-<version>.tar.gz tarballs
+func openregistry(root string) (*registry, error) {
+	reg := &registry{root: root, packages: make(map[string][]pkgversion)}
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open registry %s: %v", root, err)
+	}
+	for _, e := range entries {
+		path := filepath.Join(root, e.Name())
+		if e.IsDir() {
+			versions, err := ioutil.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range versions {
+				vpath := filepath.Join(path, v.Name())
+				if v.IsDir() {
+					reg.add(vpath, filepath.Join(vpath, manifestfile))
+				} else if strings.HasSuffix(v.Name(), ".tar.gz") {
+					reg.add(vpath, "")
+				}
+			}
+		} else if strings.HasSuffix(e.Name(), ".tar.gz") {
+			reg.add(path, "")
+		}
+	}
+	for name := range reg.packages {
+		versions := reg.packages[name]
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i].version.compare(versions[j].version) > 0
+		})
+	}
+	return reg, nil
+}
+
+func (reg *registry) add(source string, manifestpath string) {
+	var m manifest
+	var err error
+	if manifestpath != "" {
+		m, err = readmanifest(manifestpath)
+	} else {
+		m, err = tarmanifest(source)
+	}
+	if err != nil {
+		fmt.Printf("[Package] Skipping %s: %v\n", source, err)
+		return
+	}
+	v, _ := parsesemver(m.Version)
+	for _, existing := range reg.packages[m.Name] {
+		if existing.version.compare(v) == 0 {
+			return
+		}
+	}
+	reg.packages[m.Name] = append(reg.packages[m.Name], pkgversion{name: m.Name, version: v, source: source, deps: m.Dependencies})
+}
+
+// Tarballs either hold the package files directly or inside a single top-level directory
+func tarmanifest(path string) (manifest, error) {
+	var m manifest
+	f, err := os.Open(path)
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return m, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m, err
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(h.Name), "./")
+		if name == manifestfile || (strings.Count(name, "/") == 1 && strings.HasSuffix(name, "/"+manifestfile)) {
+			bytes, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return m, err
+			}
+			if err := json.Unmarshal(bytes, &m); err != nil {
+				return m, err
+			}
+			return m, m.validate(path)
+		}
+	}
+	return m, errors.New("no " + manifestfile + " in package")
+}
+
+func (reg *registry) find(name string, version semver) (pkgversion, bool) {
+	for _, v := range reg.packages[name] {
+		if v.version.compare(version) == 0 {
+			return v, true
+		}
+	}
+	return pkgversion{}, false
+}
+
+type requirement struct {
+	from string
+	raw  string
+	cons constraint
+}
+
+// Pick a version for every package reachable from deps, backtracking when a
+// choice conflicts with constraints found later, versions in the lockfile are tried first
+func resolve(reg *registry, deps map[string]string, lock lockfile) (map[string]pkgversion, error) {
+	reqs := make(map[string][]requirement)
+	for name, raw := range deps {
+		c, err := parseconstraint(raw)
+		if err != nil {
+			return nil, err
+		}
+		reqs[name] = append(reqs[name], requirement{from: "red.json", raw: raw, cons: c})
+	}
+	selected := make(map[string]pkgversion)
+	err := solve(reg, reqs, selected, lock)
+	if err != nil {
+		return nil, err
+	}
+	return selected, nil
+}
+
+func solve(reg *registry, reqs map[string][]requirement, selected map[string]pkgversion, lock lockfile) error {
+	var pending []string
+	for name := range reqs {
+		if _, ok := selected[name]; !ok {
+			pending = append(pending, name)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	sort.Strings(pending)
+	name := pending[0]
+
+	available, ok := reg.packages[name]
+	if !ok {
+		return fmt.Errorf("package %s not found in registry %s", name, reg.root)
+	}
+	candidates := make([]pkgversion, 0)
+	if locked, ok := lock.Packages[name]; ok {
+		if v, err := parsesemver(locked.Version); err == nil {
+			if p, ok := reg.find(name, v); ok {
+				candidates = append(candidates, p)
+			}
+		}
+	}
+	candidates = append(candidates, available...)
+
+	var lasterr error
+	for _, c := range candidates {
+		if !satisfies(c.version, reqs[name]) {
+			continue
+		}
+
+		// Add this version's own requirements and make sure they
+		// do not rule out anything that is already selected
+		next := make(map[string][]requirement)
+		for n, r := range reqs {
+			next[n] = append([]requirement{}, r...)
+		}
+		conflict := false
+		for dep, raw := range c.deps {
+			cons, err := parseconstraint(raw)
+			if err != nil {
+				return fmt.Errorf("%s@%s: %v", name, c.version, err)
+			}
+			next[dep] = append(next[dep], requirement{from: name + "@" + c.version.String(), raw: raw, cons: cons})
+			if s, ok := selected[dep]; ok && !cons.allows(s.version) {
+				lasterr = fmt.Errorf("%s@%s requires %s %s, but %s@%s was selected", name, c.version, dep, raw, dep, s.version)
+				conflict = true
+			}
+		}
+		if conflict {
+			continue
+		}
+
+		selected[name] = c
+		lasterr = solve(reg, next, selected, lock)
+		if lasterr == nil {
+			return nil
+		}
+		delete(selected, name)
+	}
+	if lasterr != nil {
+		return lasterr
+	}
+
+	var wanted []string
+	for _, r := range reqs[name] {
+		wanted = append(wanted, r.raw+" (from "+r.from+")")
+	}
+	return fmt.Errorf("no version of %s satisfies %s", name, strings.Join(wanted, ", "))
+}
+
+func satisfies(v semver, reqs []requirement) bool {
+	for _, r := range reqs {
+		if !r.cons.allows(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy a package version into vendor/<name>, either from a directory or by extracting its tarball
+func vendorpkg(dir string, p pkgversion) error {
+	if err := validname(p.name); err != nil {
+		return err
+	}
+	vendor := filepath.Join(dir, vendordir)
+	dest := filepath.Join(vendor, p.name)
+	if filepath.Dir(dest) != filepath.Clean(vendor) {
+		return fmt.Errorf("%s is not a folder of %s", dest, vendor)
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	info, err := os.Stat(p.source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return copydir(p.source, dest)
+	}
+	return untar(p.source, dest)
+}
+
+// Copy the files and folders of src into dest. Walk does not follow symbolic links and they are
+// left out, like anything else that is not a regular file, so a package cannot copy in files
+// from outside of it
+func copydir(src string, dest string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, bytes, 0644)
+	})
+}
+
+func untar(path string, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+
+	type file struct {
+		name string
+		data []byte
+	}
+	var files []file
+	prefix := ""
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(h.Name), "./")
+		if strings.HasPrefix(name, "/") || strings.Contains(name, "\\") || strings.Contains("/"+name+"/", "/../") {
+			return fmt.Errorf("%s: unsafe path in package: %s", path, h.Name)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(name, "/"+manifestfile) && strings.Count(name, "/") == 1 {
+			prefix = strings.TrimSuffix(name, manifestfile)
+		}
+		files = append(files, file{name, data})
+	}
+	for _, fl := range files {
+		name := strings.TrimPrefix(fl.name, prefix)
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		if !inside(dest, target) {
+			return fmt.Errorf("%s: unsafe path in package: %s", path, fl.name)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, fl.data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the project (without vendored packages) as <name>-<version>.tar.gz into dir
+func pack(project string, m manifest, dir string) (string, error) {
+	out := filepath.Join(dir, m.Name+"-"+m.Version+".tar.gz")
+	absout, _ := filepath.Abs(out)
+	f, err := os.Create(out)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = filepath.Walk(project, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(project, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if rel == vendordir || rel == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		abs, _ := filepath.Abs(path)
+		if rel == lockfilename || abs == absout || strings.HasSuffix(rel, ".tar.gz") || !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		h := &tar.Header{Name: filepath.ToSlash(rel), Mode: 0644, Size: int64(len(data)), ModTime: info.ModTime()}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	return out, gz.Close()
+}
+
+func readlock(path string) lockfile {
+	lock := lockfile{Packages: make(map[string]lockentry)}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return lock
+	}
+	if err := json.Unmarshal(bytes, &lock); err != nil {
+		fmt.Printf("[Package] Ignoring invalid %s: %v\n", path, err)
+		return lockfile{Packages: make(map[string]lockentry)}
+	}
+	if lock.Packages == nil {
+		lock.Packages = make(map[string]lockentry)
+	}
+	return lock
+}
+
+// The registry comes from --registry, then RED_REGISTRY, then the manifest, then ~/.red/registry
+func registrypath(flag string, m manifest) string {
+	if flag != "" {
+		return flag
+	}
+	if env := os.Getenv("RED_REGISTRY"); env != "" {
+		return env
+	}
+	if m.Registry != "" {
+		return m.Registry
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "registry"
+	}
+	return filepath.Join(home, ".red", "registry")
+}
+
+// Install the dependencies of m into vendor and write red.lock. The versions in lock are kept
+// where they still fit unless update is set, and only the folders lock recorded are removed
+// when they are no longer needed, so folders made by hand in vendor stay
+func install(m manifest, regpath string, lock lockfile, update bool) {
+	reg, err := openregistry(regpath)
+	if err != nil {
+		fmt.Println("[Package]", err)
+		os.Exit(1)
+	}
+	pinned := lock
+	if update {
+		pinned = lockfile{}
+	}
+	selected, err := resolve(reg, m.Dependencies, pinned)
+	if err != nil {
+		fmt.Println("[Package]", err)
+		os.Exit(1)
+	}
+
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	newlock := lockfile{Packages: make(map[string]lockentry)}
+	for _, name := range names {
+		p := selected[name]
+		if err := vendorpkg(".", p); err != nil {
+			fmt.Printf("[Package] Cannot install %s@%s: %v\n", name, p.version, err)
+			os.Exit(1)
+		}
+		source, err := filepath.Rel(reg.root, p.source)
+		if err != nil {
+			source = p.source
+		}
+		newlock.Packages[name] = lockentry{Version: p.version.String(), Source: filepath.ToSlash(source), Dependencies: p.deps}
+		fmt.Printf("[Package] Installed %s@%s\n", name, p.version)
+	}
+
+	// Remove vendored packages that are no longer needed
+	for name := range lock.Packages {
+		if _, ok := selected[name]; !ok && validname(name) == nil {
+			os.RemoveAll(filepath.Join(vendordir, name))
+		}
+	}
+
+	if err := writejson(lockfilename, newlock); err != nil {
+		fmt.Println("[Package]", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage: red pkg <command> [arguments] [--registry dir]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("    init [name]              create a red.json manifest in the current directory")
+	fmt.Println("    install                  install dependencies into vendor/ using red.lock when possible")
+	fmt.Println("    update                   re-resolve dependencies ignoring red.lock")
+	fmt.Println("    add <name>[@constraint]  add a dependency and install it")
+	fmt.Println("    remove <name>            remove a dependency")
+	fmt.Println("    list                     list installed packages")
+	fmt.Println("    pack [dir]               write <name>-<version>.tar.gz into dir")
+	fmt.Println("    publish                  pack the project into the registry")
+}
+
+// Main runs a package manager command given as the arguments that follow red pkg, it ends the
+// process when the command fails
+func Main(arguments []string) {
+	// Pull out --registry from anywhere in the arguments
+	var args []string
+	regflag := ""
+	for i := 0; i < len(arguments); i++ {
+		if arguments[i] == "--registry" && i+1 < len(arguments) {
+			regflag = arguments[i+1]
+			i++
+		} else if strings.HasPrefix(arguments[i], "--registry=") {
+			regflag = strings.TrimPrefix(arguments[i], "--registry=")
+		} else {
+			args = append(args, arguments[i])
+		}
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage()
+		return
+	}
+
+	if args[0] == "init" {
+		if _, err := os.Stat(manifestfile); err == nil {
+			fmt.Println("[Package] red.json already exists")
+			os.Exit(1)
+		}
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		} else {
+			wd, _ := os.Getwd()
+			name = filepath.Base(wd)
+		}
+		if err := validname(name); err != nil {
+			fmt.Println("[Package]", err)
+			os.Exit(1)
+		}
+		m := manifest{Name: name, Version: "0.1.0", Dependencies: make(map[string]string)}
+		if err := writejson(manifestfile, m); err != nil {
+			fmt.Println("[Package]", err)
+			os.Exit(1)
+		}
+		fmt.Println("[Package] Created red.json for", name)
+		return
+	}
+
+	m, err := readmanifest(manifestfile)
+	if err != nil {
+		fmt.Println("[Package]", err)
+		os.Exit(1)
+	}
+	if m.Dependencies == nil {
+		m.Dependencies = make(map[string]string)
+	}
+	regpath := registrypath(regflag, m)
+
+	switch args[0] {
+	case "install":
+		install(m, regpath, readlock(lockfilename), false)
+	case "update":
+		install(m, regpath, readlock(lockfilename), true)
+	case "add":
+		if len(args) < 2 {
+			fmt.Println("[Package] Missing package name")
+			os.Exit(1)
+		}
+		name, raw := args[1], ""
+		if i := strings.Index(name, "@"); i >= 0 {
+			name, raw = name[:i], name[i+1:]
+		}
+		if err := validname(name); err != nil {
+			fmt.Println("[Package]", err)
+			os.Exit(1)
+		}
+		if raw == "" {
+			// Default to the newest compatible release
+			reg, err := openregistry(regpath)
+			if err != nil {
+				fmt.Println("[Package]", err)
+				os.Exit(1)
+			}
+			if len(reg.packages[name]) == 0 {
+				fmt.Printf("[Package] package %s not found in registry %s\n", name, regpath)
+				os.Exit(1)
+			}
+			raw = "^" + reg.packages[name][0].version.String()
+		} else if _, err := parseconstraint(raw); err != nil {
+			fmt.Println("[Package]", err)
+			os.Exit(1)
+		}
+		m.Dependencies[name] = raw
+		install(m, regpath, readlock(lockfilename), false)
+		if err := writejson(manifestfile, m); err != nil {
+			fmt.Println("[Package]", err)
+			os.Exit(1)
+		}
+	case "remove":
+		if len(args) < 2 {
+			fmt.Println("[Package] Missing package name")
+			os.Exit(1)
+		}
+		if _, ok := m.Dependencies[args[1]]; !ok {
+			fmt.Printf("[Package] %s is not a dependency\n", args[1])
+			os.Exit(1)
+		}
+		delete(m.Dependencies, args[1])
+		install(m, regpath, readlock(lockfilename), false)
+		if err := writejson(manifestfile, m); err != nil {
+			fmt.Println("[Package]", err)
+			os.Exit(1)
+		}
+	case "list":
+		lock := readlock(lockfilename)
+		names := make([]string, 0, len(lock.Packages))
+		for name := range lock.Packages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s@%s\n", name, lock.Packages[name].Version)
+		}
+	case "pack", "publish":
+		dir := "."
+		if args[0] == "publish" {
+			dir = regpath
+		} else if len(args) > 1 {
+			dir = args[1]
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("[Package]", err)
+			os.Exit(1)
+		}
+		out, err := pack(".", m, dir)
+		if err != nil {
+			fmt.Println("[Package]", err)
+			os.Exit(1)
+		}
+		fmt.Println("[Package] Wrote", out)
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
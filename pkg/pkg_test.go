@@ -0,0 +1,380 @@
+package pkg
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSemver(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2.3+build", "1.2.3", 0},
+		{"1.2.4", "1.2.3", 1},
+		{"1.10.0", "1.9.0", 1},
+		{"2.0.0", "10.0.0", -1},
+		{"1.0.0-beta", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+		{"1.0.0-alpha.10", "1.0.0-alpha.2", 1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+		{"1.0.0-rc.1", "1.0.0-rc.1", 0},
+	}
+	for _, test := range tests {
+		a, err := parsesemver(test.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := parsesemver(test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := a.compare(b); got != test.want {
+			t.Errorf("%s compared with %s is %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+	for _, bad := range []string{"", "1.2", "1.2.3.4", "1.a.3", "1.-2.3"} {
+		if _, err := parsesemver(bad); err == nil {
+			t.Errorf("%q parsed as a version", bad)
+		}
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"^1.2.0", "1.2.0", true},
+		{"^1.2.0", "1.9.9", true},
+		{"^1.2.0", "2.0.0", false},
+		{"^1.2.0", "1.1.9", false},
+		{"^0.2.1", "0.2.5", true},
+		{"^0.2.1", "0.3.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1", "1.9.0", true},
+		{"1.x", "1.5.0", true},
+		{"1.x", "2.0.0", false},
+		{"1.2", "1.2.7", true},
+		{"1.2.3", "1.2.4", false},
+		{">=1.0.0 <2.0.0", "1.5.0", true},
+		{">=1.0.0 <2.0.0", "2.0.0", false},
+		{"1.0.0 || ^2.0.0", "2.3.0", true},
+		{"1.0.0 || ^2.0.0", "1.1.0", false},
+		{"*", "3.1.4", true},
+		{"^1.0.0", "1.1.0-beta", false},
+		{">=1.1.0-beta", "1.1.0-beta", true},
+	}
+	for _, test := range tests {
+		c, err := parseconstraint(test.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := parsesemver(test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.allows(v); got != test.want {
+			t.Errorf("%s allows %s is %v, want %v", test.constraint, test.version, got, test.want)
+		}
+	}
+	if _, err := parseconstraint("^one"); err == nil {
+		t.Error("^one parsed as a constraint")
+	}
+}
+
+// A registry folder holding packages as name/version/red.json, deps maps "name@version" to
+// the dependencies of that version
+func fakeregistry(t *testing.T, deps map[string]map[string]string) *registry {
+	root := t.TempDir()
+	for id, d := range deps {
+		name, version := strings.Split(id, "@")[0], strings.Split(id, "@")[1]
+		dir := filepath.Join(root, name, version)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		m := manifest{Name: name, Version: version, Dependencies: d}
+		if err := writejson(filepath.Join(dir, manifestfile), m); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".mred"), []byte("EXPORT version 1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reg, err := openregistry(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func versions(selected map[string]pkgversion) map[string]string {
+	res := make(map[string]string)
+	for name, p := range selected {
+		res[name] = p.version.String()
+	}
+	return res
+}
+
+func TestResolve(t *testing.T) {
+	reg := fakeregistry(t, map[string]map[string]string{
+		"app@1.0.0":  {"json": "^1.0.0", "http": "^2.0.0"},
+		"json@1.0.0": nil,
+		"json@1.4.0": nil,
+		"json@2.0.0": nil,
+		// The newest http needs a json that app does not allow, so an older one is picked
+		"http@2.1.0": {"json": "^2.0.0"},
+		"http@2.0.0": {"json": ">=1.2.0"},
+		"http@1.0.0": nil,
+	})
+	tests := []struct {
+		name string
+		deps map[string]string
+		lock map[string]string
+		want map[string]string
+		err  string
+	}{
+		{
+			name: "newest",
+			deps: map[string]string{"json": "^1.0.0"},
+			want: map[string]string{"json": "1.4.0"},
+		},
+		{
+			name: "backtrack",
+			deps: map[string]string{"app": "*"},
+			want: map[string]string{"app": "1.0.0", "json": "1.4.0", "http": "2.0.0"},
+		},
+		{
+			name: "locked",
+			deps: map[string]string{"json": "^1.0.0"},
+			lock: map[string]string{"json": "1.0.0"},
+			want: map[string]string{"json": "1.0.0"},
+		},
+		{
+			name: "stale lock",
+			deps: map[string]string{"json": "^2.0.0"},
+			lock: map[string]string{"json": "1.0.0"},
+			want: map[string]string{"json": "2.0.0"},
+		},
+		{
+			name: "conflict",
+			deps: map[string]string{"json": "^1.0.0", "http": "2.1.0"},
+			err:  "json",
+		},
+		{
+			name: "missing",
+			deps: map[string]string{"xml": "*"},
+			err:  "package xml not found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lock := lockfile{Packages: make(map[string]lockentry)}
+			for name, v := range test.lock {
+				lock.Packages[name] = lockentry{Version: v}
+			}
+			selected, err := resolve(reg, test.deps, lock)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v and error %v, want an error about %s", versions(selected), err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := versions(selected); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("selected %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// Installing replaces the packages red.lock recorded and leaves other folders in vendor alone
+func TestInstall(t *testing.T) {
+	reg := fakeregistry(t, map[string]map[string]string{"json@1.0.0": nil, "http@1.0.0": nil})
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	for _, name := range []string{"http", "mine"} {
+		os.MkdirAll(filepath.Join(vendordir, name), 0755)
+	}
+	lock := lockfile{Packages: map[string]lockentry{"http": {Version: "1.0.0"}}}
+	install(manifest{Name: "app", Version: "1.0.0", Dependencies: map[string]string{"json": "^1.0.0"}}, reg.root, lock, false)
+	for name, want := range map[string]bool{"json/json.mred": true, "http": false, "mine": true} {
+		if _, err := os.Stat(filepath.Join(vendordir, filepath.FromSlash(name))); (err == nil) != want {
+			t.Errorf("vendor/%s there is %v, want %v", name, err == nil, want)
+		}
+	}
+	if got := readlock(lockfilename); len(got.Packages) != 1 || got.Packages["json"].Version != "1.0.0" {
+		t.Errorf("red.lock holds %v", got.Packages)
+	}
+}
+
+// Symbolic links in a package folder are not followed out of it
+func TestCopyLinks(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "secret")
+	os.WriteFile(outside, []byte("x"), 0644)
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(src, 0755)
+	os.WriteFile(filepath.Join(src, "json.mred"), []byte("EXPORT a 1\n"), 0644)
+	if err := os.Symlink(outside, filepath.Join(src, "link")); err != nil {
+		t.Skip(err)
+	}
+	os.Symlink(dir, filepath.Join(src, "dirlink"))
+	dest := filepath.Join(dir, "dest")
+	if err := copydir(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"json.mred": true, "link": false, "dirlink": false} {
+		if _, err := os.Lstat(filepath.Join(dest, name)); (err == nil) != want {
+			t.Errorf("%s copied is %v, want %v", name, err == nil, want)
+		}
+	}
+}
+
+func TestLockfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockfilename)
+	lock := lockfile{Packages: map[string]lockentry{
+		"json": {Version: "1.4.0", Source: "json/1.4.0"},
+		"http": {Version: "2.0.0", Source: "http-2.0.0.tar.gz", Dependencies: map[string]string{"json": ">=1.2.0"}},
+	}}
+	if err := writejson(path, lock); err != nil {
+		t.Fatal(err)
+	}
+	if got := readlock(path); !reflect.DeepEqual(got, lock) {
+		t.Errorf("read back %v, want %v", got, lock)
+	}
+	if got := readlock(filepath.Join(t.TempDir(), lockfilename)); got.Packages == nil || len(got.Packages) != 0 {
+		t.Errorf("a missing lock file read as %v", got)
+	}
+}
+
+// A tarball of files, the names are written as they are given
+func writetar(t *testing.T, files map[string]string) string {
+	path := filepath.Join(t.TempDir(), "package.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTarball(t *testing.T) {
+	// A packed project comes out the same, without its vendor folder and lock file
+	project := t.TempDir()
+	m := manifest{Name: "json", Version: "1.0.0", Dependencies: map[string]string{}}
+	if err := writejson(filepath.Join(project, manifestfile), m); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"json.mred": "EXPORT a 1\n", "lib/util.kr": "{}\n", "vendor/x/x.mred": "", lockfilename: "{}"} {
+		path := filepath.Join(project, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarball, err := pack(project, m, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := tarmanifest(tarball); err != nil || got.Name != "json" {
+		t.Fatalf("manifest of the tarball is %v, %v", got, err)
+	}
+	dest := t.TempDir()
+	if err := untar(tarball, dest); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"json.mred": true, "lib/util.kr": true, manifestfile: true, "vendor": false, lockfilename: false} {
+		if _, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name))); (err == nil) != want {
+			t.Errorf("%s extracted is %v, want %v", name, err == nil, want)
+		}
+	}
+
+	// Files inside a single top-level folder are moved up
+	dest = t.TempDir()
+	if err := untar(writetar(t, map[string]string{"json-1.0.0/red.json": "{}", "json-1.0.0/json.mred": "EXPORT a 1\n"}), dest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "json.mred")); err != nil {
+		t.Error(err)
+	}
+
+	// Nothing may be written outside of the destination
+	for _, name := range []string{"../escape.mred", "/escape.mred", "a/../../escape.mred", `..\escape.mred`} {
+		dir := t.TempDir()
+		dest := filepath.Join(dir, "dest")
+		if err := untar(writetar(t, map[string]string{name: "x"}), dest); err == nil {
+			t.Errorf("%s was extracted", name)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "escape.mred")); err == nil {
+			t.Errorf("%s was written outside the destination", name)
+		}
+	}
+}
+
+func TestPackageNames(t *testing.T) {
+	for _, name := range []string{"json", "json-utils", "json_2", "json.v2"} {
+		if err := validname(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "../victim", "a/b", `a\b`, "/abs", "c:x"} {
+		if err := validname(name); err == nil {
+			t.Errorf("%q is a valid name", name)
+		}
+	}
+
+	// A dependency named after a path is refused before anything is removed
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim")
+	os.MkdirAll(victim, 0755)
+	os.WriteFile(filepath.Join(victim, "keep"), []byte("x"), 0644)
+	project := filepath.Join(dir, "project")
+	if err := vendorpkg(project, pkgversion{name: "../../victim", source: t.TempDir()}); err == nil {
+		t.Error("a package named ../../victim was installed")
+	}
+	if _, err := os.Stat(filepath.Join(victim, "keep")); err != nil {
+		t.Error(err)
+	}
+	m := manifest{Name: "a", Version: "1.0.0", Dependencies: map[string]string{"../../victim": "*"}}
+	if err := m.validate("red.json"); err == nil {
+		t.Error("a manifest depending on ../../victim is valid")
+	}
+}
@@ -0,0 +1,44 @@
+/*
+
+RED - A simple, stack-based programming language
+
+Copyright (C) 2022  The RED Authors
+
+*/
+
+// Package red runs programs written in RED from Go.
+//
+// Every Interpreter has its own stack, variables, functions, modules and keyword libraries, so
+// a service can keep one per script and run several of them at the same time:
+//
+//	ip := red.New()
+//	ip.Set("n", 5)
+//	ip.Load("double.red", "LOAD n\nPUSH 2\nMULT\nSTORE n")
+//	if err := ip.Run(); err != nil {
+//		return err
+//	}
+//	n, _ := ip.Get("n")
+package red
+
+import "github.com/palmbyrosiadev/red-compiler/internal/interp"
+
+// An Interpreter holds the state of one RED program. It is not safe to use one Interpreter from
+// several goroutines at once, but different Interpreters can run concurrently
+type Interpreter = interp.Interpreter
+
+// Error is returned when a program stops with a non-zero exit code, either by EXIT or because
+// something went wrong. Message is the last line the program printed before it stopped
+type Error = interp.Error
+
+// Limits bound what a program run by Run or Call may use, a field left at zero sets no limit
+type Limits = interp.Limits
+
+// A Keyword is a Go function that programs call by name once it is registered with
+// Interpreter.Register
+type Keyword = interp.Keyword
+
+// New returns an Interpreter with an empty stack and only PI and EULER defined. Its programs
+// print to standard output and read INPUT from standard input
+func New() *Interpreter {
+	return interp.New()
+}
@@ -0,0 +1,35 @@
+package red
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Programs run through the package the way the documentation shows
+func TestInterpreter(t *testing.T) {
+	ip := New()
+	var out strings.Builder
+	ip.SetOutput(&out)
+	ip.Set("n", 5)
+	err := ip.Register("TWICE", Keyword{Args: []string{"number"}, Returns: 1, Func: func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{args[0].(float64) * 2}, nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip.Load("double.red", "LOAD n\nTWICE\nSTORE n")
+	if err := ip.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := ip.Get("n"); n != 10.0 {
+		t.Errorf("n is %v, want 10", n)
+	}
+
+	ip.SetLimits(Limits{Steps: 100})
+	ip.Load("endless.red", "PUSH true\nSTORE forever\nFUNC f\nENDFUNC\nRUN f forever")
+	var e *Error
+	if err := ip.Run(); !errors.As(err, &e) || e.Code != 1 || e.Message != "Step limit of 100 lines exceeded" {
+		t.Errorf("got error %v, want the step limit", err)
+	}
+}